@@ -58,11 +58,19 @@ func main() {
 	if err != nil {
 		logs.Qezap.Fatal("mongo connect failed ", zap.Error(err))
 	}
+	for _, name := range model.LegacyAlarmRuleIndexNames {
+		if err := db.Database().DropIndexIfExists(model.CollectionNameAlarmRule, name); err != nil {
+			logs.Qezap.Fatal("mongo drop index ", zap.Error(err))
+		}
+	}
 	if err := db.Database().UpsertCollectionIndexMany(
 		model.ModuleIndexMany(),
 		model.AlarmRuleIndexMany(),
+		model.ProcessorIndexMany(),
 		model.DBStatsIndexMany(),
-		model.CollStatsIndexMany()); err != nil {
+		model.CollStatsIndexMany(),
+		model.AuditLogIndexMany(),
+		model.SavedSearchIndexMany()); err != nil {
 		logs.Qezap.Fatal("mongo create index ", zap.Error(err))
 	}
 
@@ -75,6 +83,17 @@ func main() {
 		}
 	}()
 
+	var grpcSrv *manager.GRPCService
+	if cfg.ManagerGRPCAddr != "" {
+		grpcSrv = manager.NewGRPCService()
+		go func() {
+			logs.Qezap.Info("grpc server listen", zap.String("addr", cfg.ManagerGRPCAddr))
+			if err := grpcSrv.Run(cfg.ManagerGRPCAddr); err != nil {
+				logs.Qezap.Fatal("grpc server listen failed", zap.Error(err))
+			}
+		}()
+	}
+
 	logs.Qezap.Info("init", zap.Any("config", cfg.Print()), zap.Strings("buildInfo", []string{
 		goVersion,
 		gitHash,
@@ -83,8 +102,11 @@ func main() {
 
 	signalAccept()
 
-	sharding.Disconnect()
 	err = multierr.Combine(err, httpSrv.Close())
+	if grpcSrv != nil {
+		err = multierr.Combine(err, grpcSrv.Close())
+	}
+	sharding.Disconnect()
 	logs.Qezap.Debug("exit", zap.Error(err))
 	_ = logs.Qezap.Close()
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -63,29 +64,77 @@ func main() {
 		logs.Qezap.Fatal("mongo connect failed", zap.Error(err))
 	}
 	if err := db.Database().UpsertCollectionIndexMany(
-		model.ModuleMetricsIndexMany()); err != nil {
+		model.ModuleMetricsIndexMany(),
+		model.QuotaUsageIndexMany(),
+		model.AlarmWindowIndexMany(),
+		model.LoggingPatternIndexMany()); err != nil {
 		logs.Qezap.Fatal("mongo create index", zap.Error(err))
 	}
 
-	httpSrv := receiver.NewHTTPService()
+	// 所有接入服务共用配置、配额、报警与统计
+	core := receiver.NewService(sharding)
+	httpSrv := receiver.NewHTTPService(core)
 
 	go func() {
 		if err := httpSrv.Run(cfg.ReceiverAddr); err != nil {
 			logs.Qezap.Fatal("http server listen failed", zap.Error(err))
 		}
 	}()
+	if cfg.ReceiverAdminAddr != "" {
+		go func() {
+			if err := httpSrv.RunAdmin(cfg.ReceiverAdminAddr); err != nil {
+				logs.Qezap.Fatal("admin http server listen failed", zap.Error(err))
+			}
+		}()
+	}
 
-	grpcSrv := receiver.NewGRPCService()
+	grpcSrv := receiver.NewGRPCService(core)
 	go func() {
 		if err := grpcSrv.Run(cfg.ReceiverGRPCAddr); err != nil {
 			logs.Qezap.Fatal("gRPC server listen failed", zap.Error(err))
 		}
 	}()
 
+	var syslogSrv *receiver.SyslogService
+	if cfg.Syslog.UDPAddr != "" || cfg.Syslog.TCPAddr != "" {
+		syslogSrv = receiver.NewSyslogService(core)
+	}
+	if cfg.Syslog.UDPAddr != "" {
+		go func() {
+			if err := syslogSrv.RunUDP(cfg.Syslog.UDPAddr); err != nil {
+				logs.Qezap.Fatal("syslog udp listen failed", zap.Error(err))
+			}
+		}()
+	}
+	if cfg.Syslog.TCPAddr != "" {
+		go func() {
+			if err := syslogSrv.RunTCP(cfg.Syslog.TCPAddr); err != nil {
+				logs.Qezap.Fatal("syslog tcp listen failed", zap.Error(err))
+			}
+		}()
+	}
+
 	signalAccept()
-	_ = httpSrv.Close()
-	_ = grpcSrv.Close()
-	_ = sharding.Disconnect
+
+	// 先让就绪检查失败，等待负载均衡摘除后，再等待处理中的请求与队列写入完成
+	receiver.Drain()
+	logs.Qezap.Info("receiver draining", zap.Int("waitSec", cfg.Shutdown.DrainWaitSec))
+	time.Sleep(time.Duration(cfg.Shutdown.DrainWaitSec) * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.TimeoutSec)*time.Second)
+	defer cancel()
+	if err := httpSrv.Shutdown(ctx); err != nil {
+		logs.Qezap.Error("http server shutdown", zap.Error(err))
+	}
+	if err := grpcSrv.Shutdown(ctx); err != nil {
+		logs.Qezap.Error("gRPC server shutdown", zap.Error(err))
+	}
+	if syslogSrv != nil {
+		_ = syslogSrv.Close()
+	}
+	core.Close()
+	sharding.Disconnect()
+	_ = logs.Qezap.Close()
 }
 
 func signalAccept() {
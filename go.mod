@@ -6,6 +6,7 @@ require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gin-gonic/gin v1.6.3
+	github.com/golang/snappy v0.0.1
 	github.com/huzhongqing/qelog/api v0.11.1
 	github.com/huzhongqing/qelog/qezap v0.14.3
 	github.com/json-iterator/go v1.1.10
@@ -13,4 +14,5 @@ require (
 	go.uber.org/multierr v1.5.0
 	go.uber.org/zap v1.16.0
 	google.golang.org/grpc v1.34.1
+	google.golang.org/protobuf v1.25.0
 )
@@ -10,6 +10,7 @@ const (
 
 	ErrCodeUnauthorized     = 401
 	ErrCodeNotFound         = 404
+	ErrCodeThrottled        = 429
 	ErrCodeSystemException  = 500
 	ErrCodeArgsInvalid      = 1001
 	ErrCodeContextNil       = 1002
@@ -24,6 +25,7 @@ var CodeMessage = map[int]string{
 
 	ErrCodeUnauthorized:     "unauthorized",
 	ErrCodeNotFound:         "not found",
+	ErrCodeThrottled:        "throttled",
 	ErrCodeSystemException:  "system exception",
 	ErrCodeArgsInvalid:      "arguments invalid",
 	ErrCodeContextNil:       "context nil",
@@ -38,6 +40,7 @@ var (
 	ErrCtxClaimsNil     = NewError(ErrCodeUnauthorized, "context claims nil")
 	ErrArgsInvalid      = NewError(ErrCodeArgsInvalid, CodeMessage[ErrCodeArgsInvalid])
 	ErrNotFound         = NewError(ErrCodeNotFound, CodeMessage[ErrCodeNotFound])
+	ErrThrottled        = NewError(ErrCodeThrottled, CodeMessage[ErrCodeThrottled])
 	ErrSystemException  = NewError(ErrCodeSystemException, CodeMessage[ErrCodeSystemException])
 	ErrOpException      = NewError(ErrCodeOpException, CodeMessage[ErrCodeOpException])
 )
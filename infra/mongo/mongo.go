@@ -116,9 +116,10 @@ type Index struct {
 	Collection         string
 	Name               string // 指定索引名称
 	Keys               bson.D
-	Unique             bool  // 唯一索引
-	Background         bool  // 非阻塞创建索引
-	ExpireAfterSeconds int32 // 多少秒后过期
+	Unique             bool   // 唯一索引
+	Background         bool   // 非阻塞创建索引
+	ExpireAfterSeconds int32  // 多少秒后过期
+	PartialFilter      bson.M // 部分索引，只对满足条件的文档建立索引
 }
 
 func (i Index) Validate() error {
@@ -151,6 +152,9 @@ func (db *Database) UpsertCollectionIndexMany(indexMany ...[]Index) error {
 			if index.ExpireAfterSeconds > 0 {
 				opt.SetExpireAfterSeconds(index.ExpireAfterSeconds)
 			}
+			if len(index.PartialFilter) > 0 {
+				opt.SetPartialFilterExpression(index.PartialFilter)
+			}
 
 			model.Options = opt
 
@@ -172,3 +176,17 @@ func (db *Database) UpsertCollectionIndexMany(indexMany ...[]Index) error {
 
 	return nil
 }
+
+// DropIndexIfExists 删除已经不再使用的索引，集合或索引不存在时忽略
+func (db *Database) DropIndexIfExists(collection, name string) error {
+	_, err := db.Collection(collection).Indexes().DropOne(context.Background(), name)
+	if err != nil {
+		var cmdErr mongo.CommandError
+		// 26 NamespaceNotFound 27 IndexNotFound
+		if errors.As(err, &cmdErr) && (cmdErr.Code == 26 || cmdErr.Code == 27) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
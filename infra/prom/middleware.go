@@ -0,0 +1,53 @@
+package prom
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	httpRequests = NewCounterVec("qelog_http_requests_total",
+		"HTTP requests by route and status code.", "server", "method", "path", "code")
+	httpDuration = NewHistogramVec("qelog_http_request_duration_seconds",
+		"HTTP request latency by route.", nil, "server", "method", "path")
+	grpcRequests = NewCounterVec("qelog_grpc_requests_total",
+		"gRPC unary requests by method and status code.", "method", "code")
+	grpcDuration = NewHistogramVec("qelog_grpc_request_duration_seconds",
+		"gRPC unary request latency by method.", nil, "method")
+)
+
+// GinMiddleware 使用路由模板作为 path，避免参数导致标签过多
+func GinMiddleware(server string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		httpRequests.WithLabelValues(server, c.Request.Method, path, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(server, c.Request.Method, path).Observe(time.Since(start).Seconds())
+	}
+}
+
+func GinHandler() gin.HandlerFunc {
+	h := Handler()
+	return func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		grpcRequests.WithLabelValues(info.FullMethod, status.Code(err).String()).Inc()
+		grpcDuration.WithLabelValues(info.FullMethod).Observe(time.Since(start).Seconds())
+		return resp, err
+	}
+}
@@ -0,0 +1,378 @@
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Prometheus 文本格式(0.0.4)的简单实现，只包含进程自身监控需要的 counter gauge histogram
+// 指标在包初始化时注册到 Default，通过 Handler 暴露
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	Default = NewRegistry()
+	// DefBuckets 单位秒
+	DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+type collector interface {
+	desc() (name, help, typ string)
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mutex      sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+func (r *Registry) register(c collector) {
+	name, _, _ := c.desc()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.collectors[name]; ok {
+		panic("prom: duplicate metric " + name)
+	}
+	r.collectors[name] = c
+}
+
+// Expose 按指标名排序输出
+func (r *Registry) Expose(w io.Writer) error {
+	r.mutex.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		name, help, typ := c.desc()
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_ = r.Expose(w)
+	})
+}
+
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// vec 按标签值区分的一组指标
+type vec struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mutex    sync.RWMutex
+	children map[string]interface{}
+	values   map[string][]string
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{
+		name:     name,
+		help:     help,
+		typ:      typ,
+		labels:   labels,
+		children: make(map[string]interface{}),
+		values:   make(map[string][]string),
+	}
+}
+
+func (v *vec) desc() (string, string, string) {
+	return v.name, v.help, v.typ
+}
+
+func (v *vec) child(values []string, create func() interface{}) interface{} {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("prom: %s expected %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mutex.RLock()
+	c, ok := v.children[key]
+	v.mutex.RUnlock()
+	if ok {
+		return c
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if c, ok = v.children[key]; !ok {
+		c = create()
+		v.children[key] = c
+		v.values[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+// each 按标签值排序遍历
+func (v *vec) each(fn func(values []string, c interface{})) {
+	v.mutex.RLock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	v.mutex.RUnlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		v.mutex.RLock()
+		c, values := v.children[k], v.values[k]
+		v.mutex.RUnlock()
+		fn(values, c)
+	}
+}
+
+// value 原子操作的 float64
+type value struct {
+	bits uint64
+}
+
+func (v *value) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		n := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (v *value) Set(val float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(val))
+}
+
+func (v *value) Get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+type Counter struct {
+	value
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+type CounterVec struct {
+	*vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newVec(name, help, "counter", labels)}
+	Default.register(v)
+	return v
+}
+
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.child(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.each(func(values []string, c interface{}) {
+		writeSample(w, v.name, v.labels, values, "", "", c.(*Counter).Get())
+	})
+}
+
+type Gauge struct {
+	value
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+type GaugeVec struct {
+	*vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{newVec(name, help, "gauge", labels)}
+	Default.register(v)
+	return v
+}
+
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.child(values, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.each(func(values []string, c interface{}) {
+		writeSample(w, v.name, v.labels, values, "", "", c.(*Gauge).Get())
+	})
+}
+
+// GaugeFunc 输出时调用 fn 采集当前值
+type GaugeFunc struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+	fn     func(emit func(val float64, values ...string))
+}
+
+func NewGaugeFunc(name, help string, labels []string, fn func(emit func(val float64, values ...string))) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, typ: "gauge", labels: labels, fn: fn}
+	Default.register(g)
+	return g
+}
+
+// NewCounterFunc 计数已在其他地方维护，输出时读取
+func NewCounterFunc(name, help string, labels []string, fn func(emit func(val float64, values ...string))) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, typ: "counter", labels: labels, fn: fn}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) desc() (string, string, string) {
+	return g.name, g.help, g.typ
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.fn(func(val float64, values ...string) {
+		writeSample(w, g.name, g.labels, values, "", "", val)
+	})
+}
+
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mutex.Lock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+	h.mutex.Unlock()
+}
+
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// NewHistogramVec buckets 为空时使用 DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	v := &HistogramVec{vec: newVec(name, help, "histogram", labels), buckets: buckets}
+	Default.register(v)
+	return v
+}
+
+func (v *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return v.child(values, func() interface{} {
+		return &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+	}).(*Histogram)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.each(func(values []string, c interface{}) {
+		h := c.(*Histogram)
+		h.mutex.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		count, sum := h.count, h.sum
+		h.mutex.Unlock()
+
+		var cumulative uint64
+		for i, upper := range v.buckets {
+			cumulative += counts[i]
+			writeSample(w, v.name+"_bucket", v.labels, values, "le", formatFloat(upper), float64(cumulative))
+		}
+		writeSample(w, v.name+"_bucket", v.labels, values, "le", "+Inf", float64(count))
+		writeSample(w, v.name+"_sum", v.labels, values, "", "", sum)
+		writeSample(w, v.name+"_count", v.labels, values, "", "", float64(count))
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extraName, extraValue string, val float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l)
+			w.WriteString(`="`)
+			w.WriteString(escapeLabel(values[i]))
+			w.WriteByte('"')
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName)
+			w.WriteString(`="`)
+			w.WriteString(extraValue)
+			w.WriteByte('"')
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(val))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
@@ -0,0 +1,46 @@
+package prom
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_Expose(t *testing.T) {
+	// 使用单独的注册表，多次运行时不会重复注册
+	defer func(r *Registry) { Default = r }(Default)
+	Default = NewRegistry()
+
+	c := NewCounterVec("test_requests_total", "Requests.", "code")
+	c.WithLabelValues("200").Add(2)
+	c.WithLabelValues(`5"0\0`).Inc()
+	h := NewHistogramVec("test_duration_seconds", "Latency.", []float64{0.1, 1})
+	h.WithLabelValues().Observe(0.05)
+	h.WithLabelValues().Observe(0.5)
+	h.WithLabelValues().Observe(3)
+	NewGaugeFunc("test_queue_depth", "Depth.", []string{"queue"}, func(emit func(val float64, values ...string)) {
+		emit(7, "a")
+	})
+
+	buf := &bytes.Buffer{}
+	if err := Default.Expose(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{code="200"} 2` + "\n",
+		`test_requests_total{code="5\"0\\0"} 1` + "\n",
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{le="0.1"} 1` + "\n",
+		`test_duration_seconds_bucket{le="1"} 2` + "\n",
+		`test_duration_seconds_bucket{le="+Inf"} 3` + "\n",
+		"test_duration_seconds_sum 3.55\n",
+		"test_duration_seconds_count 3\n",
+		`test_queue_depth{queue="a"} 7` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in\n%s", want, out)
+		}
+	}
+}
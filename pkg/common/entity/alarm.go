@@ -8,26 +8,64 @@ type FindAlarmRuleListReq struct {
 }
 
 type FindAlarmRuleList struct {
-	ID           string `json:"id"`
-	Enable       bool   `json:"enable"`
-	ModuleName   string `json:"moduleName"`
-	Short        string `json:"short"`
-	Level        int32  `json:"level"`
-	Tag          string `json:"tag"`
-	RateSec      int64  `json:"rateSec"`
-	Method       int32  `json:"method"`
-	HookID       string `json:"hookId"`
-	UpdatedTsSec int64  `json:"updatedTsSec"`
+	ID             string  `json:"id"`
+	Enable         bool    `json:"enable"`
+	ModuleName     string  `json:"moduleName"`
+	Short          string  `json:"short"`
+	ShortMatch     string  `json:"shortMatch"`
+	Full           string  `json:"full"`
+	FullMatch      string  `json:"fullMatch"`
+	Level          int32   `json:"level"`
+	LevelOp        string  `json:"levelOp"`
+	IP             string  `json:"ip"`
+	ConditionOne   string  `json:"conditionOne"`
+	ConditionTwo   string  `json:"conditionTwo"`
+	ConditionThree string  `json:"conditionThree"`
+	Type           int32   `json:"type"`
+	WindowSec      int64   `json:"windowSec"`
+	Threshold      float64 `json:"threshold"`
+	EvalSec        int64   `json:"evalSec"`
+	Tag            string  `json:"tag"`
+	RateSec        int64   `json:"rateSec"`
+	Method         int32   `json:"method"`
+	HookID         string  `json:"hookId"`
+	SavedSearchID  string  `json:"savedSearchId"`
+	UpdatedTsSec   int64   `json:"updatedTsSec"`
 }
 
 type CreateAlarmRuleReq struct {
-	ModuleName string `json:"moduleName" binding:"required"`
-	Short      string `json:"short" binding:"required"`
-	Level      int32  `json:"level" binding:"min=-1,max=8"`
-	Tag        string `json:"tag" binding:"omitempty,gte=1,lte=128"`
-	RateSec    int64  `json:"rateSec" binding:"min=0"`
-	Method     int32  `json:"method" binding:"required,min=1"`
-	HookID     string `json:"hookId" binding:"required,len=24"`
+	// 关联保存的查询时，模块、短消息与等级使用查询中的条件
+	SavedSearchID string `json:"savedSearchId" binding:"omitempty,len=24"`
+	ModuleName    string `json:"moduleName" binding:"required_without=SavedSearchID"`
+	// 完全相同的逐条匹配时必填，其他情况为空时不限制短消息
+	Short string `json:"short" binding:"omitempty,lte=256"`
+	// 以下条件字段不传入时，修改保持不变
+	// exact prefix contains regex，为空时为 exact
+	ShortMatch *string `json:"shortMatch" binding:"omitempty,oneof='' exact prefix contains regex"`
+	// 详情条件，为空时不限制
+	Full      *string `json:"full" binding:"omitempty,lte=256"`
+	FullMatch *string `json:"fullMatch" binding:"omitempty,oneof='' exact prefix contains regex"`
+	Level     int32   `json:"level" binding:"min=-1,max=8"`
+	// eq gte，为空时逐条匹配为 eq，窗口规则为 gte
+	LevelOp *string `json:"levelOp" binding:"omitempty,oneof='' eq gte"`
+	// 不为空时需要相同
+	IP             *string `json:"ip" binding:"omitempty,lte=64"`
+	ConditionOne   *string `json:"conditionOne" binding:"omitempty,lte=128"`
+	ConditionTwo   *string `json:"conditionTwo" binding:"omitempty,lte=128"`
+	ConditionThree *string `json:"conditionThree" binding:"omitempty,lte=128"`
+	// 0-逐条匹配 1-窗口内条数 2-窗口内占模块总数的百分比 3-窗口内单个 IP 的条数
+	// 4-窗口内模块没有日志 5-上一个窗口有日志的 IP 在窗口内没有日志，没有日志的规则恢复后通知
+	// 为空时新建为逐条匹配，修改时保持不变
+	Type *int32 `json:"type" binding:"omitempty,min=0,max=5"`
+	// 窗口规则的统计窗口与阈值，窗口内满足条件的日志计入，没有日志的规则不使用阈值
+	WindowSec *int64   `json:"windowSec" binding:"omitempty,min=0,max=86400"`
+	Threshold *float64 `json:"threshold" binding:"omitempty,min=0"`
+	// 窗口规则的检查间隔，为 0 时使用 receiver 的配置
+	EvalSec *int64 `json:"evalSec" binding:"omitempty,min=0,max=3600"`
+	Tag     string `json:"tag" binding:"omitempty,gte=1,lte=128"`
+	RateSec int64  `json:"rateSec" binding:"min=0"`
+	Method  int32  `json:"method" binding:"required,min=1"`
+	HookID  string `json:"hookId" binding:"required,len=24"`
 }
 
 type UpdateAlarmRuleReq struct {
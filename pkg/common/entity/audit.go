@@ -0,0 +1,18 @@
+package entity
+
+type FindAuditLogListReq struct {
+	Action string `json:"action" form:"action"`
+	PageReq
+}
+
+type FindAuditLogList struct {
+	ID           string `json:"id"`
+	Action       string `json:"action"`
+	Operator     string `json:"operator"`
+	ClientIP     string `json:"clientIp"`
+	Params       string `json:"params"`
+	Rows         int64  `json:"rows"`
+	Error        string `json:"error"`
+	CostMill     int64  `json:"costMill"`
+	CreatedTsSec int64  `json:"createdTsSec"`
+}
@@ -72,4 +72,6 @@ func (v TimeReq) InitTimeSection(t time.Duration) (b, e time.Time) {
 type ListResp struct {
 	Count int64       `json:"count"`
 	List  interface{} `json:"list"`
+	// 游标分页时下一页的游标，为空表示没有下一页
+	NextCursor string `json:"nextCursor,omitempty"`
 }
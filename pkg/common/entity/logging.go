@@ -9,8 +9,16 @@ type FindLoggingListReq struct {
 	ConditionOne   string `json:"conditionOne"`
 	ConditionTwo   string `json:"conditionTwo"`
 	ConditionThree string `json:"conditionThree"`
+	// 全文搜索短消息与详情，空格分隔的关键词都需命中，双引号内为短语，模块需开启全文搜索
+	Keyword string `json:"keyword" binding:"omitempty,lte=256"`
+	// 结构化详情的字段条件，都需满足，模块需开启结构化存储
+	Fields []FieldPredicate `json:"fields" binding:"omitempty,max=5,dive"`
+	// 短消息模板 ID，模块需开启模板提取
+	PatternID string `json:"patternId" binding:"omitempty,len=16,hexadecimal"`
 	// 指定查询集合
 	ForceCollectionName string `json:"forceCollectionName"`
+	// 上一页返回的 nextCursor，不为空时只使用 limit，为空时按 page 查询
+	Cursor string `json:"cursor"`
 	TimeReq
 	PageReq
 }
@@ -23,6 +31,102 @@ type FindLoggingByTraceIDReq struct {
 	ForceCollectionName string `json:"forceCollectionName"`
 }
 
+// ExportLoggingReq 条件与日志列表一致，不使用游标与分页
+type ExportLoggingReq struct {
+	FindLoggingListReq
+	Format string `json:"format" binding:"required,oneof=ndjson csv"`
+	Gzip   bool   `json:"gzip"`
+	// 导出的列，与日志列表的字段名一致，为空导出所有列
+	Columns []string `json:"columns" binding:"omitempty,max=10"`
+	// 最多导出的条数，为 0 或超过配置时使用配置的最大值
+	MaxRows int64 `json:"maxRows" binding:"omitempty,min=1"`
+}
+
+// AggregateLoggingReq 条件与日志列表一致，interval 与 groupBy 至少需要一个
+type AggregateLoggingReq struct {
+	FindLoggingListReq
+	// 按时间分桶统计
+	Interval string `json:"interval" binding:"omitempty,oneof=1m 5m 1h"`
+	// 分组统计的字段
+	GroupBy []string `json:"groupBy" binding:"omitempty,max=2,dive,oneof=level short ip conditionOne conditionTwo conditionThree pattern"`
+	// 返回数量最多的分组数，默认 10
+	TopN int `json:"topN" binding:"omitempty,min=1,max=100"`
+}
+
+type AggregateLoggingResp struct {
+	Total int64 `json:"total"`
+	// 分桶的开始时间，没有 interval 时为空
+	BucketsTsSec []int64 `json:"bucketsTsSec"`
+	// 按数量倒序，没有 groupBy 时只有一个分组
+	Groups []*LoggingAggregateGroup `json:"groups"`
+	// 单个集合的分组结果超过限制，数量不完整
+	Truncated bool `json:"truncated"`
+}
+
+// LoggingAggregateGroup Key 为 groupBy 的字段，Series 与 BucketsTsSec 对应
+type LoggingAggregateGroup struct {
+	Key    map[string]interface{} `json:"key,omitempty"`
+	Count  int64                  `json:"count"`
+	Series []int64                `json:"series,omitempty"`
+}
+
+// QueryLoggingReq 使用查询语句查询，例如 module:order level>=warn short~"timeout" | count by ip
+type QueryLoggingReq struct {
+	ShardingIndex int    `json:"shardingIndex" binding:"required,min=0"`
+	Query         string `json:"query" binding:"required,lte=1024"`
+	// 上一页返回的 nextCursor，count 时无效
+	Cursor string `json:"cursor"`
+	TimeReq
+	PageReq
+}
+
+// LoggingCountGroup count by 的分组，Key 为查询语句中的字段名
+type LoggingCountGroup struct {
+	Key   map[string]interface{} `json:"key"`
+	Count int64                  `json:"count"`
+}
+
+// FindLoggingContextReq 查询日志前后的日志，集合为空时按 ID 的时间查找
+type FindLoggingContextReq struct {
+	ShardingIndex       int    `json:"shardingIndex" form:"shardingIndex" binding:"required,min=0"`
+	ID                  string `json:"id" form:"id" binding:"required,len=24"`
+	ForceCollectionName string `json:"forceCollectionName" form:"forceCollectionName"`
+	// 前后各返回的条数，默认 20
+	Before int64 `json:"before" form:"before" binding:"omitempty,min=1,max=200"`
+	After  int64 `json:"after" form:"after" binding:"omitempty,min=1,max=200"`
+	// 只返回相同 IP 或相同 TraceID 的日志
+	SameIP    bool `json:"sameIp" form:"sameIp"`
+	SameTrace bool `json:"sameTrace" form:"sameTrace"`
+	// 前后查找的时间范围，默认 1 小时
+	WindowSec int64 `json:"windowSec" form:"windowSec" binding:"omitempty,min=1,max=86400"`
+}
+
+// FindLoggingContextResp Before 与 After 都按时间正序
+type FindLoggingContextResp struct {
+	Anchor *FindLoggingList   `json:"anchor"`
+	Before []*FindLoggingList `json:"before"`
+	After  []*FindLoggingList `json:"after"`
+}
+
+// FieldPredicate 嵌套字段用 . 连接，如 req.status
+type FieldPredicate struct {
+	Key string `json:"key" binding:"required,lte=128"`
+	Op  string `json:"op" binding:"required,oneof=eq ne gt gte lt lte exists in"`
+	// exists 时为 bool，in 时为数组，其余为字符串或数字
+	Value interface{} `json:"value"`
+}
+
+// TailLoggingReq 实时日志的筛选条件，Level 为空表示所有等级
+type TailLoggingReq struct {
+	ShardingIndex int    `form:"shardingIndex" binding:"required,min=0"`
+	ModuleName    string `form:"moduleName" binding:"required"`
+	Level         *int32 `form:"level" binding:"omitempty,min=-1,max=5"`
+	Short         string `form:"short"`
+	IP            string `form:"ip"`
+	// 每秒最多推送的条数，不能超过配置
+	Rate int `form:"rate" binding:"omitempty,min=1"`
+}
+
 type FindLoggingList struct {
 	ID             string `json:"id"`
 	TsMill         int64  `json:"tsMill"`
@@ -34,4 +138,67 @@ type FindLoggingList struct {
 	ConditionThree string `json:"conditionThree"`
 	TraceID        string `json:"traceId"`
 	IP             string `json:"ip"`
+	// 全文搜索时返回，分数越高越相关
+	Score     int               `json:"score,omitempty"`
+	Highlight *LoggingHighlight `json:"highlight,omitempty"`
+}
+
+// LoggingHighlight 关键词在短消息与详情中的位置
+type LoggingHighlight struct {
+	Short []HighlightSpan `json:"short"`
+	Full  []HighlightSpan `json:"full"`
+}
+
+// HighlightSpan 按字符计算，End 不包含
+type HighlightSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// FindTraceReq 查询所有模块的同一个 TraceID，没有传入时间时从 TraceID 解析，前后 2 小时
+type FindTraceReq struct {
+	TraceID string `json:"traceId" form:"traceId" binding:"required,gte=16,lte=64"`
+	TimeReq
+}
+
+type FindTraceResp struct {
+	TraceID      string `json:"traceId"`
+	Count        int64  `json:"count"`
+	StartTsMill  int64  `json:"startTsMill"`
+	EndTsMill    int64  `json:"endTsMill"`
+	DurationMill int64  `json:"durationMill"`
+	// 日志数量超过限制，只返回最早的部分
+	Truncated bool           `json:"truncated"`
+	Modules   []*TraceModule `json:"modules"`
+	// 日志中有 span id 时的调用树
+	Spans []*TraceSpan `json:"spans"`
+	// 按时间正序
+	List []*TraceLogging `json:"list"`
+}
+
+type TraceModule struct {
+	ModuleName   string `json:"moduleName"`
+	Count        int64  `json:"count"`
+	ErrorCount   int64  `json:"errorCount"`
+	StartTsMill  int64  `json:"startTsMill"`
+	EndTsMill    int64  `json:"endTsMill"`
+	DurationMill int64  `json:"durationMill"`
+}
+
+type TraceSpan struct {
+	SpanID       string       `json:"spanId"`
+	ParentSpanID string       `json:"parentSpanId"`
+	ModuleName   string       `json:"moduleName"`
+	StartTsMill  int64        `json:"startTsMill"`
+	EndTsMill    int64        `json:"endTsMill"`
+	DurationMill int64        `json:"durationMill"`
+	Count        int          `json:"count"`
+	Children     []*TraceSpan `json:"children"`
+}
+
+type TraceLogging struct {
+	FindLoggingList
+	ModuleName   string `json:"moduleName"`
+	SpanID       string `json:"spanId,omitempty"`
+	ParentSpanID string `json:"parentSpanId,omitempty"`
 }
@@ -1,9 +1,40 @@
 package entity
 
 type CreateModuleReq struct {
-	Name          string `json:"name" binding:"required,gte=2,lte=24,lowercase"`
-	ShardingIndex int    `json:"shardingIndex" binding:"required,min=1,max=16"`
-	Desc          string `json:"desc" binding:"omitempty,gte=1,lte=128"`
+	Name          string        `json:"name" binding:"required,gte=2,lte=24,lowercase"`
+	ShardingIndex int           `json:"shardingIndex" binding:"required,min=1,max=16"`
+	Desc          string        `json:"desc" binding:"omitempty,gte=1,lte=128"`
+	Decoder       ModuleDecoder `json:"decoder"`
+	Quota         ModuleQuota   `json:"quota"`
+	// 开启全文搜索，只对开启后写入的日志生效
+	FullText bool `json:"fullText"`
+	// 详情按字段存储，只对开启后写入的日志生效
+	StructuredFull bool `json:"structuredFull"`
+	// 提取短消息模板，只对开启后写入的日志生效
+	PatternMining bool `json:"patternMining"`
+}
+
+// ModuleQuota 为 0 表示不限制
+type ModuleQuota struct {
+	LinesPerSec int   `json:"linesPerSec" binding:"min=0"`
+	BytesPerDay int64 `json:"bytesPerDay" binding:"min=0"`
+	MaxLineSize int   `json:"maxLineSize" binding:"min=0"`
+}
+
+// ModuleDecoder 非 qezap 格式日志的解析方式
+type ModuleDecoder struct {
+	// logfmt regex grok nginx apache，为空只解析 qezap JSON
+	Type       string   `json:"type" binding:"omitempty,oneof=logfmt regex grok nginx apache"`
+	Pattern    string   `json:"pattern" binding:"omitempty,lte=1024"`
+	LevelKey   string   `json:"levelKey"`
+	MessageKey string   `json:"messageKey"`
+	TimeKey    string   `json:"timeKey"`
+	TimeLayout string   `json:"timeLayout"`
+	TraceIDKey string   `json:"traceIdKey"`
+	TagKeys    []string `json:"tagKeys" binding:"omitempty,max=3"`
+	// 合并多行的异常堆栈
+	Multiline      bool   `json:"multiline"`
+	MultilineStart string `json:"multilineStart" binding:"omitempty,lte=256"`
 }
 
 type FindModuleListReq struct {
@@ -12,18 +43,37 @@ type FindModuleListReq struct {
 }
 
 type FindModuleList struct {
-	ID                   string `json:"id"`
-	Name                 string `json:"name"`
-	Desc                 string `json:"desc"`
-	ShardingIndex        int    `json:"shardingIndex"`
-	HistoryShardingIndex []int  `json:"historyShardingIndex"`
-	UpdatedTsSec         int64  `json:"updatedTsSec"`
+	ID                   string        `json:"id"`
+	Name                 string        `json:"name"`
+	Desc                 string        `json:"desc"`
+	ShardingIndex        int           `json:"shardingIndex"`
+	HistoryShardingIndex []int         `json:"historyShardingIndex"`
+	Decoder              ModuleDecoder `json:"decoder"`
+	Quota                ModuleQuota   `json:"quota"`
+	Pending              bool          `json:"pending"`
+	FullText             bool          `json:"fullText"`
+	StructuredFull       bool          `json:"structuredFull"`
+	PatternMining        bool          `json:"patternMining"`
+	UpdatedTsSec         int64         `json:"updatedTsSec"`
 }
 
+// UpdateModuleReq 为空的指针字段不修改，旧版本页面只传入名称、描述与分片
 type UpdateModuleReq struct {
 	ObjectIDReq
-	ShardingIndex int    `json:"shardingIndex" binding:"required,min=1,max=16"`
-	Desc          string `json:"desc" binding:"required,gte=1,lte=128"`
+	ShardingIndex int            `json:"shardingIndex" binding:"required,min=1,max=16"`
+	Desc          string         `json:"desc" binding:"required,gte=1,lte=128"`
+	Decoder       *ModuleDecoder `json:"decoder"`
+	Quota         *ModuleQuota   `json:"quota"`
+	// 开启全文搜索，只对开启后写入的日志生效
+	FullText *bool `json:"fullText"`
+	// 详情按字段存储，只对开启后写入的日志生效
+	StructuredFull *bool `json:"structuredFull"`
+	// 提取短消息模板，只对开启后写入的日志生效
+	PatternMining *bool `json:"patternMining"`
+}
+
+type ApproveModuleReq struct {
+	ObjectIDReq
 }
 
 type DeleteModuleReq struct {
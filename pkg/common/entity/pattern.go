@@ -0,0 +1,20 @@
+package entity
+
+// FindTopPatternReq 时间范围按小时统计，没有传入时间时为最近一天
+type FindTopPatternReq struct {
+	ModuleName string `json:"moduleName" form:"moduleName" binding:"required"`
+	Limit      int64  `json:"limit" form:"limit" binding:"omitempty,min=1,max=100"`
+	TimeReq
+}
+
+type TopPattern struct {
+	PatternID string `json:"patternId"`
+	Template  string `json:"template"`
+	// 时间范围内的数量
+	Count int64 `json:"count"`
+	// 保留期内的总数
+	TotalCount     int64    `json:"totalCount"`
+	FirstSeenTsSec int64    `json:"firstSeenTsSec"`
+	LastSeenTsSec  int64    `json:"lastSeenTsSec"`
+	SampleIDs      []string `json:"sampleIds"`
+}
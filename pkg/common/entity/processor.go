@@ -0,0 +1,45 @@
+package entity
+
+type FindProcessorListReq struct {
+	Enable     int    `json:"enable" form:"enable" binding:"omitempty,min=-1,max=1"`
+	ModuleName string `json:"moduleName" form:"moduleName"`
+	PageReq
+}
+
+type FindProcessorList struct {
+	ID           string  `json:"id"`
+	Enable       bool    `json:"enable"`
+	ModuleName   string  `json:"moduleName"`
+	Sort         int     `json:"sort"`
+	Type         string  `json:"type"`
+	Field        string  `json:"field"`
+	Target       string  `json:"target"`
+	Pattern      string  `json:"pattern"`
+	Value        string  `json:"value"`
+	Rate         float64 `json:"rate"`
+	MaxLen       int     `json:"maxLen"`
+	UpdatedTsSec int64   `json:"updatedTsSec"`
+}
+
+type CreateProcessorReq struct {
+	ModuleName string  `json:"moduleName" binding:"required"`
+	Sort       int     `json:"sort" binding:"min=0"`
+	Type       string  `json:"type" binding:"required,oneof=drop sample set rename remove parse_json extract truncate mask"`
+	Field      string  `json:"field" binding:"omitempty,lte=128"`
+	Target     string  `json:"target" binding:"omitempty,lte=128"`
+	Pattern    string  `json:"pattern" binding:"omitempty,lte=1024"`
+	Value      string  `json:"value" binding:"omitempty,lte=1024"`
+	Rate       float64 `json:"rate" binding:"min=0,max=1"`
+	MaxLen     int     `json:"maxLen" binding:"min=0"`
+}
+
+type UpdateProcessorReq struct {
+	ObjectIDReq
+	Enable bool `json:"enable"`
+	// module_name 不支持修改
+	CreateProcessorReq
+}
+
+type DeleteProcessorReq struct {
+	ObjectIDReq
+}
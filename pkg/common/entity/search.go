@@ -0,0 +1,76 @@
+package entity
+
+// SearchFilter 与日志列表的查询条件一致，Query 不为空时使用查询语句，只需要 shardingIndex
+type SearchFilter struct {
+	ShardingIndex  int              `json:"shardingIndex" binding:"min=0"`
+	ModuleName     string           `json:"moduleName" binding:"required_without=Query"`
+	Short          string           `json:"short"`
+	Level          int32            `json:"level" binding:"omitempty,min=-2,max=5"`
+	IP             string           `json:"ip"`
+	ConditionOne   string           `json:"conditionOne"`
+	ConditionTwo   string           `json:"conditionTwo"`
+	ConditionThree string           `json:"conditionThree"`
+	Keyword        string           `json:"keyword" binding:"omitempty,lte=256"`
+	Fields         []FieldPredicate `json:"fields" binding:"omitempty,max=5,dive"`
+	PatternID      string           `json:"patternId" binding:"omitempty,len=16,hexadecimal"`
+	Query          string           `json:"query" binding:"omitempty,lte=1024"`
+}
+
+type FindSavedSearchListReq struct {
+	Name string `json:"name" form:"name"`
+	PageReq
+}
+
+type FindSavedSearchList struct {
+	ID           string        `json:"id"`
+	ShortID      string        `json:"shortId"`
+	Name         string        `json:"name"`
+	Owner        string        `json:"owner"`
+	Shared       bool          `json:"shared"`
+	Filter       *SearchFilter `json:"filter"`
+	RelativeSec  int64         `json:"relativeSec"`
+	UpdatedTsSec int64         `json:"updatedTsSec"`
+}
+
+type CreateSavedSearchReq struct {
+	Name   string       `json:"name" binding:"required,lte=64"`
+	Shared bool         `json:"shared"`
+	Filter SearchFilter `json:"filter"`
+	// 查询最近多少秒的日志
+	RelativeSec int64 `json:"relativeSec" binding:"required,min=60,max=2592000"`
+}
+
+type UpdateSavedSearchReq struct {
+	ObjectIDReq
+	CreateSavedSearchReq
+}
+
+type DeleteSavedSearchReq struct {
+	ObjectIDReq
+}
+
+// CreateShareLinkReq 分享保存的查询，或者分享当前的查询条件与时间
+type CreateShareLinkReq struct {
+	SavedSearchID string        `json:"savedSearchId" binding:"omitempty,len=24"`
+	Filter        *SearchFilter `json:"filter" binding:"required_without=SavedSearchID"`
+	TimeReq
+}
+
+type CreateShareLinkResp struct {
+	ShortID string `json:"shortId"`
+}
+
+type ResolveShareLinkReq struct {
+	ShortID string `json:"shortId" uri:"shortId" binding:"required,alphanum"`
+	// 保存的查询按相对时间计算的结束时间，默认为当前时间
+	AtTsSec int64 `json:"atTsSec" form:"atTsSec"`
+}
+
+// ResolveShareLinkResp 具体的查询条件与时间，可以直接用于日志列表或查询语句
+type ResolveShareLinkResp struct {
+	Name       string        `json:"name"`
+	Temporary  bool          `json:"temporary"`
+	Filter     *SearchFilter `json:"filter"`
+	BeginTsSec int64         `json:"beginTsSec"`
+	EndTsSec   int64         `json:"endTsSec"`
+}
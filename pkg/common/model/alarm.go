@@ -20,18 +20,77 @@ const (
 	MethodDingDing = iota + 1
 )
 
+// 报警规则类型，除逐条匹配外都按时间窗口统计
+const (
+	// 逐条匹配模块、短消息与等级
+	AlarmRuleTypeMatch AlarmRuleType = iota
+	// 窗口内命中的条数超过阈值
+	AlarmRuleTypeCount
+	// 窗口内命中的条数占模块总条数的百分比超过阈值
+	AlarmRuleTypeRatio
+	// 窗口内单个 IP 命中的条数超过阈值
+	AlarmRuleTypeIPCount
+	// 窗口内模块没有满足条件的日志，恢复后通知
+	AlarmRuleTypeAbsence
+	// 上一个窗口有日志的 IP 在窗口内没有满足条件的日志，恢复后通知
+	AlarmRuleTypeIPAbsence
+)
+
+type AlarmRuleType int32
+
+func (t AlarmRuleType) Int32() int32 {
+	return int32(t)
+}
+
+// Windowed 是否按时间窗口统计
+func (t AlarmRuleType) Windowed() bool {
+	return t == AlarmRuleTypeCount || t == AlarmRuleTypeRatio || t == AlarmRuleTypeIPCount || t.Absence()
+}
+
+// Absence 是否为没有日志时报警
+func (t AlarmRuleType) Absence() bool {
+	return t == AlarmRuleTypeAbsence || t == AlarmRuleTypeIPAbsence
+}
+
+// 短消息与详情的匹配方式，为空时为完全相同
+const (
+	MatchExact    = "exact"
+	MatchPrefix   = "prefix"
+	MatchContains = "contains"
+	MatchRegex    = "regex"
+)
+
+// 等级的比较方式，为空时逐条匹配为等于，窗口规则为不低于
+const (
+	LevelOpEq  = "eq"
+	LevelOpGte = "gte"
+)
+
 // AlarmRule
 type AlarmRule struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty"`
-	Enable     bool               `bson:"enable"`       // 是否开启
-	ModuleName string             `bson:"module_name" ` // 哪个模块
-	Short      string             `bson:"short"`        // 命中的短消息
-	Level      Level              `bson:"level"`        // 命中日志等级
-	Tag        string             `bson:"tag"`          // 报警Tag
-	RateSec    int64              `bson:"rate_sec"`     // 多少s之内，只发送一次
-	Method     Method             `bson:"method"`       // 支持方式  1-钉钉
-	HookID     string             `bson:"hook_id"`
-	UpdatedAt  time.Time          `bson:"updated_at"`
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	Enable         bool               `bson:"enable"`       // 是否开启
+	ModuleName     string             `bson:"module_name" ` // 哪个模块
+	Short          string             `bson:"short"`        // 命中的短消息
+	ShortMatch     string             `bson:"short_match"`  // 短消息匹配方式
+	Full           string             `bson:"full"`         // 命中的详情，为空时不限制
+	FullMatch      string             `bson:"full_match"`   // 详情匹配方式
+	LevelOp        string             `bson:"level_op"`     // 等级比较方式
+	IP             string             `bson:"ip"`           // 以下条件不为空时需要相同
+	ConditionOne   string             `bson:"condition_one"`
+	ConditionTwo   string             `bson:"condition_two"`
+	ConditionThree string             `bson:"condition_three"`
+	Level          Level              `bson:"level"`      // 命中日志等级
+	Type           AlarmRuleType      `bson:"type"`       // 规则类型
+	WindowSec      int64              `bson:"window_sec"` // 统计窗口
+	Threshold      float64            `bson:"threshold"`  // 条数或百分比
+	EvalSec        int64              `bson:"eval_sec"`   // 检查间隔，为 0 时使用配置
+	Tag            string             `bson:"tag"`        // 报警Tag
+	RateSec        int64              `bson:"rate_sec"`   // 多少s之内，只发送一次
+	Method         Method             `bson:"method"`     // 支持方式  1-钉钉
+	HookID         string             `bson:"hook_id"`
+	SavedSearchID  string             `bson:"saved_search_id"` // 关联的保存查询，条件在保存时复制
+	UpdatedAt      time.Time          `bson:"updated_at"`
 }
 
 func (AlarmRule) CollectionName() string {
@@ -42,6 +101,14 @@ func (ar AlarmRule) Key() string {
 	return fmt.Sprintf("%s_%s_%s", ar.ModuleName, ar.Short, ar.Level)
 }
 
+// Plain 只按模块、短消息与等级完全匹配，可以直接按 Key 查找
+func (ar AlarmRule) Plain() bool {
+	return !ar.Type.Windowed() &&
+		(ar.ShortMatch == "" || ar.ShortMatch == MatchExact) &&
+		(ar.LevelOp == "" || ar.LevelOp == LevelOpEq) &&
+		ar.Full == "" && ar.IP == "" && ar.ConditionOne == "" && ar.ConditionTwo == "" && ar.ConditionThree == ""
+}
+
 type HookURL struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
 	Name      string             `bson:"name"`
@@ -70,9 +137,18 @@ func (m Method) String() string {
 	return v
 }
 
+// LegacyAlarmRuleIndexNames 旧版本的唯一索引不包含全部条件与窗口，启动时删除
+var LegacyAlarmRuleIndexNames = []string{
+	"module_name_1_short_1_level_1",
+	"module_name_1_short_1_level_1_type_1",
+	"module_name_1_short_1_level_1_type_1_short_match_1_full_1_full_match_1_level_op_1_ip_1_condition_one_1_condition_two_1_condition_three_1",
+}
+
 func AlarmRuleIndexMany() []mongo.Index {
 	return []mongo.Index{{
+		// 条件较多，自动生成的名称会超过旧版本 MongoDB 的长度限制
 		Collection: CollectionNameAlarmRule,
+		Name:       "alarm_rule_conditions",
 		Keys: bson.D{
 			{
 				Key: "module_name", Value: 1,
@@ -83,6 +159,42 @@ func AlarmRuleIndexMany() []mongo.Index {
 			{
 				Key: "level", Value: 1,
 			},
+			{
+				Key: "type", Value: 1,
+			},
+			{
+				Key: "short_match", Value: 1,
+			},
+			{
+				Key: "full", Value: 1,
+			},
+			{
+				Key: "full_match", Value: 1,
+			},
+			{
+				Key: "level_op", Value: 1,
+			},
+			{
+				Key: "ip", Value: 1,
+			},
+			{
+				Key: "condition_one", Value: 1,
+			},
+			{
+				Key: "condition_two", Value: 1,
+			},
+			{
+				Key: "condition_three", Value: 1,
+			},
+			{
+				Key: "window_sec", Value: 1,
+			},
+			{
+				Key: "threshold", Value: 1,
+			},
+			{
+				Key: "eval_sec", Value: 1,
+			},
 		},
 		Unique:     true,
 		Background: true,
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionNameAlarmWindow = "alarm_window"
+	CollectionNameAlarmFire   = "alarm_fire"
+)
+
+// AlarmWindow 每个 receiver 实例每个周期的窗口规则计数，所有实例的计数相加后判断是否报警
+type AlarmWindow struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	RuleID    string             `bson:"rule_id"`
+	Instance  string             `bson:"instance"`
+	Bucket    int64              `bson:"bucket"` // 周期的开始时间
+	Group     string             `bson:"group"`  // 按 IP 统计时为 IP
+	Hit       int64              `bson:"hit"`
+	Total     int64              `bson:"total"` // 按比例统计时模块的总条数
+	UpdatedAt time.Time          `bson:"updated_at"`
+}
+
+func (AlarmWindow) CollectionName() string {
+	return CollectionNameAlarmWindow
+}
+
+// AlarmFire 窗口规则最近一次报警，多个实例抢占同一条记录，保证间隔内只发送一次
+// 没有日志的规则按分组记录是否处于报警中，恢复时切换状态
+type AlarmFire struct {
+	ID      string    `bson:"_id"` // 规则 ID，没有日志的规则为规则 ID 与分组
+	FiredAt time.Time `bson:"fired_at"`
+	Firing  bool      `bson:"firing"`
+}
+
+func (AlarmFire) CollectionName() string {
+	return CollectionNameAlarmFire
+}
+
+func AlarmWindowIndexMany() []mongo.Index {
+	return []mongo.Index{
+		{
+			Collection: CollectionNameAlarmWindow,
+			Keys: bson.D{
+				{
+					Key: "rule_id", Value: 1,
+				},
+				{
+					Key: "bucket", Value: 1,
+				},
+			},
+			Background: true,
+		},
+		{
+			// 窗口最大为一天
+			Collection:         CollectionNameAlarmWindow,
+			Keys:               bson.D{{Key: "updated_at", Value: 1}},
+			Background:         true,
+			ExpireAfterSeconds: 2 * 24 * 3600,
+		},
+	}
+}
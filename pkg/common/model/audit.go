@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionNameAuditLog = "audit_log"
+)
+
+const (
+	AuditActionExportLogging = "export_logging"
+)
+
+// AuditLog 管理端敏感操作的记录，如导出日志
+type AuditLog struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	Action    string             `bson:"action"`
+	Operator  string             `bson:"operator"`
+	ClientIP  string             `bson:"client_ip"`
+	Params    string             `bson:"params"` // 请求参数 JSON
+	Rows      int64              `bson:"rows"`   // 导出的条数
+	Error     string             `bson:"error"`  // 为空表示成功
+	CostMill  int64              `bson:"cost_mill"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+func (AuditLog) CollectionName() string {
+	return CollectionNameAuditLog
+}
+
+func AuditLogIndexMany() []mongo.Index {
+	return []mongo.Index{{
+		Collection: CollectionNameAuditLog,
+		Keys: bson.D{
+			{
+				Key: "action", Value: 1,
+			},
+			{
+				Key: "created_at", Value: -1,
+			},
+		},
+		Background: true,
+	}}
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/huzhongqing/qelog/infra/mongo"
@@ -36,9 +37,12 @@ type Logging struct {
 	Condition2 string             `bson:"c2"`
 	Condition3 string             `bson:"c3"`
 	TraceID    string             `bson:"ti"`
-	TimeMill   int64              `bson:"tm"` // 日志打印时间
-	TimeSec    int64              `bson:"ts"` // 秒, 用于建立秒级别索引, ts 返回结果排序, 所以会存在毫秒级别一定的误差
-	MessageID  string             `bson:"mi"` // 如果重复写入，可以通过此ID忽略返回结果
+	TimeMill   int64              `bson:"tm"`           // 日志打印时间
+	TimeSec    int64              `bson:"ts"`           // 秒, 用于建立秒级别索引, ts 返回结果排序, 所以会存在毫秒级别一定的误差
+	MessageID  string             `bson:"mi"`           // 如果重复写入，可以通过此ID忽略返回结果
+	Tokens     []string           `bson:"tk,omitempty"` // 模块开启全文搜索时，短消息与详情的分词
+	Fields     bson.M             `bson:"fd,omitempty"` // 模块开启结构化存储时，按字段存储的详情，Full 为空
+	PatternID  string             `bson:"pi,omitempty"` // 模块开启模板提取时，短消息匹配的模板
 	Size       int                `bson:"-"`
 }
 
@@ -72,6 +76,18 @@ func (lvl Level) String() string {
 	return v
 }
 
+// FullString 结构化存储的详情转换成 JSON 展示
+func (l Logging) FullString() string {
+	if l.Full != "" || len(l.Fields) == 0 {
+		return l.Full
+	}
+	b, err := json.Marshal(l.Fields)
+	if err != nil {
+		return l.Full
+	}
+	return string(b)
+}
+
 // 多条件查询只建立了一个联合索引，减少索引大小，提升写入速度
 // 结合查询条件限制，保证此联合索引命中
 func LoggingIndexMany(collectionName string) []mongo.Index {
@@ -118,5 +134,26 @@ func LoggingIndexMany(collectionName string) []mongo.Index {
 			},
 			Background: true,
 		},
+		{
+			Collection: collectionName,
+			Keys: bson.D{
+				// 全文搜索，只有开启的模块才有分词，部分索引不占用其他模块的空间
+				{Key: "m", Value: 1},
+				{Key: "tk", Value: 1},
+			},
+			PartialFilter: bson.M{"tk": bson.M{"$exists": true}},
+			Background:    true,
+		},
+		{
+			Collection: collectionName,
+			Keys: bson.D{
+				// 按模板查询，只有开启模板提取的模块才有
+				{Key: "m", Value: 1},
+				{Key: "pi", Value: 1},
+				{Key: "ts", Value: 1},
+			},
+			PartialFilter: bson.M{"pi": bson.M{"$exists": true}},
+			Background:    true,
+		},
 	}
 }
@@ -21,7 +21,87 @@ type Module struct {
 	Desc                 string             `bson:"desc" json:"desc"`
 	ShardingIndex        int                `bson:"sharding_index"`
 	HistoryShardingIndex []int              `bson:"history_sharding_index"`
-	UpdatedAt            time.Time          `bson:"updated_at" json:"updated_at"`
+	// 非 qezap 格式日志的解析方式
+	Decoder ModuleDecoder `bson:"decoder" json:"decoder"`
+	// 写入限制，多个 receiver 共享
+	Quota ModuleQuota `bson:"quota" json:"quota"`
+	// 自动注册的模块等待管理员审批，审批前不写入
+	Pending bool `bson:"pending" json:"pending"`
+	// 写入时生成短消息与详情的分词，支持全文搜索，会增加存储与索引大小
+	FullText bool `bson:"full_text" json:"full_text"`
+	// 详情为 JSON 对象时按字段存储，支持按字段查询
+	StructuredFull bool `bson:"structured_full" json:"structured_full"`
+	// 写入时提取短消息的模板，统计模板数量，支持按模板查询
+	PatternMining bool      `bson:"pattern_mining" json:"pattern_mining"`
+	UpdatedAt     time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+const (
+	DecoderTypeLogfmt = "logfmt"
+	DecoderTypeRegex  = "regex"
+	DecoderTypeGrok   = "grok"
+	DecoderTypeNginx  = "nginx"
+	DecoderTypeApache = "apache"
+)
+
+// ModuleDecoder 日志行解析配置，Type 为空只解析 qezap JSON
+type ModuleDecoder struct {
+	Type string `bson:"type" json:"type"`
+	// regex 命名分组正则，grok 表达式，nginx log_format(为空使用 combined)
+	Pattern string `bson:"pattern" json:"pattern"`
+	// 提取字段名，为空时使用常见字段名
+	LevelKey   string `bson:"level_key" json:"levelKey"`
+	MessageKey string `bson:"message_key" json:"messageKey"`
+	TimeKey    string `bson:"time_key" json:"timeKey"`
+	// Go 时间格式，为空时尝试常见格式
+	TimeLayout string `bson:"time_layout" json:"timeLayout"`
+	TraceIDKey string `bson:"trace_id_key" json:"traceIdKey"`
+	// 映射到查询条件 c1 c2 c3
+	TagKeys []string `bson:"tag_keys" json:"tagKeys"`
+	// 合并多行的异常堆栈
+	Multiline bool `bson:"multiline" json:"multiline"`
+	// 新一条日志首行的正则，为空时按堆栈续行的特征判断
+	MultilineStart string `bson:"multiline_start" json:"multilineStart"`
+}
+
+// ModuleQuota 为 0 表示不限制
+type ModuleQuota struct {
+	// 每秒写入的日志条数
+	LinesPerSec int `bson:"lines_per_sec" json:"linesPerSec"`
+	// 每天写入的字节数
+	BytesPerDay int64 `bson:"bytes_per_day" json:"bytesPerDay"`
+	// 单条日志最大字节，超出截断
+	MaxLineSize int `bson:"max_line_size" json:"maxLineSize"`
+}
+
+func (q ModuleQuota) Limited() bool {
+	return q.LinesPerSec > 0 || q.BytesPerDay > 0
+}
+
+// ShardingIndexUse 每个分片索引上的模块数量
+func ShardingIndexUse(docs []*Module) map[int]int {
+	state := make(map[int]int)
+	for i := 1; i <= ShardingIndexSize; i++ {
+		state[i] = 0
+	}
+	for _, v := range docs {
+		num, ok := state[v.ShardingIndex]
+		if ok {
+			state[v.ShardingIndex] = num + 1
+		}
+	}
+	return state
+}
+
+// SuggestShardingIndex 模块数量最少的分片索引，数量相同时取较小的索引
+func SuggestShardingIndex(docs []*Module) int {
+	suggest, min := ShardingIndexSize, -1
+	for k, v := range ShardingIndexUse(docs) {
+		if min < 0 || v < min || (v == min && k < suggest) {
+			suggest, min = k, v
+		}
+	}
+	return suggest
 }
 
 func (m Module) CollectionName() string {
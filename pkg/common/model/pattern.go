@@ -0,0 +1,93 @@
+package model
+
+import (
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionNameLoggingPattern      = "logging_pattern"
+	CollectionNameLoggingPatternStats = "logging_pattern_stats"
+)
+
+// 模板与统计没有写入后保留的时间
+const loggingPatternRetain = 30 * 24 * 3600
+
+// LoggingPattern 模块短消息的模板，由 receiver 写入时提取，多个实例共同累加
+type LoggingPattern struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	ModuleName string             `bson:"module_name"`
+	PatternID  string             `bson:"pattern_id"`
+	Template   string             `bson:"template"`
+	Count      int64              `bson:"count"`
+	FirstSeen  time.Time          `bson:"first_seen"`
+	LastSeen   time.Time          `bson:"last_seen"`
+	SampleIDs  []string           `bson:"sample_ids"` // 最近匹配的日志 ID
+	UpdatedAt  time.Time          `bson:"updated_at"`
+}
+
+func (LoggingPattern) CollectionName() string {
+	return CollectionNameLoggingPattern
+}
+
+// LoggingPatternStats 模板每小时的数量，用于查询时间范围内的模板排行
+type LoggingPatternStats struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	ModuleName string             `bson:"module_name"`
+	PatternID  string             `bson:"pattern_id"`
+	Hour       time.Time          `bson:"hour"`
+	Count      int64              `bson:"count"`
+}
+
+func (LoggingPatternStats) CollectionName() string {
+	return CollectionNameLoggingPatternStats
+}
+
+func LoggingPatternIndexMany() []mongo.Index {
+	return []mongo.Index{
+		{
+			Collection: CollectionNameLoggingPattern,
+			Keys: bson.D{
+				{
+					Key: "module_name", Value: 1,
+				},
+				{
+					Key: "pattern_id", Value: 1,
+				},
+			},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Collection:         CollectionNameLoggingPattern,
+			Keys:               bson.D{{Key: "updated_at", Value: 1}},
+			Background:         true,
+			ExpireAfterSeconds: loggingPatternRetain,
+		},
+		{
+			Collection: CollectionNameLoggingPatternStats,
+			Keys: bson.D{
+				{
+					Key: "module_name", Value: 1,
+				},
+				{
+					Key: "hour", Value: 1,
+				},
+				{
+					Key: "pattern_id", Value: 1,
+				},
+			},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Collection:         CollectionNameLoggingPatternStats,
+			Keys:               bson.D{{Key: "hour", Value: 1}},
+			Background:         true,
+			ExpireAfterSeconds: loggingPatternRetain,
+		},
+	}
+}
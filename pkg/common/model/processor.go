@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionNameProcessor = "processor"
+)
+
+const (
+	ProcessorDrop      = "drop"       // Field 匹配 Pattern 时丢弃
+	ProcessorSample    = "sample"     // 按 Rate 比例保留，Pattern 不为空时只对匹配的日志采样
+	ProcessorSet       = "set"        // Field 设置为 Value
+	ProcessorRename    = "rename"     // Field 移动到 Target
+	ProcessorRemove    = "remove"     // 删除 Field
+	ProcessorParseJSON = "parse_json" // Field 为 JSON 字符串，解析后合并到 full
+	ProcessorExtract   = "extract"    // Pattern 命名分组提取到同名字段，如 c1 short
+	ProcessorTruncate  = "truncate"   // Field 超过 MaxLen 截断
+	ProcessorMask      = "mask"       // Field 匹配 Pattern 的内容替换为 Value
+)
+
+// Processor 模块写入前的处理规则，同一模块按 Sort 从小到大依次执行
+// Field 可以是 short level ip c1 c2 c3 trace_id full，其他为 full JSON 中的字段，支持 a.b 的路径写法
+type Processor struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Enable     bool               `bson:"enable"`
+	ModuleName string             `bson:"module_name"`
+	Sort       int                `bson:"sort"`
+	Type       string             `bson:"type"`
+	Field      string             `bson:"field"`
+	Target     string             `bson:"target"`
+	Pattern    string             `bson:"pattern"`
+	Value      string             `bson:"value"`
+	Rate       float64            `bson:"rate"`
+	MaxLen     int                `bson:"max_len"`
+	UpdatedAt  time.Time          `bson:"updated_at"`
+}
+
+func (Processor) CollectionName() string {
+	return CollectionNameProcessor
+}
+
+func ProcessorIndexMany() []mongo.Index {
+	return []mongo.Index{{
+		Collection: CollectionNameProcessor,
+		Keys: bson.D{
+			{
+				Key: "module_name", Value: 1,
+			},
+			{
+				Key: "sort", Value: 1,
+			},
+		},
+		Background: true,
+	}}
+}
@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionNameQuotaUsage = "quota_usage"
+)
+
+// QuotaUsage 每个 receiver 实例每天的写入量，用于多实例之间核对模块配额
+type QuotaUsage struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	ModuleName  string             `bson:"module_name"`
+	Instance    string             `bson:"instance"`
+	Number      int64              `bson:"number"`
+	Size        int64              `bson:"size"`
+	Rate        float64            `bson:"rate"`         // 最近一个周期每秒写入的条数
+	CreatedDate time.Time          `bson:"created_date"` // 创建日期
+	UpdatedAt   time.Time          `bson:"updated_at"`
+}
+
+func (qu QuotaUsage) CollectionName() string {
+	return CollectionNameQuotaUsage
+}
+
+func QuotaUsageIndexMany() []mongo.Index {
+	return []mongo.Index{
+		{
+			Collection: CollectionNameQuotaUsage,
+			Keys: bson.D{
+				{
+					Key: "module_name", Value: 1,
+				},
+				{
+					Key: "created_date", Value: 1,
+				},
+			},
+			Background: true,
+		},
+		{
+			Collection:         CollectionNameQuotaUsage,
+			Keys:               bson.D{{Key: "updated_at", Value: 1}},
+			Background:         true,
+			ExpireAfterSeconds: 3 * 24 * 3600,
+		},
+	}
+}
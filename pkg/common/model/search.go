@@ -0,0 +1,92 @@
+package model
+
+import (
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	CollectionNameSavedSearch = "saved_search"
+)
+
+// 分享链接保留的时间
+const shareLinkRetain = 30 * 24 * 3600
+
+// SavedSearch 保存的查询条件，分享链接也保存在这里
+// 保存的查询使用相对时间，分享链接为 Temporary，使用绝对时间并在创建后一段时间删除
+type SavedSearch struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty"`
+	ShortID string             `bson:"short_id"`
+	Name    string             `bson:"name"`
+	Owner   string             `bson:"owner"`
+	Shared  bool               `bson:"shared"`
+	Filter  SearchFilter       `bson:"filter"`
+	// 最近多少秒，保存的查询使用
+	RelativeSec int64 `bson:"relative_sec"`
+	// 绝对时间，分享链接使用
+	BeginTsSec int64     `bson:"begin_ts_sec"`
+	EndTsSec   int64     `bson:"end_ts_sec"`
+	Temporary  bool      `bson:"temporary"`
+	SharedAt   time.Time `bson:"shared_at,omitempty"` // 分享链接的创建时间，用于过期删除
+	CreatedAt  time.Time `bson:"created_at"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
+
+func (SavedSearch) CollectionName() string {
+	return CollectionNameSavedSearch
+}
+
+// SearchFilter 与日志列表的查询条件一致，Query 不为空时使用查询语句，只使用 ShardingIndex
+type SearchFilter struct {
+	ShardingIndex  int           `bson:"sharding_index"`
+	ModuleName     string        `bson:"module_name"`
+	Level          int32         `bson:"level"`
+	Short          string        `bson:"short"`
+	IP             string        `bson:"ip"`
+	ConditionOne   string        `bson:"condition_one"`
+	ConditionTwo   string        `bson:"condition_two"`
+	ConditionThree string        `bson:"condition_three"`
+	Keyword        string        `bson:"keyword"`
+	Fields         []SearchField `bson:"fields"`
+	PatternID      string        `bson:"pattern_id"`
+	Query          string        `bson:"query"`
+}
+
+type SearchField struct {
+	Key   string      `bson:"key"`
+	Op    string      `bson:"op"`
+	Value interface{} `bson:"value"`
+}
+
+func SavedSearchIndexMany() []mongo.Index {
+	return []mongo.Index{
+		{
+			Collection: CollectionNameSavedSearch,
+			Keys:       bson.D{{Key: "short_id", Value: 1}},
+			Unique:     true,
+			Background: true,
+		},
+		{
+			Collection: CollectionNameSavedSearch,
+			Keys: bson.D{
+				{
+					Key: "owner", Value: 1,
+				},
+				{
+					Key: "updated_at", Value: -1,
+				},
+			},
+			Background: true,
+		},
+		{
+			// 只有分享链接设置了分享时间，保存的查询不会过期
+			Collection:         CollectionNameSavedSearch,
+			Keys:               bson.D{{Key: "shared_at", Value: 1}},
+			Background:         true,
+			ExpireAfterSeconds: shareLinkRetain,
+		},
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"errors"
+	"regexp"
 
 	"github.com/huzhongqing/qelog/infra/defval"
 
@@ -22,6 +23,10 @@ type Config struct {
 	ReceiverAddr     string `default:"0.0.0.0:31081"`
 	ReceiverGRPCAddr string `default:":31082"`
 	ManagerAddr      string `default:"0.0.0.0:31080"`
+	// 管理端 gRPC 地址，提供实时日志订阅，为空则不开启
+	ManagerGRPCAddr string
+	// Receiver 监控与内部状态的 HTTP 地址，与写入端口分开，为空则不开启
+	ReceiverAdminAddr string `default:"127.0.0.1:31083"`
 
 	AuthEnable    bool `default:"true"`
 	AlarmEnable   bool `default:"true"`
@@ -44,6 +49,39 @@ type Config struct {
 	Main MongoMainDB
 	// 日志内容的分片配置存储对象
 	Sharding []MongoShardingDB
+
+	// Syslog 接入，地址为空则不开启
+	Syslog Syslog
+	// OpenTelemetry OTLP 日志接入
+	OTLP OTLP
+	// Loki push API 接入
+	Loki Loki
+	// Elasticsearch _bulk API 接入
+	Elasticsearch Elasticsearch
+
+	// 报警与统计的异步队列
+	Worker Worker
+
+	// 未注册模块自动注册
+	AutoRegister AutoRegister
+
+	// receiver 退出时的下线流程
+	Shutdown Shutdown
+
+	// 管理端实时查看日志
+	Tail Tail
+
+	// 日志查询限制
+	Query Query
+
+	// 日志导出
+	Export Export
+
+	// 短消息模板提取
+	Pattern Pattern
+
+	// 按时间窗口统计的报警规则
+	AlarmWindow AlarmWindow
 }
 
 func InitConfig(filename string) *Config {
@@ -85,6 +123,20 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	for _, v := range c.AutoRegister.NamePatterns {
+		if _, err := regexp.Compile(v); err != nil {
+			return errors.New("autoRegister.namePatterns " + err.Error())
+		}
+	}
+	switch c.AutoRegister.PendingAction {
+	case PendingActionDrop, PendingActionBuffer:
+	default:
+		return errors.New("autoRegister.pendingAction must be drop or buffer")
+	}
+	if c.AlarmWindow.FlushSec <= 0 || c.AlarmWindow.EvalSec < c.AlarmWindow.FlushSec {
+		return errors.New("alarmWindow.evalSec must be greater than or equal to flushSec")
+	}
+
 	return nil
 }
 
@@ -120,3 +172,164 @@ type Logging struct {
 	Addr     []string `default:"127.0.0.1:31082"`
 	Filename string   `default:"./log/logger.log"`
 }
+
+type Syslog struct {
+	UDPAddr string
+	TCPAddr string
+	// 单条消息最大字节
+	MaxMessageSize int `default:"65536"`
+	// 未命中路由规则时写入的模块，为空则使用 APP-NAME 作为模块名
+	DefaultModule string
+	// 使用 HOSTNAME 作为日志IP，否则使用来源地址
+	HostnameAsIP bool
+	// 按顺序匹配，命中第一条即停止
+	Routes []SyslogRoute
+}
+
+// SyslogRoute AppName Hostname 为空表示匹配所有，以 * 结尾表示前缀匹配
+type SyslogRoute struct {
+	AppName      string
+	Hostname     string
+	Module       string
+	HostnameAsIP bool
+}
+
+type OTLP struct {
+	// 开启后 HTTP 监听 /v1/logs, gRPC 注册 LogsService
+	Enable bool
+	// 依次从资源属性中读取模块名
+	ModuleAttributes []string `default:"qelog.module,service.name"`
+	// 依次从资源属性中读取IP，都不存在时使用来源地址
+	IPAttributes []string `default:"host.ip,net.host.ip"`
+	// 资源属性中没有模块名时写入的模块，为空则拒绝写入
+	DefaultModule string
+	// 日志属性映射到查询条件 c1 c2 c3，最多3个
+	ConditionAttributes []string
+}
+
+type Loki struct {
+	// 开启后 HTTP 监听 /loki/api/v1/push
+	Enable bool
+	// 依次从流标签中读取模块名
+	ModuleLabels []string `default:"module,app,job,service_name"`
+	// 依次从流标签中读取IP，都不存在时使用来源地址
+	IPLabels []string `default:"ip,host"`
+	// 依次从结构化元数据与流标签中读取日志等级
+	LevelLabels []string `default:"level,detected_level,severity"`
+	// 流标签中没有模块名时写入的模块，为空则拒绝写入
+	DefaultModule string
+	// 标签映射到查询条件 c1 c2 c3，最多3个
+	ConditionLabels []string
+}
+
+type Elasticsearch struct {
+	// 开启后 HTTP 监听 /_bulk /{index}/_bulk
+	Enable bool
+	// 索引映射模块，按顺序匹配
+	Indices []ElasticsearchIndex
+	// 索引未命中规则时写入的模块，为空则去掉索引日期后缀作为模块名
+	DefaultModule string
+	// 依次读取的字段，支持 a.b 的路径写法
+	MessageFields []string `default:"message,msg,log"`
+	LevelFields   []string `default:"level,log.level,severity"`
+	TimeFields    []string `default:"@timestamp,timestamp,time"`
+	IPFields      []string `default:"host.ip,ip"`
+	TraceFields   []string `default:"trace.id,trace_id,traceid"`
+	// 字段映射到查询条件 c1 c2 c3，最多3个
+	ConditionFields []string
+}
+
+// ElasticsearchIndex Index 以 * 结尾表示前缀匹配
+type ElasticsearchIndex struct {
+	Index  string
+	Module string
+}
+
+// Worker 队列满时直接丢弃，丢弃数量在 /v1/receiver/status 查看
+type Worker struct {
+	AlarmQueueSize int `default:"1024"`
+	AlarmWorkers   int `default:"2"`
+	// 报警发送队列，与规则匹配分开
+	DispatchQueueSize int `default:"256"`
+	DispatchWorkers   int `default:"4"`
+	// 发送失败重试次数，间隔从 1s 开始翻倍
+	DispatchRetry    int `default:"3"`
+	MetricsQueueSize int `default:"4096"`
+	MetricsWorkers   int `default:"1"`
+}
+
+const (
+	PendingActionDrop   = "drop"
+	PendingActionBuffer = "buffer"
+)
+
+// AutoRegister 未注册的模块首次写入时自动创建，分片索引与管理后台推荐的规则相同
+type AutoRegister struct {
+	Enable bool
+	// 模块名需匹配其中一条正则，为空表示都允许
+	NamePatterns []string
+	// 新模块的分片索引，为 0 时使用模块数最少的索引
+	ShardingIndex int
+	// 开启后新模块需要管理员审批才写入
+	Approval bool
+	// 待审批期间的日志 drop 丢弃，buffer 缓存在内存中，审批通过后写入
+	PendingAction string `default:"drop"`
+	// 每个待审批模块最多缓存的日志条数，超出丢弃
+	PendingBufferSize int `default:"1000"`
+	// 新模块注册后通知管理员的 hook_url ID，为空不通知
+	NotifyHookID string
+}
+
+// Shutdown 收到退出信号后先让就绪检查失败，等待负载均衡摘除后再关闭服务
+type Shutdown struct {
+	// 就绪检查失败后等待的秒数
+	DrainWaitSec int `default:"5"`
+	// 等待处理中的请求与队列写入完成的最长秒数
+	TimeoutSec int `default:"30"`
+}
+
+// Tail 实时日志依赖 change stream，分片库需要是副本集或分片集群
+type Tail struct {
+	// 同时订阅的最大数量
+	MaxSubscribers int `default:"100"`
+	// 每个订阅的缓冲条数，客户端读取慢时超出丢弃
+	Buffer int `default:"256"`
+	// 每个订阅每秒最多推送的条数，请求中的速率不能超过该值，0 表示不限制
+	RatePerSec int `default:"200"`
+}
+
+// Query 结构化字段条件不能使用索引，只在索引条件筛选后的日志中扫描
+type Query struct {
+	// 带字段条件时，索引条件命中的日志超过该数量则拒绝查询
+	MaxUnindexedScan int `default:"200000"`
+}
+
+// Export 导出在 HTTP 写超时内完成，数据量大时需要缩小时间范围分次导出
+type Export struct {
+	// 每次导出最多的条数，请求中的数量不能超过该值
+	MaxRows int64 `default:"1000000"`
+	// 每次从数据库读取的条数
+	BatchSize int32 `default:"1000"`
+}
+
+// Pattern 模块开启模板提取后，receiver 写入时按 Drain 算法提取短消息模板
+type Pattern struct {
+	// 解析树的深度，按前 Depth-2 个分词分支
+	Depth int `default:"4"`
+	// 相同位置相同分词的比例不低于该值时合并为同一个模板
+	SimThreshold float64 `default:"0.5"`
+	// 每个模块最多的模板数，超出后不再新增
+	MaxPatterns int `default:"1000"`
+	// 每个模板保留最近匹配的日志 ID 数量
+	MaxSamples int `default:"5"`
+}
+
+// AlarmWindow 窗口规则在 receiver 本地计数，周期性的写入主库，所有实例的计数相加后判断是否报警
+type AlarmWindow struct {
+	// 计数写入主库的间隔，也是窗口统计的最小粒度
+	FlushSec int64 `default:"10"`
+	// 规则没有设置检查间隔时使用
+	EvalSec int64 `default:"60"`
+	// 按 IP 统计时每个周期最多记录的 IP 数
+	MaxGroups int `default:"1000"`
+}
@@ -0,0 +1,179 @@
+package decoder
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+// 非 qezap JSON 格式的日志行解析，按模块配置
+// 解析出来的字段按配置提取等级、消息、时间、TraceID，剩余字段写入 full
+
+var ErrUnknownType = errors.New("decoder unknown type")
+
+var (
+	defaultLevelKeys   = []string{"level", "lvl", "severity"}
+	defaultMessageKeys = []string{"msg", "message"}
+	defaultTimeKeys    = []string{"time", "ts", "timestamp"}
+	defaultTraceIDKeys = []string{"trace_id", "traceid", "traceId"}
+
+	defaultTimeLayouts = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02 15:04:05.999999999",
+		"2006-01-02 15:04:05,999",
+		"2006/01/02 15:04:05",
+		"02/Jan/2006:15:04:05 -0700",
+	}
+)
+
+type Entry struct {
+	Level   string
+	Message string
+	Time    time.Time
+	TraceID string
+	// 未被提取的字段
+	Fields map[string]string
+}
+
+// parser 将一行日志解析成字段，不匹配返回 false
+type parser interface {
+	parse(line string) (map[string]string, bool)
+}
+
+type Decoder struct {
+	cfg    model.ModuleDecoder
+	parser parser
+	// access log 按状态码判断等级，请求行作为消息
+	access bool
+	start  *regexp.Regexp
+}
+
+// New Type 为空时返回 nil，不需要解析
+func New(cfg model.ModuleDecoder) (*Decoder, error) {
+	dec := &Decoder{cfg: cfg}
+	var err error
+	switch cfg.Type {
+	case "":
+		return nil, nil
+	case model.DecoderTypeLogfmt:
+		dec.parser = logfmtParser{}
+	case model.DecoderTypeRegex:
+		dec.parser, err = newRegexParser(cfg.Pattern)
+	case model.DecoderTypeGrok:
+		dec.parser, err = newGrokParser(cfg.Pattern)
+	case model.DecoderTypeNginx:
+		dec.parser, err = newNginxParser(cfg.Pattern)
+		dec.access = true
+	case model.DecoderTypeApache:
+		dec.parser, err = newRegexParser(accessLogPattern)
+		dec.access = true
+	default:
+		return nil, ErrUnknownType
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Multiline && cfg.MultilineStart != "" {
+		if dec.start, err = regexp.Compile(cfg.MultilineStart); err != nil {
+			return nil, err
+		}
+	}
+	return dec, nil
+}
+
+func (dec *Decoder) Multiline() bool {
+	return dec.cfg.Multiline
+}
+
+// TagKeys 映射到查询条件的字段
+func (dec *Decoder) TagKeys() []string {
+	return dec.cfg.TagKeys
+}
+
+// Decode 多行日志只解析首行，其余行写入 stack 字段
+func (dec *Decoder) Decode(line string) (*Entry, bool) {
+	head, stack := line, ""
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		head, stack = strings.TrimRight(line[:i], "\r"), line[i+1:]
+	}
+	fields, ok := dec.parser.parse(head)
+	if !ok {
+		return nil, false
+	}
+	e := &Entry{Fields: fields}
+	if dec.access {
+		dec.accessEntry(e)
+	} else {
+		e.Level = pick(fields, dec.cfg.LevelKey, defaultLevelKeys)
+		e.Message = pick(fields, dec.cfg.MessageKey, defaultMessageKeys)
+		e.Time = parseTime(pick(fields, dec.cfg.TimeKey, defaultTimeKeys), dec.cfg.TimeLayout)
+	}
+	e.TraceID = pick(fields, dec.cfg.TraceIDKey, defaultTraceIDKeys)
+	if stack != "" {
+		fields["stack"] = stack
+	}
+	return e, true
+}
+
+func (dec *Decoder) accessEntry(e *Entry) {
+	e.Message = pick(e.Fields, dec.cfg.MessageKey, []string{"request"})
+	if v, ok := e.Fields["time_iso8601"]; ok {
+		e.Time = parseTime(v, time.RFC3339)
+		delete(e.Fields, "time_iso8601")
+	} else {
+		e.Time = parseTime(pick(e.Fields, dec.cfg.TimeKey, []string{"time_local"}), "02/Jan/2006:15:04:05 -0700")
+	}
+	// 状态码保留在字段中，便于作为查询条件
+	status, _ := strconv.Atoi(e.Fields["status"])
+	switch {
+	case status >= 500:
+		e.Level = "ERROR"
+	case status >= 400:
+		e.Level = "WARN"
+	default:
+		e.Level = "INFO"
+	}
+}
+
+// pick 读取并删除字段，key 为空时依次尝试默认字段名
+func pick(fields map[string]string, key string, defaults []string) string {
+	keys := defaults
+	if key != "" {
+		keys = []string{key}
+	}
+	for _, k := range keys {
+		if v, ok := fields[k]; ok {
+			delete(fields, k)
+			return v
+		}
+	}
+	return ""
+}
+
+func parseTime(v, layout string) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	if layout != "" {
+		t, _ := time.Parse(layout, v)
+		return t
+	}
+	for _, l := range defaultTimeLayouts {
+		if t, err := time.Parse(l, v); err == nil {
+			return t
+		}
+	}
+	// 秒或毫秒时间戳
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		if f > 1e12 {
+			return time.Unix(0, int64(f*1e6))
+		}
+		return time.Unix(0, int64(f*1e9))
+	}
+	return time.Time{}
+}
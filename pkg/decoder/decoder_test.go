@@ -0,0 +1,106 @@
+package decoder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+func TestDecoder_Logfmt(t *testing.T) {
+	dec, err := New(model.ModuleDecoder{Type: model.DecoderTypeLogfmt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := dec.Decode(`time=2021-02-21T10:00:00Z level=warn msg="slow query" cost=35 trace_id=abc`)
+	if !ok {
+		t.Fatal("not match")
+	}
+	if e.Level != "warn" || e.Message != "slow query" || e.TraceID != "abc" || e.Time.Unix() != 1613901600 {
+		t.Fatal(e)
+	}
+	if len(e.Fields) != 1 || e.Fields["cost"] != "35" {
+		t.Fatal(e.Fields)
+	}
+	if _, ok := dec.Decode("plain text line"); ok {
+		t.Fatal("plain text matched")
+	}
+}
+
+func TestDecoder_Grok(t *testing.T) {
+	dec, err := New(model.ModuleDecoder{
+		Type:    model.DecoderTypeGrok,
+		Pattern: `%{TIMESTAMP_ISO8601:time} \[%{LOGLEVEL:level}\] %{GREEDYDATA:msg}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := dec.Decode("2021-02-21 10:00:00.123 [ERROR] connect refused\n\tat a.b.C.d(C.java:10)")
+	if !ok {
+		t.Fatal("not match")
+	}
+	if e.Level != "ERROR" || e.Message != "connect refused" || e.Time.IsZero() {
+		t.Fatal(e)
+	}
+	if e.Fields["stack"] != "\tat a.b.C.d(C.java:10)" {
+		t.Fatal(e.Fields)
+	}
+
+	if _, err := New(model.ModuleDecoder{Type: model.DecoderTypeGrok, Pattern: "%{UNKNOWN:x}"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestDecoder_Nginx(t *testing.T) {
+	line := `127.0.0.1 - - [21/Feb/2021:10:00:00 +0800] "GET /ping HTTP/1.1" 502 157 "-" "curl/7.64.1"`
+	dec, err := New(model.ModuleDecoder{Type: model.DecoderTypeNginx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := dec.Decode(line)
+	if !ok {
+		t.Fatal("not match")
+	}
+	if e.Level != "ERROR" || e.Message != "GET /ping HTTP/1.1" || e.Time.Unix() != 1613872800 || e.Fields["status"] != "502" {
+		t.Fatal(e)
+	}
+
+	dec, err = New(model.ModuleDecoder{
+		Type:    model.DecoderTypeNginx,
+		Pattern: `$remote_addr [$time_local] "$request" $status $request_time`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok = dec.Decode(`10.0.0.1 [21/Feb/2021:10:00:00 +0800] "POST /v1/x HTTP/1.1" 404 0.005`)
+	if !ok {
+		t.Fatal("not match")
+	}
+	if e.Level != "WARN" || e.Fields["request_time"] != "0.005" {
+		t.Fatal(e)
+	}
+}
+
+func TestDecoder_Join(t *testing.T) {
+	dec, _ := New(model.ModuleDecoder{Type: model.DecoderTypeLogfmt, Multiline: true})
+	lines := bytes.Split([]byte(`level=error msg="panic: runtime error"
+
+goroutine 1 [running]:
+main.main()
+	/app/main.go:10 +0x25
+level=info msg=next
+Exception in thread "main" java.lang.IllegalStateException: x
+	at com.example.App.main(App.java:5)
+Caused by: java.io.IOException: y
+	... 1 more`), []byte{'\n'})
+	out := dec.Join(lines)
+	if len(out) != 3 {
+		for _, v := range out {
+			t.Log(string(v))
+		}
+		t.Fatal(len(out))
+	}
+	if !bytes.HasSuffix(out[0], []byte("+0x25")) || !bytes.HasSuffix(out[2], []byte("... 1 more")) {
+		t.Fatal(string(out[0]), string(out[2]))
+	}
+}
@@ -0,0 +1,75 @@
+package decoder
+
+import "strings"
+
+// logfmt key=value key2="value with space"
+type logfmtParser struct{}
+
+func (logfmtParser) parse(line string) (map[string]string, bool) {
+	fields := make(map[string]string)
+	s := line
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+		end := strings.IndexAny(s, "= \t")
+		if end == 0 {
+			return nil, false
+		}
+		if end < 0 || s[end] != '=' {
+			// 没有值的键
+			if end < 0 {
+				end = len(s)
+			}
+			fields[s[:end]] = ""
+			s = s[end:]
+			continue
+		}
+		key := s[:end]
+		s = s[end+1:]
+		if strings.HasPrefix(s, `"`) {
+			var sb strings.Builder
+			i := 1
+			closed := false
+			for ; i < len(s); i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+					switch s[i] {
+					case 'n':
+						sb.WriteByte('\n')
+					case 't':
+						sb.WriteByte('\t')
+					default:
+						sb.WriteByte(s[i])
+					}
+					continue
+				}
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				sb.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, false
+			}
+			fields[key] = sb.String()
+			s = s[i+1:]
+			continue
+		}
+		end = strings.IndexAny(s, " \t")
+		if end < 0 {
+			end = len(s)
+		}
+		fields[key] = s[:end]
+		s = s[end:]
+	}
+	// 至少有一个 key=value，避免普通文本被当作 logfmt
+	for _, v := range fields {
+		if v != "" {
+			return fields, true
+		}
+	}
+	return nil, false
+}
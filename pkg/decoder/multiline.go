@@ -0,0 +1,43 @@
+package decoder
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// 堆栈续行的特征
+// Java: "\tat com.x.Y.f(Y.java:10)" "Caused by: ..." "... 5 more"
+// Go: "goroutine 1 [running]:" "main.main()" "\t/app/main.go:10 +0x25" "created by ..."
+var continuation = regexp.MustCompile(`^(?:\s|Caused by:|Suppressed:|\.\.\. \d+ more|goroutine \d+ \[|created by |[\w./*()\[\]-]+\(.*\)$|$)`)
+
+// Join 将堆栈续行合并到上一条日志，lines 按顺序排列
+func (dec *Decoder) Join(lines [][]byte) [][]byte {
+	out := make([][]byte, 0, len(lines))
+	for _, line := range lines {
+		if len(out) > 0 && !dec.isStart(line) {
+			last := out[len(out)-1]
+			merged := make([]byte, 0, len(last)+len(line)+1)
+			merged = append(merged, last...)
+			merged = append(merged, '\n')
+			out[len(out)-1] = append(merged, line...)
+			continue
+		}
+		out = append(out, line)
+	}
+	// 合并过程中的空行去掉
+	for i, v := range out {
+		out[i] = bytes.TrimRight(v, "\n")
+	}
+	return out
+}
+
+func (dec *Decoder) isStart(line []byte) bool {
+	if dec.start != nil {
+		return dec.start.Match(line)
+	}
+	// qezap JSON 总是新的一条
+	if len(line) > 0 && line[0] == '{' {
+		return true
+	}
+	return !continuation.Match(line)
+}
@@ -0,0 +1,150 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var ErrNoNamedGroup = errors.New("decoder pattern requires named groups")
+
+// 命名分组作为字段名
+type regexParser struct {
+	re *regexp.Regexp
+}
+
+func newRegexParser(pattern string) (*regexParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return &regexParser{re: re}, nil
+		}
+	}
+	return nil, ErrNoNamedGroup
+}
+
+func (p *regexParser) parse(line string) (map[string]string, bool) {
+	match := p.re.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+	fields := make(map[string]string, len(match))
+	for i, name := range p.re.SubexpNames() {
+		if name == "" || match[i] == "" {
+			continue
+		}
+		fields[name] = match[i]
+	}
+	return fields, true
+}
+
+// 常用的 grok 模式，可以互相引用
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d+)?|\.\d+)`,
+	"BASE16NUM":         `(?:0[xX])?[0-9A-Fa-f]+`,
+	"UUID":              `[A-Fa-f0-9]{8}-(?:[A-Fa-f0-9]{4}-){3}[A-Fa-f0-9]{12}`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z-]{0,62}(?:\.[0-9A-Za-z][0-9A-Za-z-]{0,62})*\.?\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"USER":              `[a-zA-Z0-9._-]+`,
+	"PATH":              `(?:/[^\s?#]*)+`,
+	"URIPATHPARAM":      `/[^\s]*`,
+	"QS":                `"(?:[^"\\]|\\.)*"`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|fatal|severe|emerg(?:ency)?|alert|panic)`,
+	"YEAR":              `\d{4}`,
+	"MONTHNUM":          `(?:0?[1-9]|1[0-2])`,
+	"MONTHDAY":          `(?:0?[1-9]|[12]\d|3[01])`,
+	"MONTH":             `\b(?:Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec)[a-z]*\b`,
+	"HOUR":              `(?:[01]?\d|2[0-3])`,
+	"MINUTE":            `[0-5]\d`,
+	"SECOND":            `(?:[0-5]?\d|60)(?:[.,]\d+)?`,
+	"TIME":              `%{HOUR}:%{MINUTE}:%{SECOND}`,
+	"ISO8601_TIMEZONE":  `(?:Z|[+-]%{HOUR}(?::?%{MINUTE}))`,
+	"TIMESTAMP_ISO8601": `%{YEAR}-%{MONTHNUM}-%{MONTHDAY}[T ]%{HOUR}:?%{MINUTE}(?::?%{SECOND})?%{ISO8601_TIMEZONE}?`,
+	"HTTPDATE":          `%{MONTHDAY}/%{MONTH}/%{YEAR}:%{TIME} [+-]\d{4}`,
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::([\w.@-]+))?\}`)
+
+// grok 表达式 %{PATTERN:field} 展开成命名分组的正则
+func newGrokParser(pattern string) (*regexParser, error) {
+	expr, err := expandGrok(pattern, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newRegexParser(expr)
+}
+
+func expandGrok(pattern string, depth int) (string, error) {
+	if depth > 8 {
+		return "", errors.New("decoder grok pattern nested too deep")
+	}
+	var expandErr error
+	expr := grokReference.ReplaceAllStringFunc(pattern, func(s string) string {
+		m := grokReference.FindStringSubmatch(s)
+		sub, ok := grokPatterns[m[1]]
+		if !ok {
+			expandErr = fmt.Errorf("decoder grok pattern %s undefined", m[1])
+			return s
+		}
+		sub, err := expandGrok(sub, depth+1)
+		if err != nil {
+			expandErr = err
+			return s
+		}
+		if m[2] == "" {
+			return "(?:" + sub + ")"
+		}
+		// 字段名只能包含字母数字下划线
+		name := strings.NewReplacer(".", "_", "@", "", "-", "_").Replace(m[2])
+		return "(?P<" + name + ">" + sub + ")"
+	})
+	return expr, expandErr
+}
+
+// apache common/combined, nginx 默认的 combined 格式
+const accessLogPattern = `^(?P<remote_addr>\S+) (?P<ident>\S+) (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] ` +
+	`"(?P<request>(?:[^"\\]|\\.)*)" (?P<status>\d{3}) (?P<body_bytes_sent>\S+)` +
+	`(?: "(?P<http_referer>(?:[^"\\]|\\.)*)" "(?P<http_user_agent>(?:[^"\\]|\\.)*)")?`
+
+var nginxVariable = regexp.MustCompile(`\$(\w+)`)
+
+// newNginxParser 根据 nginx log_format 生成正则，变量的取值范围由后面紧跟的字符决定
+func newNginxParser(format string) (*regexParser, error) {
+	if format == "" {
+		return newRegexParser(accessLogPattern)
+	}
+	var sb strings.Builder
+	sb.WriteByte('^')
+	last := 0
+	for _, loc := range nginxVariable.FindAllStringSubmatchIndex(format, -1) {
+		sb.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		name := format[loc[2]:loc[3]]
+		last = loc[1]
+		switch {
+		case last >= len(format):
+			sb.WriteString("(?P<" + name + ">.*)")
+		case format[last] == '"':
+			sb.WriteString("(?P<" + name + `>(?:[^"\\]|\\.)*)`)
+		case format[last] == ']':
+			sb.WriteString("(?P<" + name + `>[^\]]*)`)
+		default:
+			sb.WriteString("(?P<" + name + `>\S*)`)
+		}
+	}
+	sb.WriteString(regexp.QuoteMeta(format[last:]))
+	return newRegexParser(sb.String())
+}
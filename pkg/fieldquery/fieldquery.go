@@ -0,0 +1,163 @@
+package fieldquery
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// 结构化详情的字段存储与查询
+// 模块开启结构化存储后，详情为 JSON 对象时按字段存储在日志的 fd 字段
+// 字段条件不能使用索引，查询前需要由调用方限制扫描的数量
+
+const (
+	// FieldPrefix 日志中存储结构化详情的字段
+	FieldPrefix = "fd"
+
+	OpEq     = "eq"
+	OpNe     = "ne"
+	OpGt     = "gt"
+	OpGte    = "gte"
+	OpLt     = "lt"
+	OpLte    = "lte"
+	OpExists = "exists"
+	OpIn     = "in"
+
+	// in 最多的值数量
+	maxInValues = 50
+)
+
+var (
+	ErrInvalidKey   = errors.New("fieldquery invalid key")
+	ErrInvalidValue = errors.New("fieldquery invalid value")
+
+	keyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+)
+
+// Predicate Value 为 JSON 解析后的值，exists 时为 bool，in 时为数组
+type Predicate struct {
+	Key   string
+	Op    string
+	Value interface{}
+}
+
+// Build 每个条件生成一个子条件，由调用方放在 $and 中
+// 数字与字符串形式的数字在 eq ne in 时都能匹配，范围比较只比较相同类型
+func Build(preds []Predicate) ([]bson.M, error) {
+	out := make([]bson.M, 0, len(preds))
+	for _, p := range preds {
+		if !keyRegexp.MatchString(p.Key) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidKey, p.Key)
+		}
+		cond, err := condition(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %s", err, p.Key, p.Op)
+		}
+		out = append(out, bson.M{FieldPrefix + "." + p.Key: cond})
+	}
+	return out, nil
+}
+
+func condition(p Predicate) (interface{}, error) {
+	switch p.Op {
+	case OpEq, OpNe:
+		if !scalar(p.Value) {
+			return nil, ErrInvalidValue
+		}
+		if p.Op == OpEq {
+			return bson.M{"$in": equalValues(p.Value)}, nil
+		}
+		return bson.M{"$nin": equalValues(p.Value)}, nil
+	case OpGt, OpGte, OpLt, OpLte:
+		switch p.Value.(type) {
+		case float64, string:
+		default:
+			return nil, ErrInvalidValue
+		}
+		return bson.M{"$" + p.Op: p.Value}, nil
+	case OpExists:
+		exists := true
+		if p.Value != nil {
+			v, ok := p.Value.(bool)
+			if !ok {
+				return nil, ErrInvalidValue
+			}
+			exists = v
+		}
+		return bson.M{"$exists": exists}, nil
+	case OpIn:
+		values, ok := p.Value.([]interface{})
+		if !ok || len(values) == 0 || len(values) > maxInValues {
+			return nil, ErrInvalidValue
+		}
+		in := make([]interface{}, 0, len(values)*2)
+		for _, v := range values {
+			if !scalar(v) {
+				return nil, ErrInvalidValue
+			}
+			in = append(in, equalValues(v)...)
+		}
+		return bson.M{"$in": in}, nil
+	}
+	return nil, errors.New("fieldquery unsupported op")
+}
+
+func scalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, bool, float64, string:
+		return true
+	}
+	return false
+}
+
+// equalValues 文本解析的日志字段都是字符串，数字同时匹配字符串形式
+func equalValues(v interface{}) []interface{} {
+	switch val := v.(type) {
+	case float64:
+		return []interface{}{val, strconv.FormatFloat(val, 'f', -1, 64)}
+	case string:
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return []interface{}{val, f}
+		}
+	}
+	return []interface{}{v}
+}
+
+// Structure 详情为 JSON 对象时返回字段，字段名不能作为查询路径时返回 false，保持原文存储
+func Structure(full string, unmarshal func(data []byte, v interface{}) error) (bson.M, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(full), "{") {
+		return nil, false
+	}
+	fields := bson.M{}
+	if err := unmarshal([]byte(full), &fields); err != nil || len(fields) == 0 {
+		return nil, false
+	}
+	if !validKeys(fields) {
+		return nil, false
+	}
+	return fields, true
+}
+
+func validKeys(v interface{}) bool {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if k == "" || strings.HasPrefix(k, "$") || strings.Contains(k, ".") || !validKeys(child) {
+				return false
+			}
+		}
+	case bson.M:
+		return validKeys(map[string]interface{}(val))
+	case []interface{}:
+		for _, child := range val {
+			if !validKeys(child) {
+				return false
+			}
+		}
+	}
+	return true
+}
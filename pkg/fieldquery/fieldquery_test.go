@@ -0,0 +1,62 @@
+package fieldquery
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBuild(t *testing.T) {
+	got, err := Build([]Predicate{
+		{Key: "status", Op: OpEq, Value: float64(500)},
+		{Key: "req.latency", Op: OpGte, Value: 2.5},
+		{Key: "user", Op: OpExists, Value: nil},
+		{Key: "method", Op: OpIn, Value: []interface{}{"GET", "POST"}},
+		{Key: "code", Op: OpNe, Value: "404"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bson.M{
+		{"fd.status": bson.M{"$in": []interface{}{float64(500), "500"}}},
+		{"fd.req.latency": bson.M{"$gte": 2.5}},
+		{"fd.user": bson.M{"$exists": true}},
+		{"fd.method": bson.M{"$in": []interface{}{"GET", "POST"}}},
+		{"fd.code": bson.M{"$nin": []interface{}{"404", float64(404)}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+
+	invalid := []Predicate{
+		{Key: "$where", Op: OpEq, Value: "1"},
+		{Key: "a..b", Op: OpEq, Value: "1"},
+		{Key: "a", Op: OpGt, Value: true},
+		{Key: "a", Op: OpIn, Value: "x"},
+		{Key: "a", Op: OpEq, Value: map[string]interface{}{"$gt": 1}},
+		{Key: "a", Op: "regex", Value: "x"},
+	}
+	for _, p := range invalid {
+		if _, err := Build([]Predicate{p}); err == nil {
+			t.Fatal("expected error", p)
+		}
+	}
+	if _, err := Build([]Predicate{invalid[0]}); !errors.Is(err, ErrInvalidKey) {
+		t.Fatal(err)
+	}
+}
+
+func TestStructure(t *testing.T) {
+	fields, ok := Structure(`{"status":500,"req":{"path":"/"}}`, json.Unmarshal)
+	if !ok || fields["status"] != float64(500) {
+		t.Fatal(fields, ok)
+	}
+	for _, v := range []string{`not json`, `{}`, `{"a.b":1}`, `{"a":{"$x":1}}`, `{"a":[{"b.c":1}]}`} {
+		if _, ok := Structure(v, json.Unmarshal); ok {
+			t.Fatal("expected raw", v)
+		}
+	}
+}
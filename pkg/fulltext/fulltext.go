@@ -0,0 +1,234 @@
+package fulltext
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 全文搜索的分词与结果处理
+// 写入时对短消息与详情分词，存储在日志的 tk 字段，查询时所有关键词的分词都需命中，再按原文校验、打分、高亮
+// 英文数字按单词切分，中日韩文字生成单字与相邻两字，查询时两个字以上的词使用相邻两字，保证分词一致
+
+const (
+	// MaxTokens 单条日志最多保存的分词数，超出部分不能被搜索到
+	MaxTokens = 256
+	// 单词超出长度截断
+	maxTokenLen = 32
+
+	shortWeight = 2
+	fullWeight  = 1
+)
+
+// Tokenize 按出现顺序去重
+func Tokenize(texts ...string) []string {
+	seen := make(map[string]struct{})
+	out := make([]string, 0)
+	add := func(token string) bool {
+		if _, ok := seen[token]; ok {
+			return true
+		}
+		if len(out) >= MaxTokens {
+			return false
+		}
+		seen[token] = struct{}{}
+		out = append(out, token)
+		return true
+	}
+	for _, text := range texts {
+		if !eachToken(text, true, add) {
+			break
+		}
+	}
+	return out
+}
+
+// eachToken index 为 true 时中日韩文字同时生成单字，fn 返回 false 停止
+func eachToken(text string, index bool, fn func(token string) bool) bool {
+	runes := []rune(strings.ToLower(text))
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isCJK(r):
+			j := i
+			for j < len(runes) && isCJK(runes[j]) {
+				j++
+			}
+			run := runes[i:j]
+			if len(run) == 1 || index {
+				for _, v := range run {
+					if !fn(string(v)) {
+						return false
+					}
+				}
+			}
+			for k := 0; k+1 < len(run); k++ {
+				if !fn(string(run[k : k+2])) {
+					return false
+				}
+			}
+			i = j
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && !isCJK(runes[j]) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			word := runes[i:j]
+			if len(word) > maxTokenLen {
+				word = word[:maxTokenLen]
+			}
+			if len(word) >= 2 {
+				if !fn(string(word)) {
+					return false
+				}
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	return true
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// Query 空格分隔的关键词，双引号内为短语，都需要命中
+type Query struct {
+	Terms []string
+}
+
+func ParseQuery(q string) Query {
+	query := Query{}
+	for len(q) > 0 {
+		q = strings.TrimLeftFunc(q, unicode.IsSpace)
+		if q == "" {
+			break
+		}
+		var term string
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			if end < 0 {
+				term, q = q[1:], ""
+			} else {
+				term, q = q[1:end+1], q[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(q, unicode.IsSpace)
+			if end < 0 {
+				end = len(q)
+			}
+			term, q = q[:end], q[end:]
+		}
+		if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+			query.Terms = append(query.Terms, term)
+		}
+	}
+	return query
+}
+
+func (q Query) Empty() bool {
+	return len(q.Terms) == 0
+}
+
+// Tokens 查询条件中需要全部命中的分词，为空表示关键词中没有可索引的内容
+func (q Query) Tokens() []string {
+	seen := make(map[string]struct{})
+	out := make([]string, 0)
+	for _, term := range q.Terms {
+		eachToken(term, false, func(token string) bool {
+			if _, ok := seen[token]; !ok {
+				seen[token] = struct{}{}
+				out = append(out, token)
+			}
+			return true
+		})
+	}
+	return out
+}
+
+// Score 不区分大小写，每个关键词都需出现在短消息或详情中，未命中返回 0
+// 分数为各关键词出现次数之和，短消息权重更高
+func (q Query) Score(short, full string) int {
+	if q.Empty() {
+		return 0
+	}
+	s, f := lowerRunes(short), lowerRunes(full)
+	score := 0
+	for _, term := range q.Terms {
+		needle := []rune(term)
+		n := shortWeight*len(indexAll(s, needle)) + fullWeight*len(indexAll(f, needle))
+		if n == 0 {
+			return 0
+		}
+		score += n
+	}
+	return score
+}
+
+// Span 命中位置，按字符(rune)计算，End 不包含
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Highlight 返回所有关键词在 text 中的位置，重叠的位置合并
+func (q Query) Highlight(text string) []Span {
+	runes := lowerRunes(text)
+	spans := make([]Span, 0)
+	for _, term := range q.Terms {
+		needle := []rune(term)
+		for _, i := range indexAll(runes, needle) {
+			spans = append(spans, Span{Start: i, End: i + len(needle)})
+		}
+	}
+	if len(spans) == 0 {
+		return spans
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start
+	})
+	out := spans[:1]
+	for _, v := range spans[1:] {
+		last := &out[len(out)-1]
+		if v.Start <= last.End {
+			if v.End > last.End {
+				last.End = v.End
+			}
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// lowerRunes 逐个字符转小写，保证位置与原文一致
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func indexAll(s, needle []rune) []int {
+	out := make([]int, 0)
+	if len(needle) == 0 {
+		return out
+	}
+	for i := 0; i+len(needle) <= len(s); i++ {
+		match := true
+		for j := range needle {
+			if s[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, i)
+		}
+	}
+	return out
+}
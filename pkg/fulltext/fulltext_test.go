@@ -0,0 +1,47 @@
+package fulltext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Connect DB timeout", "db 连接超时, a x retry=3 connect")
+	want := []string{"connect", "db", "timeout", "连", "接", "超", "时", "连接", "接超", "超时", "retry"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	q := ParseQuery(`  Timeout "connect db"  连接超时 `)
+	if !reflect.DeepEqual(q.Terms, []string{"timeout", "connect db", "连接超时"}) {
+		t.Fatal(q.Terms)
+	}
+	if !reflect.DeepEqual(q.Tokens(), []string{"timeout", "connect", "db", "连接", "接超", "超时"}) {
+		t.Fatal(q.Tokens())
+	}
+	short, full := "Connect DB timeout", "连接超时 timeout after 3s"
+	// timeout 短消息 2 + 详情 1，connect db 短消息 2，连接超时 详情 1
+	if s := q.Score(short, full); s != 6 {
+		t.Fatal(s)
+	}
+	if s := q.Score("connect db", "连接超时"); s != 0 {
+		t.Fatal(s)
+	}
+	if s := ParseQuery(`"connect`).Score(short, ""); s != 2 {
+		t.Fatal(s)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	q := ParseQuery(`db "connect db" 超时`)
+	got := q.Highlight("Connect DB 超时 db")
+	want := []Span{{0, 10}, {11, 13}, {14, 16}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+	if got := q.Highlight("none"); len(got) != 0 {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+const (
+	// 时间分桶的最大数量
+	maxAggregateBuckets = 1440
+	// 单个集合聚合结果的最大行数
+	maxAggregateRows = 10000
+)
+
+var aggregateIntervals = map[string]int64{
+	"1m": 60,
+	"5m": 300,
+	"1h": 3600,
+}
+
+// 分组字段与存储字段名
+var aggregateFields = map[string]string{
+	"level":          "l",
+	"short":          "s",
+	"ip":             "ip",
+	"conditionOne":   "c1",
+	"conditionTwo":   "c2",
+	"conditionThree": "c3",
+	"pattern":        "pi",
+}
+
+// AggregateLogging 每个集合按 (时间分桶, 分组) 聚合后合并
+// 关键词只按分词统计，不按原文校验短语
+func (srv *Service) AggregateLogging(ctx context.Context, in *entity.AggregateLoggingReq, out *entity.AggregateLoggingResp) error {
+	defer observeQuery("logging_aggregate", time.Now())
+	if in.Interval == "" && len(in.GroupBy) == 0 {
+		return httputil.ErrArgsInvalid.MergeString("[时间间隔]与[分组字段]至少需要一个")
+	}
+	q, err := newLoggingSearch(&in.FindLoggingListReq)
+	if err != nil {
+		return err
+	}
+	var buckets []int64
+	interval := aggregateIntervals[in.Interval]
+	if interval > 0 {
+		buckets = types.AggregateBuckets(q.begin.Unix(), q.end.Unix(), interval)
+		if len(buckets) > maxAggregateBuckets {
+			return httputil.ErrArgsInvalid.MergeString(fmt.Sprintf("时间分桶超过 %d 个，请缩小时间范围或增大时间间隔", maxAggregateBuckets))
+		}
+	}
+
+	filter, _, err := q.compile()
+	if err != nil {
+		return err
+	}
+	fieldConds, err := q.fieldConds()
+	if err != nil {
+		return err
+	}
+	targets, err := srv.loggingTargets(ctx, q)
+	if err != nil {
+		return err
+	}
+	if len(fieldConds) > 0 {
+		if err := guardUnindexedScan(ctx, targets, filter); err != nil {
+			return err
+		}
+		filter["$and"] = fieldConds
+	}
+
+	id := bson.M{}
+	if interval > 0 {
+		id["t"] = bson.M{"$subtract": bson.A{"$ts", bson.M{"$mod": bson.A{"$ts", interval}}}}
+	}
+	for i, name := range in.GroupBy {
+		id["k"+strconv.Itoa(i)] = "$" + aggregateFields[name]
+	}
+	pipeline := []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{"_id": id, "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.M{"count": -1}},
+		{"$limit": maxAggregateRows},
+	}
+
+	type group struct {
+		ID    bson.M `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	rows := make([]types.AggregateRow, 0)
+	for _, t := range targets {
+		groups := make([]group, 0)
+		if err := t.store.AggregateLogging(ctx, t.name, pipeline, &groups); err != nil {
+			return httputil.ErrSystemException.MergeError(err)
+		}
+		if len(groups) >= maxAggregateRows {
+			out.Truncated = true
+		}
+		for _, g := range groups {
+			row := types.AggregateRow{Count: g.Count, Key: make([]interface{}, len(in.GroupBy))}
+			if ts, ok := g.ID["t"]; ok {
+				row.TsSec = toInt64(ts)
+			}
+			for i := range in.GroupBy {
+				row.Key[i] = g.ID["k"+strconv.Itoa(i)]
+			}
+			rows = append(rows, row)
+			out.Total += g.Count
+		}
+	}
+
+	topN := in.TopN
+	if topN <= 0 {
+		topN = 10
+	}
+	out.BucketsTsSec = buckets
+	out.Groups = make([]*entity.LoggingAggregateGroup, 0)
+	for _, g := range types.MergeAggregate(rows, buckets, topN) {
+		v := &entity.LoggingAggregateGroup{Count: g.Count, Series: g.Series}
+		if len(in.GroupBy) > 0 {
+			v.Key = make(map[string]interface{}, len(in.GroupBy))
+			for i, name := range in.GroupBy {
+				v.Key[name] = g.Key[i]
+			}
+		}
+		out.Groups = append(out.Groups, v)
+	}
+	return nil
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int64:
+		return n
+	case int32:
+		return int64(n)
+	case float64:
+		return int64(n)
+	}
+	return 0
+}
@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/receiver/alarm"
+)
+
+func mergeAlarmRule(t *testing.T, doc *model.AlarmRule, body string) map[string]interface{} {
+	in := &entity.UpdateAlarmRuleReq{}
+	bindPut(t, body, in)
+	rule := *doc
+	rule.Enable = in.Enable
+	setAlarmRule(&rule, &in.CreateAlarmRuleReq)
+	if err := checkAlarmRule(&rule); err != nil {
+		t.Fatal(err)
+	}
+	return alarmRuleUpdate(doc, &rule)
+}
+
+// 旧版本页面不传入类型与窗口，窗口规则保持不变
+func TestAlarmRuleUpdateKeepsWindow(t *testing.T) {
+	doc := &model.AlarmRule{
+		Enable:     true,
+		ModuleName: "order",
+		Short:      "timeout",
+		Level:      model.Level(2),
+		Type:       model.AlarmRuleTypeCount,
+		WindowSec:  300,
+		Threshold:  10,
+		EvalSec:    30,
+		RateSec:    60,
+		Method:     model.MethodDingDing,
+		HookID:     "5f7c2a9b1c9d440000a1b2c4",
+	}
+	fields := mergeAlarmRule(t, doc, `{"id":"5f7c2a9b1c9d440000a1b2c3","enable":true,"moduleName":"order","short":"timeout","level":2,"rateSec":120,"method":1,"hookId":"5f7c2a9b1c9d440000a1b2c4"}`)
+	if fields["rate_sec"] != int64(120) {
+		t.Fatal(fields)
+	}
+	for _, k := range []string{"type", "window_sec", "threshold", "eval_sec"} {
+		if _, ok := fields[k]; ok {
+			t.Fatalf("%s should be kept: %v", k, fields)
+		}
+	}
+
+	fields = mergeAlarmRule(t, doc, `{"id":"5f7c2a9b1c9d440000a1b2c3","enable":true,"moduleName":"order","short":"timeout","level":2,"rateSec":60,"method":1,"hookId":"5f7c2a9b1c9d440000a1b2c4","evalSec":0,"threshold":20}`)
+	if fields["eval_sec"] != int64(0) || fields["threshold"] != float64(20) || len(fields) != 2 {
+		t.Fatal(fields)
+	}
+}
+
+// 旧版本页面不传入匹配方式、详情、IP 与条件，匹配条件保持不变
+func TestAlarmRuleUpdateKeepsMatch(t *testing.T) {
+	doc := &model.AlarmRule{
+		Enable:       true,
+		ModuleName:   "order",
+		Short:        "timeout",
+		ShortMatch:   model.MatchPrefix,
+		Full:         "db",
+		FullMatch:    model.MatchContains,
+		Level:        model.Level(2),
+		LevelOp:      model.LevelOpGte,
+		IP:           "10.0.0.1",
+		ConditionOne: "pay",
+		Method:       model.MethodDingDing,
+		HookID:       "5f7c2a9b1c9d440000a1b2c4",
+	}
+	fields := mergeAlarmRule(t, doc, `{"id":"5f7c2a9b1c9d440000a1b2c3","enable":true,"moduleName":"order","short":"timeout","level":2,"method":1,"hookId":"5f7c2a9b1c9d440000a1b2c4"}`)
+	if len(fields) != 0 {
+		t.Fatal(fields)
+	}
+
+	fields = mergeAlarmRule(t, doc, `{"id":"5f7c2a9b1c9d440000a1b2c3","enable":true,"moduleName":"order","short":"timeout","level":2,"method":1,"hookId":"5f7c2a9b1c9d440000a1b2c4","shortMatch":"","ip":""}`)
+	if fields["short_match"] != "" || fields["ip"] != "" || len(fields) != 2 {
+		t.Fatal(fields)
+	}
+}
+
+// 关联保存的查询时，查询能返回的日志规则也能匹配
+func TestAlarmSearchFilterMatch(t *testing.T) {
+	tests := []struct {
+		filter model.SearchFilter
+		doc    model.Logging
+		want   bool
+	}{
+		// 不限制等级
+		{model.SearchFilter{ModuleName: "order", Level: -2}, model.Logging{Module: "order", Short: "x", Level: 3}, true},
+		{model.SearchFilter{ModuleName: "order", Level: -2}, model.Logging{Module: "order", Short: "x", Level: -1}, true},
+		// 短消息不区分大小写的正则
+		{model.SearchFilter{ModuleName: "order", Level: 2, Short: "timeout"}, model.Logging{Module: "order", Short: "db Timeout after 3s", Level: 2}, true},
+		{model.SearchFilter{ModuleName: "order", Level: 2, Short: "^pay"}, model.Logging{Module: "order", Short: "db pay", Level: 2}, false},
+		{model.SearchFilter{ModuleName: "order", Level: 2, Short: "timeout"}, model.Logging{Module: "order", Short: "timeout", Level: 3}, false},
+		// 前一个条件为空时后面的条件不生效
+		{model.SearchFilter{ModuleName: "order", Level: 2, ConditionTwo: "pay"}, model.Logging{Module: "order", Short: "x", Level: 2, Condition2: "refund"}, true},
+		{model.SearchFilter{ModuleName: "order", Level: 2, ConditionOne: "a", ConditionTwo: "pay"}, model.Logging{Module: "order", Short: "x", Level: 2, Condition1: "a", Condition2: "refund"}, false},
+	}
+	for i, tt := range tests {
+		in := &entity.CreateAlarmRuleReq{}
+		setAlarmSearchFilter(in, &tt.filter)
+		rule := &model.AlarmRule{ModuleName: in.ModuleName}
+		setAlarmRule(rule, in)
+		if err := checkAlarmRule(rule); err != nil {
+			t.Fatal(i, err)
+		}
+		got, err := alarm.Match(rule, &tt.doc)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if got != tt.want {
+			t.Errorf("%d: got %v want %v", i, got, tt.want)
+		}
+	}
+}
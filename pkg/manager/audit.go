@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.uber.org/zap"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+// 审计记录不能因为请求取消而丢失
+const auditTimeout = 5 * time.Second
+
+func (srv *Service) InsertAuditLog(doc *model.AuditLog) {
+	ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+	doc.CreatedAt = time.Now()
+	if err := srv.store.InsertAuditLog(ctx, doc); err != nil {
+		logs.Qezap.Error("审计记录写入失败", zap.String("action", doc.Action), zap.String("params", doc.Params), zap.Error(err))
+	}
+}
+
+func (srv *Service) FindAuditLogList(ctx context.Context, in *entity.FindAuditLogListReq, out *entity.ListResp) error {
+	filter := bson.M{}
+	if in.Action != "" {
+		filter["action"] = in.Action
+	}
+
+	opt := options.Find()
+	in.SetPage(opt)
+	opt.SetSort(bson.M{"created_at": -1})
+	docs := make([]*model.AuditLog, 0, in.Limit)
+	c, err := srv.store.FindAuditLogList(ctx, filter, &docs, opt)
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+
+	out.Count = c
+	list := make([]*entity.FindAuditLogList, 0, len(docs))
+	for _, v := range docs {
+		list = append(list, &entity.FindAuditLogList{
+			ID:           v.ID.Hex(),
+			Action:       v.Action,
+			Operator:     v.Operator,
+			ClientIP:     v.ClientIP,
+			Params:       v.Params,
+			Rows:         v.Rows,
+			Error:        v.Error,
+			CostMill:     v.CostMill,
+			CreatedTsSec: v.CreatedAt.Unix(),
+		})
+	}
+	out.List = list
+	return nil
+}
@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"context"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/fulltext"
+	"github.com/huzhongqing/qelog/pkg/manager/export"
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// LoggingExport 校验通过的导出任务，参数错误在写入响应之前返回
+type LoggingExport struct {
+	Format  string
+	Gzip    bool
+	columns []string
+	maxRows int64
+	targets []loggingTarget
+	filter  bson.M
+	query   fulltext.Query
+}
+
+func (srv *Service) NewLoggingExport(ctx context.Context, in *entity.ExportLoggingReq) (*LoggingExport, error) {
+	columns, err := export.CheckColumns(in.Columns)
+	if err != nil {
+		return nil, httputil.ErrArgsInvalid.MergeError(err)
+	}
+	q, err := newLoggingSearch(&in.FindLoggingListReq)
+	if err != nil {
+		return nil, err
+	}
+	filter, query, err := q.compile()
+	if err != nil {
+		return nil, err
+	}
+	fieldConds, err := q.fieldConds()
+	if err != nil {
+		return nil, err
+	}
+	targets, err := srv.loggingTargets(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(fieldConds) > 0 {
+		if err := guardUnindexedScan(ctx, targets, filter); err != nil {
+			return nil, err
+		}
+		filter["$and"] = fieldConds
+	}
+
+	maxRows := config.Global.Export.MaxRows
+	if in.MaxRows > 0 && (maxRows <= 0 || in.MaxRows < maxRows) {
+		maxRows = in.MaxRows
+	}
+	return &LoggingExport{
+		Format:  in.Format,
+		Gzip:    in.Gzip,
+		columns: columns,
+		maxRows: maxRows,
+		targets: targets,
+		filter:  filter,
+		query:   query,
+	}, nil
+}
+
+// Run 按时间倒序合并所有集合的结果逐条写入 w，返回写入的条数
+// 开始写入后出错只能中断输出，错误由调用方记录
+func (exp *LoggingExport) Run(ctx context.Context, w io.Writer) (int64, error) {
+	out, err := export.NewWriter(w, exp.Format, exp.columns, exp.Gzip)
+	if err != nil {
+		return 0, err
+	}
+
+	opt := options.Find().SetSort(bson.M{"ts": -1}).SetProjection(bson.M{"tk": 0})
+	if size := config.Global.Export.BatchSize; size > 0 {
+		opt.SetBatchSize(size)
+	}
+	iters := make([]*storage.LoggingIter, 0, len(exp.targets))
+	defer func() {
+		for _, it := range iters {
+			it.Close(context.Background())
+		}
+	}()
+	heads := make([]*model.Logging, 0, len(exp.targets))
+	for _, t := range exp.targets {
+		it, err := t.store.IterLogging(ctx, t.name, exp.filter, opt)
+		if err != nil {
+			return 0, err
+		}
+		iters = append(iters, it)
+		doc, err := it.Next(ctx)
+		if err != nil {
+			return 0, err
+		}
+		heads = append(heads, doc)
+	}
+
+	var (
+		rows   int64
+		lastTs int64
+		// 同一秒内去除重复写入的日志
+		seen   = map[string]struct{}{}
+		values = make([]interface{}, len(exp.columns))
+	)
+	for exp.maxRows <= 0 || rows < exp.maxRows {
+		i := -1
+		for j, doc := range heads {
+			if doc != nil && (i < 0 || doc.TimeSec > heads[i].TimeSec) {
+				i = j
+			}
+		}
+		if i < 0 {
+			break
+		}
+		doc := heads[i]
+		if heads[i], err = iters[i].Next(ctx); err != nil {
+			return rows, err
+		}
+
+		if doc.TimeSec != lastTs {
+			lastTs = doc.TimeSec
+			seen = map[string]struct{}{}
+		}
+		if _, ok := seen[doc.MessageID]; ok {
+			continue
+		}
+		seen[doc.MessageID] = struct{}{}
+		full := doc.FullString()
+		if !exp.query.Empty() && exp.query.Score(doc.Short, full) == 0 {
+			continue
+		}
+
+		for k, c := range exp.columns {
+			values[k] = exportValue(doc, full, c)
+		}
+		if err := out.Write(values); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+	return rows, out.Close()
+}
+
+func exportValue(v *model.Logging, full, column string) interface{} {
+	switch column {
+	case "id":
+		return v.ID.Hex()
+	case "tsMill":
+		return v.TimeMill
+	case "level":
+		return v.Level.Int32()
+	case "short":
+		return v.Short
+	case "full":
+		return full
+	case "conditionOne":
+		return v.Condition1
+	case "conditionTwo":
+		return v.Condition2
+	case "conditionThree":
+		return v.Condition3
+	case "traceId":
+		return v.TraceID
+	case "ip":
+		return v.IP
+	}
+	return ""
+}
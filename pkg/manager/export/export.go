@@ -0,0 +1,158 @@
+package export
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// 日志导出，逐条写入，不在内存中缓存结果
+// ndjson 每行一个 JSON 对象，字段按选择的列顺序输出
+// csv 第一行为列名
+
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+var (
+	ErrUnknownFormat = errors.New("export unknown format")
+	ErrUnknownColumn = errors.New("export unknown column")
+)
+
+// Columns 支持导出的列，与日志列表的字段名一致，也是默认导出的列
+var Columns = []string{
+	"id", "tsMill", "level", "short", "full",
+	"conditionOne", "conditionTwo", "conditionThree", "traceId", "ip",
+}
+
+// Writer values 与列一一对应
+type Writer interface {
+	Write(values []interface{}) error
+	// Close 写入缓存的内容，不关闭下层的 io.Writer
+	Close() error
+}
+
+// ContentType 下载文件的类型
+func ContentType(format string, gz bool) string {
+	if gz {
+		return "application/gzip"
+	}
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// FileExt 下载文件的扩展名
+func FileExt(format string, gz bool) string {
+	if gz {
+		return "." + format + ".gz"
+	}
+	return "." + format
+}
+
+// CheckColumns 为空时返回所有列
+func CheckColumns(columns []string) ([]string, error) {
+	if len(columns) == 0 {
+		return Columns, nil
+	}
+	for _, c := range columns {
+		ok := false
+		for _, v := range Columns {
+			ok = ok || v == c
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownColumn, c)
+		}
+	}
+	return columns, nil
+}
+
+// NewWriter gz 为 true 时压缩输出
+func NewWriter(w io.Writer, format string, columns []string, gz bool) (Writer, error) {
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(w)
+		w = zw
+	}
+	var out Writer
+	switch format {
+	case FormatNDJSON:
+		out = &ndjsonWriter{w: w, columns: columns}
+	case FormatCSV:
+		cw := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+		if err := cw.w.Write(columns); err != nil {
+			return nil, err
+		}
+		out = cw
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	if zw != nil {
+		out = &gzipWriter{Writer: out, zw: zw}
+	}
+	return out, nil
+}
+
+type ndjsonWriter struct {
+	w       io.Writer
+	columns []string
+	buf     []byte
+}
+
+func (n *ndjsonWriter) Write(values []interface{}) error {
+	n.buf = append(n.buf[:0], '{')
+	for i, c := range n.columns {
+		if i > 0 {
+			n.buf = append(n.buf, ',')
+		}
+		n.buf = strconv.AppendQuote(n.buf, c)
+		n.buf = append(n.buf, ':')
+		b, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		n.buf = append(n.buf, b...)
+	}
+	n.buf = append(n.buf, '}', '\n')
+	_, err := n.w.Write(n.buf)
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func (c *csvWriter) Write(values []interface{}) error {
+	for i, v := range values {
+		c.record[i] = fmt.Sprint(v)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type gzipWriter struct {
+	Writer
+	zw *gzip.Writer
+}
+
+func (g *gzipWriter) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		return err
+	}
+	return g.zw.Close()
+}
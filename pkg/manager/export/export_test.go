@@ -0,0 +1,59 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNDJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, FormatNDJSON, []string{"level", "short"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Write([]interface{}{int32(2), `say "hi"`})
+	_ = w.Write([]interface{}{int32(0), "中文"})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\"level\":2,\"short\":\"say \\\"hi\\\"\"}\n{\"level\":0,\"short\":\"中文\"}\n"
+	if buf.String() != want {
+		t.Fatal(buf.String())
+	}
+}
+
+func TestCSVGzip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, FormatCSV, []string{"tsMill", "full"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = w.Write([]interface{}{int64(1600000000000), "a,b\nc"})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(zr)
+	want := "tsMill,full\n1600000000000,\"a,b\nc\"\n"
+	if string(b) != want {
+		t.Fatal(string(b))
+	}
+}
+
+func TestCheckColumns(t *testing.T) {
+	if c, err := CheckColumns(nil); err != nil || len(c) != len(Columns) {
+		t.Fatal(c, err)
+	}
+	if _, err := CheckColumns([]string{"short", "f"}); !errors.Is(err, ErrUnknownColumn) {
+		t.Fatal(err)
+	}
+	if _, err := NewWriter(&bytes.Buffer{}, "xml", Columns, false); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatal(err)
+	}
+}
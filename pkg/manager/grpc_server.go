@@ -0,0 +1,138 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/infra/jwt"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/manager/tail"
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// GRPCService 目前只提供实时日志订阅，认证与后台接口相同，token 放在 metadata 的 x-authorization
+type GRPCService struct {
+	server *grpc.Server
+	srv    *Service
+}
+
+func NewGRPCService() *GRPCService {
+	return &GRPCService{srv: NewService(storage.ShardingDB)}
+}
+
+func (g *GRPCService) Run(addr string) error {
+	listen, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	g.server = grpc.NewServer(
+		grpc.CustomCodec(tail.Codec{}),
+		grpc.StreamInterceptor(authStreamInterceptor(config.Global.AuthEnable)),
+	)
+	tail.RegisterTailServer(g.server, g)
+	return g.server.Serve(listen)
+}
+
+// Close 订阅为长连接，直接断开
+func (g *GRPCService) Close() error {
+	if g.server != nil {
+		g.server.Stop()
+	}
+	return nil
+}
+
+func (g *GRPCService) Subscribe(in *tail.SubscribeRequest, stream tail.SubscribeServer) error {
+	req := &entity.TailLoggingReq{
+		ShardingIndex: int(in.ShardingIndex),
+		ModuleName:    in.ModuleName,
+		Level:         in.Level,
+		Short:         in.Short,
+		IP:            in.IP,
+		Rate:          int(in.Rate),
+	}
+	if req.ModuleName == "" || req.ShardingIndex <= 0 || req.Rate < 0 ||
+		(req.Level != nil && (*req.Level < -1 || *req.Level > 5)) {
+		return status.Error(codes.InvalidArgument, "shardingIndex and moduleName required, level must be -1 to 5")
+	}
+	s, err := g.srv.TailLogging(req)
+	if err != nil {
+		return statusFromError(err)
+	}
+	defer g.srv.StopTailLogging(s)
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.Done():
+			if err := s.Err(); err != nil {
+				return status.Error(codes.Unavailable, err.Error())
+			}
+			return nil
+		case v := <-s.C():
+			e := tailLoggingEntity(v)
+			if err := stream.Send(&tail.LogEntry{
+				ID:             e.ID,
+				TsMill:         e.TsMill,
+				Level:          e.Level,
+				Short:          e.Short,
+				Full:           e.Full,
+				ConditionOne:   e.ConditionOne,
+				ConditionTwo:   e.ConditionTwo,
+				ConditionThree: e.ConditionThree,
+				TraceID:        e.TraceID,
+				IP:             e.IP,
+				Dropped:        s.Dropped(),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func statusFromError(err error) error {
+	e, ok := err.(httputil.Error)
+	if !ok {
+		return status.Error(codes.Internal, err.Error())
+	}
+	switch e.Code {
+	case httputil.ErrCodeArgsInvalid:
+		return status.Error(codes.InvalidArgument, e.Message)
+	case httputil.ErrCodeThrottled:
+		return status.Error(codes.ResourceExhausted, e.Message)
+	}
+	return status.Error(codes.Internal, e.Message)
+}
+
+func authStreamInterceptor(enable bool) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if enable {
+			if err := verifyToken(ss.Context()); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+func verifyToken(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(strings.ToLower(httputil.Authorization))
+	if len(values) == 0 || values[0] == "" {
+		return status.Error(codes.Unauthenticated, httputil.Authorization+" metadata required")
+	}
+	ok, err := jwt.VerifyJWTToken(values[0])
+	if err != nil || !ok {
+		return status.Error(codes.Unauthenticated, "token verify failed")
+	}
+	return nil
+}
@@ -1,9 +1,13 @@
 package manager
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/manager/export"
 	"github.com/huzhongqing/qelog/pkg/storage"
 
 	"github.com/gin-gonic/gin"
@@ -88,6 +92,19 @@ func (h *Handler) UpdateModule(c *gin.Context) {
 	httputil.RespSuccess(c)
 }
 
+func (h *Handler) ApproveModule(c *gin.Context) {
+	in := &entity.ApproveModuleReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := h.srv.ApproveModule(c.Request.Context(), in); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespSuccess(c)
+}
+
 func (h *Handler) DeleteModule(c *gin.Context) {
 	in := &entity.DeleteModuleReq{}
 	if err := c.ShouldBind(in); err != nil {
@@ -116,6 +133,113 @@ func (h *Handler) FindLoggingList(c *gin.Context) {
 	httputil.RespData(c, http.StatusOK, out)
 }
 
+func (h *Handler) QueryLogging(c *gin.Context) {
+	in := &entity.QueryLoggingReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.ListResp{}
+	if err := h.srv.QueryLogging(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+func (h *Handler) AggregateLogging(c *gin.Context) {
+	in := &entity.AggregateLoggingReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.AggregateLoggingResp{}
+	if err := h.srv.AggregateLogging(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+// ExportLogging 以附件下载导出日志，每次导出都写入审计记录
+func (h *Handler) ExportLogging(c *gin.Context) {
+	in := &entity.ExportLoggingReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	params, _ := json.Marshal(in)
+	audit := &model.AuditLog{
+		Action:   model.AuditActionExportLogging,
+		Operator: auditOperator(c),
+		ClientIP: c.ClientIP(),
+		Params:   string(params),
+	}
+	s := time.Now()
+	defer func() {
+		audit.CostMill = time.Since(s).Milliseconds()
+		h.srv.InsertAuditLog(audit)
+	}()
+
+	exp, err := h.srv.NewLoggingExport(c.Request.Context(), in)
+	if err != nil {
+		audit.Error = err.Error()
+		httputil.RespError(c, err)
+		return
+	}
+	filename := fmt.Sprintf("logging_%s%s", s.Format("20060102150405"), export.FileExt(exp.Format, exp.Gzip))
+	c.Header("Content-Type", export.ContentType(exp.Format, exp.Gzip))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+	audit.Rows, err = exp.Run(c.Request.Context(), c.Writer)
+	if err != nil {
+		audit.Error = err.Error()
+	}
+}
+
+// auditOperator 只有一个管理员账户，开启登录时记录管理员
+func auditOperator(c *gin.Context) string {
+	if data, ok := httputil.GetJWTClaims(c); ok && data.NickName != "" {
+		return data.NickName
+	}
+	if config.Global.AuthEnable {
+		return config.Global.AdminUser.Username
+	}
+	return ""
+}
+
+func (h *Handler) FindTopPattern(c *gin.Context) {
+	in := &entity.FindTopPatternReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.ListResp{}
+	if err := h.srv.FindTopPattern(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+func (h *Handler) FindAuditLogList(c *gin.Context) {
+	in := &entity.FindAuditLogListReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.ListResp{}
+	if err := h.srv.FindAuditLogList(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+
+	httputil.RespData(c, http.StatusOK, out)
+}
+
 func (h *Handler) FindLoggingByTraceID(c *gin.Context) {
 	in := &entity.FindLoggingByTraceIDReq{}
 	if err := c.ShouldBind(in); err != nil {
@@ -131,6 +255,91 @@ func (h *Handler) FindLoggingByTraceID(c *gin.Context) {
 	httputil.RespData(c, http.StatusOK, out)
 }
 
+func (h *Handler) FindLoggingContext(c *gin.Context) {
+	in := &entity.FindLoggingContextReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.FindLoggingContextResp{}
+	if err := h.srv.FindLoggingContext(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+func (h *Handler) FindTrace(c *gin.Context) {
+	in := &entity.FindTraceReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.FindTraceResp{}
+	if err := h.srv.FindTrace(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+// TailLogging SSE 推送实时日志，事件 log 为日志，dropped 为累计丢弃条数，ping 为心跳
+// 连接在写超时前以 reconnect 事件结束，EventSource 会自动重连
+func (h *Handler) TailLogging(c *gin.Context) {
+	in := &entity.TailLoggingReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	s, err := h.srv.TailLogging(in)
+	if err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	defer h.srv.StopTailLogging(s)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(tailHeartbeatInterval)
+	defer heartbeat.Stop()
+	expire := time.NewTimer(httpWriteTimeout - 10*time.Second)
+	defer expire.Stop()
+	dropped := uint64(0)
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-s.Done():
+			if err := s.Err(); err != nil {
+				c.SSEvent("error", err.Error())
+				c.Writer.Flush()
+			}
+			return
+		case <-expire.C:
+			c.SSEvent("reconnect", "")
+			c.Writer.Flush()
+			return
+		case v := <-s.C():
+			c.SSEvent("log", tailLoggingEntity(v))
+		case <-heartbeat.C:
+			if n := s.Dropped(); n != dropped {
+				dropped = n
+				c.SSEvent("dropped", n)
+			} else {
+				c.SSEvent("ping", time.Now().Unix())
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
 func (h *Handler) GetShardingIndex(c *gin.Context) {
 	out := &entity.GetShardingIndexResp{}
 	if err := h.srv.GetShardingIndex(c.Request.Context(), out); err != nil {
@@ -161,7 +370,7 @@ func (h *Handler) CreateAlarmRule(c *gin.Context) {
 		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
 		return
 	}
-	if err := h.srv.CreateAlarmRule(c.Request.Context(), in); err != nil {
+	if err := h.srv.CreateAlarmRule(c.Request.Context(), auditOperator(c), in); err != nil {
 		httputil.RespError(c, err)
 		return
 	}
@@ -174,7 +383,7 @@ func (h *Handler) UpdateAlarmRule(c *gin.Context) {
 		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
 		return
 	}
-	if err := h.srv.UpdateAlarmRule(c.Request.Context(), in); err != nil {
+	if err := h.srv.UpdateAlarmRule(c.Request.Context(), auditOperator(c), in); err != nil {
 		httputil.RespError(c, err)
 		return
 	}
@@ -194,6 +403,60 @@ func (h *Handler) DeleteAlarmRule(c *gin.Context) {
 	httputil.RespSuccess(c)
 }
 
+func (h *Handler) FindProcessorList(c *gin.Context) {
+	in := &entity.FindProcessorListReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+
+	out := &entity.ListResp{}
+	if err := h.srv.FindProcessorList(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+func (h *Handler) CreateProcessor(c *gin.Context) {
+	in := &entity.CreateProcessorReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := h.srv.CreateProcessor(c.Request.Context(), in); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespSuccess(c)
+}
+
+func (h *Handler) UpdateProcessor(c *gin.Context) {
+	in := &entity.UpdateProcessorReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := h.srv.UpdateProcessor(c.Request.Context(), in); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespSuccess(c)
+}
+
+func (h *Handler) DeleteProcessor(c *gin.Context) {
+	in := &entity.DeleteProcessorReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := h.srv.DeleteProcessor(c.Request.Context(), in); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespSuccess(c)
+}
+
 func (h *Handler) MetricsDBStats(c *gin.Context) {
 	out := &entity.ListResp{}
 	if err := h.srv.MetricsDBStats(c.Request.Context(), out); err != nil {
@@ -327,3 +590,88 @@ func (h *Handler) PingHookURL(c *gin.Context) {
 	}
 	httputil.RespSuccess(c)
 }
+
+func (h *Handler) FindSavedSearchList(c *gin.Context) {
+	in := &entity.FindSavedSearchListReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.ListResp{}
+	if err := h.srv.FindSavedSearchList(c.Request.Context(), auditOperator(c), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+func (h *Handler) CreateSavedSearch(c *gin.Context) {
+	in := &entity.CreateSavedSearchReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := h.srv.CreateSavedSearch(c.Request.Context(), auditOperator(c), in); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespSuccess(c)
+}
+
+func (h *Handler) UpdateSavedSearch(c *gin.Context) {
+	in := &entity.UpdateSavedSearchReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := h.srv.UpdateSavedSearch(c.Request.Context(), auditOperator(c), in); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespSuccess(c)
+}
+
+func (h *Handler) DeleteSavedSearch(c *gin.Context) {
+	in := &entity.DeleteSavedSearchReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := h.srv.DeleteSavedSearch(c.Request.Context(), auditOperator(c), in); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespSuccess(c)
+}
+
+func (h *Handler) CreateShareLink(c *gin.Context) {
+	in := &entity.CreateShareLinkReq{}
+	if err := c.ShouldBind(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.CreateShareLinkResp{}
+	if err := h.srv.CreateShareLink(c.Request.Context(), auditOperator(c), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespData(c, http.StatusOK, out)
+}
+
+func (h *Handler) ResolveShareLink(c *gin.Context) {
+	in := &entity.ResolveShareLinkReq{}
+	if err := c.ShouldBindUri(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	if err := c.ShouldBindQuery(in); err != nil {
+		httputil.RespError(c, httputil.ErrArgsInvalid.MergeError(err))
+		return
+	}
+	out := &entity.ResolveShareLinkResp{}
+	if err := h.srv.ResolveShareLink(c.Request.Context(), in, out); err != nil {
+		httputil.RespError(c, err)
+		return
+	}
+	httputil.RespData(c, http.StatusOK, out)
+}
@@ -5,11 +5,17 @@ import (
 	"time"
 
 	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/infra/prom"
 	"github.com/huzhongqing/qelog/pkg/config"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	httpWriteTimeout      = 90 * time.Second
+	tailHeartbeatInterval = 15 * time.Second
+)
+
 type HTTPService struct {
 	server *http.Server
 }
@@ -28,13 +34,15 @@ func (srv *HTTPService) Run(addr string) error {
 		handler.Use(gin.Logger(), gin.Recovery())
 	}
 
+	handler.Use(prom.GinMiddleware("manager"))
+	handler.GET("/metrics", prom.GinHandler())
 	RegisterRouter(handler)
 
 	srv.server = &http.Server{
 		Addr:         addr,
 		Handler:      handler,
 		ReadTimeout:  120 * time.Second,
-		WriteTimeout: 90 * time.Second,
+		WriteTimeout: httpWriteTimeout,
 	}
 	return srv.server.ListenAndServe()
 }
@@ -59,6 +67,7 @@ func RegisterRouter(route *gin.Engine, midd ...gin.HandlerFunc) {
 		module.GET("/list", h.FindModuleList)
 		module.POST("", h.CreateModule)
 		module.PUT("", h.UpdateModule)
+		module.PUT("/approve", h.ApproveModule)
 		module.DELETE("", h.DeleteModule)
 	}
 	// 配置报警规则
@@ -75,6 +84,15 @@ func RegisterRouter(route *gin.Engine, midd ...gin.HandlerFunc) {
 		alarmRule.GET("/hook/ping", h.PingHookURL)
 	}
 
+	// 配置写入处理规则
+	processor := v1.Group("/processor", httputil.HandlerLogging(true))
+	{
+		processor.GET("/list", h.FindProcessorList)
+		processor.POST("", h.CreateProcessor)
+		processor.PUT("", h.UpdateProcessor)
+		processor.DELETE("", h.DeleteProcessor)
+	}
+
 	// 获取分片使用信息
 	v1.GET("/shardingIndex", h.GetShardingIndex)
 
@@ -82,10 +100,33 @@ func RegisterRouter(route *gin.Engine, midd ...gin.HandlerFunc) {
 	logging := v1.Group("/logging")
 	{
 		logging.POST("/list", h.FindLoggingList)
+		logging.POST("/query", h.QueryLogging)
+		logging.POST("/export", h.ExportLogging)
+		logging.POST("/aggregate", h.AggregateLogging)
 		logging.POST("/traceid", h.FindLoggingByTraceID)
+		logging.GET("/context", h.FindLoggingContext)
+		logging.GET("/trace", h.FindTrace)
+		logging.GET("/tail", h.TailLogging)
 		logging.DELETE("/collection", h.DropLoggingCollection)
 	}
 
+	// 保存的查询与分享链接
+	savedSearch := v1.Group("/savedSearch", httputil.HandlerLogging(true))
+	{
+		savedSearch.GET("/list", h.FindSavedSearchList)
+		savedSearch.POST("", h.CreateSavedSearch)
+		savedSearch.PUT("", h.UpdateSavedSearch)
+		savedSearch.DELETE("", h.DeleteSavedSearch)
+		savedSearch.POST("/share", h.CreateShareLink)
+	}
+	v1.GET("/share/:shortId", h.ResolveShareLink)
+
+	// 短消息模板排行
+	v1.GET("/pattern/top", h.FindTopPattern)
+
+	// 审计记录
+	v1.GET("/audit/list", h.FindAuditLogList)
+
 	// 报表
 	metrics := v1.Group("/metrics")
 	{
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	apiTypes "github.com/huzhongqing/qelog/api/types"
@@ -14,13 +17,30 @@ import (
 	"github.com/huzhongqing/qelog/infra/mongo"
 	"github.com/huzhongqing/qelog/pkg/common/entity"
 	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/fieldquery"
+	"github.com/huzhongqing/qelog/pkg/fulltext"
+	"github.com/huzhongqing/qelog/pkg/qlang"
+	"github.com/huzhongqing/qelog/pkg/storage"
+	"github.com/huzhongqing/qelog/pkg/types"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
 
+// 全文搜索最多使用的分词数
+const maxKeywordTokens = 16
+
+const (
+	// 没有游标时按 page 翻页，每个集合需要查询前面所有页，限制最多的条数
+	maxPageOffset = 5000
+	// 原文校验或去重后不足一页时继续向后查询，最多查询的次数
+	maxSearchRounds = 5
+)
+
 func (srv *Service) FindLoggingByTraceID(ctx context.Context, in *entity.FindLoggingByTraceIDReq, out *entity.ListResp) error {
+	defer observeQuery("logging_trace", time.Now())
 	tid, err := apiTypes.TraceIDFromHex(in.TraceID)
 	if err != nil {
 		return httputil.ErrArgsInvalid.MergeError(err)
@@ -48,6 +68,7 @@ func (srv *Service) FindLoggingByTraceID(ctx context.Context, in *entity.FindLog
 		findOpt := options.Find()
 		// 正序，调用流
 		findOpt.SetSort(bson.M{"ts": 1})
+		findOpt.SetProjection(bson.M{"tk": 0})
 		docs := make([]*model.Logging, 0)
 
 		shardingStore, err := srv.sharding.GetStore(in.ShardingIndex)
@@ -74,7 +95,7 @@ func (srv *Service) FindLoggingByTraceID(ctx context.Context, in *entity.FindLog
 				TsMill:         v.TimeMill,
 				Level:          int32(v.Level),
 				Short:          v.Short,
-				Full:           v.Full,
+				Full:           v.FullString(),
 				ConditionOne:   v.Condition1,
 				ConditionTwo:   v.Condition2,
 				ConditionThree: v.Condition3,
@@ -92,46 +113,28 @@ func (srv *Service) FindLoggingByTraceID(ctx context.Context, in *entity.FindLog
 }
 
 func (srv *Service) FindLoggingList(ctx context.Context, in *entity.FindLoggingListReq, out *entity.ListResp) error {
+	defer observeQuery("logging_list", time.Now())
 
-	s := time.Now()
-	// 如果没有传入时间，则默认设置一个间隔时间
-	b, e := in.InitTimeSection(time.Hour)
-	// 计算查询时间应该在哪个分片
-	collectionName := ""
-	if in.ForceCollectionName != "" {
-		if strings.HasPrefix(in.ForceCollectionName, "logging") {
-			collectionName = in.ForceCollectionName
-		}
-	} else {
-		// 计算集合名
-		names := srv.lcn.ScopeNames(in.ShardingIndex, b.Unix(), e.Unix())
-		if len(names) >= 2 {
-			format := "2006-01-02 15:04:05"
-			suggestTime, _ := srv.lcn.SuggestTime(names[0])
-			suggest := suggestTime.Format(format)
-			return httputil.NewError(httputil.ErrCodeOpException,
-				fmt.Sprintf("查询时间已跨分片集合,未不影响结果,建议查询时间: %s -- %s 或者 %s -- %s",
-					b.Format(format), suggest, suggest, e.Format(format)))
-		}
-		if len(names) > 0 {
-			collectionName = names[0]
-		}
+	q, err := newLoggingSearch(in)
+	if err != nil {
+		return err
 	}
+	return srv.searchLogging(ctx, q, out)
+}
 
+// newLoggingSearch 列表查询的条件，按联合索引的顺序校验
+func newLoggingSearch(in *entity.FindLoggingListReq) (*loggingSearch, error) {
 	filter := bson.M{
 		"m": strings.TrimSpace(in.ModuleName),
 	}
 
-	// 查询条件必须存在时间
-	filter["ts"] = bson.M{"$gte": b.Unix(), "$lt": e.Unix()}
-
 	if in.Level > -2 {
 		filter["l"] = in.Level
 	}
 
 	if in.Short != "" {
 		if _, ok := filter["l"]; !ok {
-			return httputil.ErrArgsInvalid.MergeString("必需传入[等级]，才能使用[短消息]筛选条件")
+			return nil, httputil.ErrArgsInvalid.MergeString("必需传入[等级]，才能使用[短消息]筛选条件")
 		}
 		filter["s"] = primitive.Regex{
 			Pattern: in.Short,
@@ -141,7 +144,7 @@ func (srv *Service) FindLoggingList(ctx context.Context, in *entity.FindLoggingL
 
 	if in.IP != "" {
 		if _, ok := filter["s"]; !ok {
-			return httputil.ErrArgsInvalid.MergeString("必需传入[短消息]，才能使用[IP]筛选条件")
+			return nil, httputil.ErrArgsInvalid.MergeString("必需传入[短消息]，才能使用[IP]筛选条件")
 		}
 		filter["ip"] = in.IP
 	}
@@ -156,55 +159,492 @@ func (srv *Service) FindLoggingList(ctx context.Context, in *entity.FindLoggingL
 		}
 	}
 
-	findOpt := options.Find()
-	in.SetPage(findOpt)
-	findOpt.SetSort(bson.M{"ts": -1})
+	if in.PatternID != "" {
+		filter["pi"] = in.PatternID
+	}
+
+	fields := make([]fieldquery.Predicate, 0, len(in.Fields))
+	for _, v := range in.Fields {
+		fields = append(fields, fieldquery.Predicate(v))
+	}
+	// 如果没有传入时间，则默认设置一个间隔时间
+	b, e := in.InitTimeSection(time.Hour)
+	q := &loggingSearch{
+		shardingIndex:       in.ShardingIndex,
+		moduleName:          strings.TrimSpace(in.ModuleName),
+		forceCollectionName: in.ForceCollectionName,
+		begin:               b,
+		end:                 e,
+		filter:              filter,
+		keyword:             in.Keyword,
+		fields:              fields,
+		cursor:              in.Cursor,
+		page:                in.Page,
+		limit:               in.Limit,
+	}
+	return q, nil
+}
 
-	shardingStore, err := srv.sharding.GetStore(in.ShardingIndex)
+// loggingSearch 列表查询与查询语句共用的条件
+type loggingSearch struct {
+	shardingIndex       int
+	moduleName          string
+	forceCollectionName string
+	begin               time.Time
+	end                 time.Time
+	// 索引字段的条件，不包含时间
+	filter  bson.M
+	keyword string
+	fields  []fieldquery.Predicate
+	cursor  string
+	// 游标为空时使用
+	page  int64
+	limit int64
+}
+
+// compile 生成完整的查询条件，关键词需要按原文校验
+func (q *loggingSearch) compile() (bson.M, fulltext.Query, error) {
+	filter := copyFilter(q.filter)
+	// 查询条件必须存在时间
+	filter["ts"] = bson.M{"$gte": q.begin.Unix(), "$lt": q.end.Unix()}
+
+	query := fulltext.ParseQuery(q.keyword)
+	if !query.Empty() {
+		tokens := query.Tokens()
+		if len(tokens) == 0 {
+			return nil, query, httputil.ErrArgsInvalid.MergeString("[关键词]至少包含两个字母数字或一个汉字")
+		}
+		if len(tokens) > maxKeywordTokens {
+			return nil, query, httputil.ErrArgsInvalid.MergeString("[关键词]过长")
+		}
+		filter["tk"] = bson.M{"$all": tokens}
+	}
+	return filter, query, nil
+}
+
+// fieldConds 结构化详情的条件，需要先检查扫描数量
+func (q *loggingSearch) fieldConds() ([]bson.M, error) {
+	conds, err := fieldquery.Build(q.fields)
 	if err != nil {
-		return httputil.ErrArgsInvalid.MergeError(err)
+		return nil, httputil.ErrArgsInvalid.MergeError(err)
+	}
+	return conds, nil
+}
+
+func (srv *Service) searchLogging(ctx context.Context, q *loggingSearch, out *entity.ListResp) error {
+	s := time.Now()
+	var cursor *types.LoggingCursor
+	if q.cursor != "" {
+		c, err := types.DecodeLoggingCursor(q.cursor)
+		if err != nil {
+			return httputil.ErrArgsInvalid.MergeError(err)
+		}
+		cursor = &c
+	}
+	filter, query, err := q.compile()
+	if err != nil {
+		return err
+	}
+	fieldConds, err := q.fieldConds()
+	if err != nil {
+		return err
+	}
+
+	targets, err := srv.loggingTargets(ctx, q)
+	if err != nil {
+		return err
+	}
+	if len(fieldConds) > 0 {
+		if err := guardUnindexedScan(ctx, targets, filter); err != nil {
+			return err
+		}
+		filter["$and"] = fieldConds
+	}
+
+	limit := q.limit
+	if limit <= 0 {
+		limit = 20
 	}
-	docs := make([]*model.Logging, 0, in.Limit)
-	c, err := shardingStore.FindLoggingList(ctx, collectionName, filter, 50000, &docs, findOpt)
+	skip := int64(0)
+	if cursor == nil && q.page > 1 {
+		skip = (q.page - 1) * limit
+	}
+	if skip+limit > maxPageOffset {
+		return httputil.ErrArgsInvalid.MergeString(fmt.Sprintf("只能查询前 %d 条，请使用 nextCursor 翻页", maxPageOffset))
+	}
+
+	fetch := func(cursor *types.LoggingCursor, limit int64) ([]*model.Logging, int64, error) {
+		return findLoggingTargets(ctx, targets, filter, cursor, limit)
+	}
+	list, next, count, err := pageLogging(fetch, cursor, skip+limit, query)
 	if err != nil {
 		return httputil.ErrSystemException.MergeError(err)
 	}
-	out.Count = c
+	out.Count = count
+	if next != nil {
+		out.NextCursor = types.NewLoggingCursor(next).Encode()
+	}
+	if int64(len(list)) > skip {
+		list = list[skip:]
+	} else {
+		list = list[:0]
+	}
+	out.List = list
 
-	// 去除极低可能重复写入的日志信息
-	hitMap := map[string]struct{}{}
-	list := make([]*entity.FindLoggingList, 0, len(docs))
-	for _, v := range docs {
-		if _, ok := hitMap[v.MessageID]; ok {
-			continue
-		} else {
+	logs.Qezap.InfoWithCtx(ctx, "日志查询", zap.String("耗时", time.Now().Sub(s).String()),
+		zap.Int("集合数", len(targets)),
+		zap.Any("条件", filter))
+
+	return nil
+}
+
+// pageLogging 从游标开始取 need 条，去重与原文校验后不足时继续向后查询
+// next 为最后一条返回或者已校验的日志，没有更多日志时为 nil
+func pageLogging(fetch func(cursor *types.LoggingCursor, limit int64) ([]*model.Logging, int64, error),
+	cursor *types.LoggingCursor, need int64, query fulltext.Query) ([]*entity.FindLoggingList, *model.Logging, int64, error) {
+	var (
+		// 去除极低可能重复写入的日志信息
+		hitMap = map[string]struct{}{}
+		list   = make([]*entity.FindLoggingList, 0, need)
+		next   *model.Logging
+		count  int64
+	)
+	for round := 0; round < maxSearchRounds; round++ {
+		docs, c, err := fetch(cursor, need)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		if round == 0 {
+			count = c
+		}
+		consumed := 0
+		for _, v := range docs {
+			if int64(len(list)) == need {
+				break
+			}
+			consumed++
+			next = v
+			if _, ok := hitMap[v.MessageID]; ok {
+				continue
+			}
 			hitMap[v.MessageID] = struct{}{}
+			if d := matchedEntity(v, query); d != nil {
+				list = append(list, d)
+			}
+		}
+		if consumed < len(docs) || int64(len(list)) == need {
+			break
 		}
+		if int64(len(docs)) < need {
+			// 没有更多日志
+			return list, nil, count, nil
+		}
+		nc := types.NewLoggingCursor(next)
+		cursor = &nc
+	}
+	return list, next, count, nil
+}
 
-		d := &entity.FindLoggingList{
-			ID:             v.ID.Hex(),
-			TsMill:         v.TimeMill,
-			Level:          int32(v.Level),
-			Short:          v.Short,
-			Full:           v.Full,
-			ConditionOne:   v.Condition1,
-			ConditionTwo:   v.Condition2,
-			ConditionThree: v.Condition3,
-			IP:             v.IP,
-			TraceID:        v.TraceID,
+// matchedEntity 关键词分词命中后按原文校验关键词与短语，未命中时返回 nil，数量以分词命中为准
+func matchedEntity(v *model.Logging, query fulltext.Query) *entity.FindLoggingList {
+	d := loggingEntity(v)
+	if query.Empty() {
+		return d
+	}
+	if d.Score = query.Score(d.Short, d.Full); d.Score == 0 {
+		return nil
+	}
+	d.Highlight = &entity.LoggingHighlight{
+		Short: highlightSpans(query.Highlight(v.Short)),
+		Full:  highlightSpans(query.Highlight(d.Full)),
+	}
+	return d
+}
+
+// QueryLogging 解析查询语句，没有 count 时与列表查询一致，count 时返回数量或分组数量
+func (srv *Service) QueryLogging(ctx context.Context, in *entity.QueryLoggingReq, out *entity.ListResp) error {
+	defer observeQuery("logging_query", time.Now())
+	plan, err := qlang.Parse(in.Query)
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+	b, e := in.InitTimeSection(time.Hour)
+	q := &loggingSearch{
+		shardingIndex: in.ShardingIndex,
+		moduleName:    plan.Module,
+		begin:         b,
+		end:           e,
+		filter:        plan.Filter,
+		keyword:       plan.Keyword,
+		fields:        plan.Fields,
+		cursor:        in.Cursor,
+		page:          in.Page,
+		limit:         in.Limit,
+	}
+	if plan.Limit > 0 {
+		q.limit = plan.Limit
+	}
+	if !plan.Count {
+		return srv.searchLogging(ctx, q, out)
+	}
+	return srv.countLogging(ctx, q, plan, out)
+}
+
+// 分组统计每个集合最多返回的分组数
+const maxCountGroups = 1000
+
+func (srv *Service) countLogging(ctx context.Context, q *loggingSearch, plan *qlang.Plan, out *entity.ListResp) error {
+	filter, _, err := q.compile()
+	if err != nil {
+		return err
+	}
+	fieldConds, err := q.fieldConds()
+	if err != nil {
+		return err
+	}
+	targets, err := srv.loggingTargets(ctx, q)
+	if err != nil {
+		return err
+	}
+	if len(fieldConds) > 0 {
+		if err := guardUnindexedScan(ctx, targets, filter); err != nil {
+			return err
+		}
+		filter["$and"] = fieldConds
+	}
+
+	if len(plan.CountBy) == 0 {
+		// 关键词只按分词统计，不按原文校验
+		total := int64(0)
+		for _, t := range targets {
+			c, err := t.store.CountLogging(ctx, t.name, filter, 0)
+			if err != nil {
+				return httputil.ErrSystemException.MergeError(err)
+			}
+			total += c
 		}
-		list = append(list, d)
+		out.Count = total
+		out.List = []*entity.LoggingCountGroup{}
+		return nil
 	}
+
+	type group struct {
+		ID    bson.M `bson:"_id"`
+		Count int64  `bson:"count"`
+	}
+	pipeline := []bson.M{
+		{"$match": filter},
+		plan.GroupStage(),
+		{"$sort": bson.M{"count": -1}},
+		{"$limit": maxCountGroups},
+	}
+	merged := make(map[string]*entity.LoggingCountGroup)
+	list := make([]*entity.LoggingCountGroup, 0)
+	total := int64(0)
+	for _, t := range targets {
+		groups := make([]group, 0)
+		if err := t.store.AggregateLogging(ctx, t.name, pipeline, &groups); err != nil {
+			return httputil.ErrSystemException.MergeError(err)
+		}
+		for _, g := range groups {
+			key := make(map[string]interface{}, len(plan.CountBy))
+			for i, name := range plan.CountBy {
+				key[name] = g.ID["k"+strconv.Itoa(i)]
+			}
+			id := fmt.Sprint(g.ID)
+			v, ok := merged[id]
+			if !ok {
+				v = &entity.LoggingCountGroup{Key: key}
+				merged[id] = v
+				list = append(list, v)
+			}
+			v.Count += g.Count
+			total += g.Count
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Count > list[j].Count
+	})
+	limit := plan.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	if int64(len(list)) > limit {
+		list = list[:limit]
+	}
+	out.Count = total
 	out.List = list
+	return nil
+}
 
-	logs.Qezap.InfoWithCtx(ctx, "日志查询", zap.String("耗时", time.Now().Sub(s).String()),
-		zap.String("分片", shardingStore.Database().Name()),
-		zap.Any("集合", collectionName),
-		zap.Any("条件", filter))
+// 一次查询最多涉及的集合数，包含历史分片索引
+const maxQueryCollections = 32
+
+// 第一页统计的最大数量
+const maxLoggingCount = 50000
+
+type loggingTarget struct {
+	store *storage.Store
+	name  string
+}
+
+// loggingTargets 时间范围内模块当前与历史分片索引的所有集合
+func (srv *Service) loggingTargets(ctx context.Context, q *loggingSearch) ([]loggingTarget, error) {
+	if q.forceCollectionName != "" {
+		if !strings.HasPrefix(q.forceCollectionName, "logging") {
+			return nil, nil
+		}
+		store, err := srv.sharding.GetStore(q.shardingIndex)
+		if err != nil {
+			return nil, httputil.ErrArgsInvalid.MergeError(err)
+		}
+		return []loggingTarget{{store: store, name: q.forceCollectionName}}, nil
+	}
 
+	indexes := []int{q.shardingIndex}
+	module := &model.Module{}
+	ok, err := srv.store.FindOneModule(ctx, bson.M{"name": q.moduleName}, module)
+	if err != nil {
+		return nil, httputil.ErrSystemException.MergeError(err)
+	}
+	if ok {
+		for _, index := range module.HistoryShardingIndex {
+			exists := false
+			for _, v := range indexes {
+				exists = exists || v == index
+			}
+			if !exists {
+				indexes = append(indexes, index)
+			}
+		}
+	}
+
+	targets := make([]loggingTarget, 0)
+	for _, index := range indexes {
+		store, err := srv.sharding.GetStore(index)
+		if err != nil {
+			if index == q.shardingIndex {
+				return nil, httputil.ErrArgsInvalid.MergeError(err)
+			}
+			// 历史索引的实例可能已经移除
+			continue
+		}
+		for _, name := range srv.lcn.ScopeNames(index, q.begin.Unix(), q.end.Unix()) {
+			targets = append(targets, loggingTarget{store: store, name: name})
+		}
+	}
+	if len(targets) > maxQueryCollections {
+		return nil, httputil.ErrArgsInvalid.MergeString(fmt.Sprintf("查询涉及 %d 个集合，超过 %d 个，请缩小时间范围", len(targets), maxQueryCollections))
+	}
+	return targets, nil
+}
+
+// findLoggingTargets 并发查询所有集合后合并排序，没有游标时统计总数
+func findLoggingTargets(ctx context.Context, targets []loggingTarget, filter bson.M, cursor *types.LoggingCursor, limit int64) ([]*model.Logging, int64, error) {
+	var (
+		wg     sync.WaitGroup
+		lists  = make([][]*model.Logging, len(targets))
+		counts = make([]int64, len(targets))
+		errs   = make([]error, len(targets))
+	)
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t loggingTarget) {
+			defer wg.Done()
+			lists[i], errs[i] = findLoggingPage(ctx, t, filter, cursor, limit)
+			if errs[i] == nil && cursor == nil {
+				counts[i], errs[i] = t.store.CountLogging(ctx, t.name, filter, maxLoggingCount)
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	count := int64(0)
+	for i := range targets {
+		if errs[i] != nil {
+			return nil, 0, errs[i]
+		}
+		count += counts[i]
+	}
+	if count > maxLoggingCount {
+		count = maxLoggingCount
+	}
+	return types.MergeLogging(lists, int(limit)), count, nil
+}
+
+// findLoggingPage 按 ts 倒序使用索引查询，最后一秒可能只取到部分，再按 _id 倒序补齐
+// 保证结果是 (ts, _id) 倒序的前 limit 条，与游标顺序一致
+func findLoggingPage(ctx context.Context, t loggingTarget, filter bson.M, cursor *types.LoggingCursor, limit int64) ([]*model.Logging, error) {
+	pageFilter := copyFilter(filter)
+	if cursor != nil {
+		for k, v := range cursor.Filter() {
+			pageFilter[k] = v
+		}
+	}
+	opt := options.Find().SetSort(bson.M{"ts": -1}).SetLimit(limit).SetProjection(bson.M{"tk": 0})
+	docs := make([]*model.Logging, 0, limit)
+	if err := t.store.FindLogging(ctx, t.name, pageFilter, &docs, opt); err != nil {
+		return nil, err
+	}
+	if int64(len(docs)) < limit {
+		return docs, nil
+	}
+
+	last := docs[len(docs)-1].TimeSec
+	tieFilter := copyFilter(filter)
+	tieFilter["ts"] = last
+	if cursor != nil && cursor.TimeSec == last {
+		tieFilter["_id"] = bson.M{"$lt": cursor.ID}
+	}
+	tieOpt := options.Find().SetSort(bson.M{"_id": -1}).SetLimit(limit).SetProjection(bson.M{"tk": 0})
+	tie := make([]*model.Logging, 0, limit)
+	if err := t.store.FindLogging(ctx, t.name, tieFilter, &tie, tieOpt); err != nil {
+		return nil, err
+	}
+	out := make([]*model.Logging, 0, len(docs)+len(tie))
+	for _, v := range docs {
+		if v.TimeSec != last {
+			out = append(out, v)
+		}
+	}
+	return append(out, tie...), nil
+}
+
+func copyFilter(filter bson.M) bson.M {
+	out := make(bson.M, len(filter)+1)
+	for k, v := range filter {
+		out[k] = v
+	}
+	return out
+}
+
+// guardUnindexedScan 字段条件需要逐条扫描索引条件命中的日志，数量过多时拒绝查询
+func guardUnindexedScan(ctx context.Context, targets []loggingTarget, filter bson.M) error {
+	max := int64(config.Global.Query.MaxUnindexedScan)
+	if max <= 0 {
+		return nil
+	}
+	total := int64(0)
+	for _, t := range targets {
+		c, err := t.store.CountLogging(ctx, t.name, filter, max+1-total)
+		if err != nil {
+			return httputil.ErrSystemException.MergeError(err)
+		}
+		if total += c; total > max {
+			return httputil.ErrArgsInvalid.MergeString(fmt.Sprintf("[字段]条件需要扫描超过 %d 条日志，请缩小时间范围或增加等级、短消息等条件", max))
+		}
+	}
 	return nil
 }
 
+func highlightSpans(spans []fulltext.Span) []entity.HighlightSpan {
+	out := make([]entity.HighlightSpan, 0, len(spans))
+	for _, v := range spans {
+		out = append(out, entity.HighlightSpan(v))
+	}
+	return out
+}
+
 func (srv *Service) DropLoggingCollection(ctx context.Context, in *entity.DropLoggingCollectionReq) error {
 	//  先检查 collectionName
 	dbColl := strings.Split(in.Name, ".")
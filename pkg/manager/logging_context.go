@@ -0,0 +1,163 @@
+package manager
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/storage"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+// 日志 ID 在写入时生成，与日志时间相差不大，在前后范围内的集合中查找
+const contextLookupRange = time.Hour
+
+// FindLoggingContext 同一模块在日志前后写入的日志，跨集合时继续在相邻集合中查找
+func (srv *Service) FindLoggingContext(ctx context.Context, in *entity.FindLoggingContextReq, out *entity.FindLoggingContextResp) error {
+	defer observeQuery("logging_context", time.Now())
+	id, err := primitive.ObjectIDFromHex(in.ID)
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+	store, err := srv.sharding.GetStore(in.ShardingIndex)
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+
+	var names []string
+	if in.ForceCollectionName != "" {
+		if !strings.HasPrefix(in.ForceCollectionName, "logging") {
+			return httputil.ErrNotFound
+		}
+		names = []string{in.ForceCollectionName}
+	} else {
+		t := id.Timestamp()
+		names = srv.lcn.ScopeNames(in.ShardingIndex, t.Add(-contextLookupRange).Unix(), t.Add(contextLookupRange).Unix())
+	}
+	anchor := &model.Logging{}
+	found := false
+	for _, name := range names {
+		if found, err = store.FindOneLogging(ctx, name, bson.M{"_id": id}, anchor); err != nil {
+			return httputil.ErrSystemException.MergeError(err)
+		} else if found {
+			break
+		}
+	}
+	if !found {
+		return httputil.ErrNotFound
+	}
+
+	filter := bson.M{"m": anchor.Module}
+	if in.SameIP {
+		filter["ip"] = anchor.IP
+	}
+	if in.SameTrace && anchor.TraceID != "" {
+		filter["ti"] = anchor.TraceID
+	}
+	window := in.WindowSec
+	if window <= 0 {
+		window = 3600
+	}
+	before, after := in.Before, in.After
+	if before <= 0 {
+		before = 20
+	}
+	if after <= 0 {
+		after = 20
+	}
+	cursor := types.NewLoggingCursor(anchor)
+	olderNames := srv.lcn.ScopeNames(in.ShardingIndex, anchor.TimeSec-window, anchor.TimeSec)
+	newerNames := srv.lcn.ScopeNames(in.ShardingIndex, anchor.TimeSec, anchor.TimeSec+window)
+	// 指定的集合不在按时间生成的集合中，只在该集合中查找
+	if in.ForceCollectionName != "" && !containsString(olderNames, in.ForceCollectionName) &&
+		!containsString(newerNames, in.ForceCollectionName) {
+		olderNames, newerNames = []string{in.ForceCollectionName}, []string{in.ForceCollectionName}
+	}
+
+	older, err := findLoggingContext(ctx, store, olderNames,
+		filter, bson.M{"$gte": anchor.TimeSec - window, "$lte": anchor.TimeSec}, cursor.Filter(), -1, before)
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	newer, err := findLoggingContext(ctx, store, newerNames,
+		filter, bson.M{"$gte": anchor.TimeSec, "$lte": anchor.TimeSec + window}, cursor.NewerFilter(), 1, after)
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+
+	// 向前查找的结果为倒序，返回时转为正序
+	for i, j := 0, len(older)-1; i < j; i, j = i+1, j-1 {
+		older[i], older[j] = older[j], older[i]
+	}
+	out.Anchor = loggingEntity(anchor)
+	out.Before = make([]*entity.FindLoggingList, 0, len(older))
+	for _, v := range older {
+		out.Before = append(out.Before, loggingEntity(v))
+	}
+	out.After = make([]*entity.FindLoggingList, 0, len(newer))
+	for _, v := range newer {
+		out.After = append(out.After, loggingEntity(v))
+	}
+	return nil
+}
+
+// findLoggingContext 按方向依次查找集合，direction 为 -1 时从最近的集合向前查找，凑够 limit 条为止
+func findLoggingContext(ctx context.Context, store *storage.Store, names []string, filter, ts, cursor bson.M, direction int, limit int64) ([]*model.Logging, error) {
+	if direction < 0 {
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+	}
+	out := make([]*model.Logging, 0, limit)
+	for _, name := range names {
+		f := copyFilter(filter)
+		f["ts"] = ts
+		for k, v := range cursor {
+			f[k] = v
+		}
+		opt := options.Find().
+			SetSort(bson.D{{Key: "ts", Value: direction}, {Key: "_id", Value: direction}}).
+			SetLimit(limit - int64(len(out))).
+			SetProjection(bson.M{"tk": 0})
+		docs := make([]*model.Logging, 0)
+		if err := store.FindLogging(ctx, name, f, &docs, opt); err != nil {
+			return nil, err
+		}
+		out = append(out, docs...)
+		if int64(len(out)) >= limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func loggingEntity(v *model.Logging) *entity.FindLoggingList {
+	return &entity.FindLoggingList{
+		ID:             v.ID.Hex(),
+		TsMill:         v.TimeMill,
+		Level:          int32(v.Level),
+		Short:          v.Short,
+		Full:           v.FullString(),
+		ConditionOne:   v.Condition1,
+		ConditionTwo:   v.Condition2,
+		ConditionThree: v.Condition3,
+		IP:             v.IP,
+		TraceID:        v.TraceID,
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
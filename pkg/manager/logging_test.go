@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"strconv"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/fulltext"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+// 一半的日志原文校验不通过，每页仍然取满，下一页从最后一条返回的日志之后开始
+func TestPageLoggingFillsPage(t *testing.T) {
+	docs := make([]*model.Logging, 0, 10)
+	for i := 0; i < 10; i++ {
+		short := "ok"
+		if i%2 == 0 {
+			short = "timeout " + strconv.Itoa(i)
+		}
+		docs = append(docs, &model.Logging{ID: primitive.NewObjectID(), MessageID: strconv.Itoa(i), TimeSec: int64(100 - i), Short: short})
+	}
+	fetch := func(cursor *types.LoggingCursor, limit int64) ([]*model.Logging, int64, error) {
+		out := make([]*model.Logging, 0, limit)
+		for _, v := range docs {
+			if cursor != nil && !types.LoggingBefore(&model.Logging{TimeSec: cursor.TimeSec, ID: cursor.ID}, v) {
+				continue
+			}
+			if int64(len(out)) < limit {
+				out = append(out, v)
+			}
+		}
+		return out, int64(len(docs)), nil
+	}
+	query := fulltext.ParseQuery("timeout")
+
+	list, next, count, err := pageLogging(fetch, nil, 3, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 10 || len(list) != 3 || list[2].Short != "timeout 4" || next != docs[4] {
+		t.Fatal(count, len(list), next)
+	}
+
+	c := types.NewLoggingCursor(next)
+	list, next, _, err = pageLogging(fetch, &c, 3, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Short != "timeout 6" || list[1].Short != "timeout 8" || next != nil {
+		t.Fatal(len(list), next)
+	}
+}
@@ -3,12 +3,15 @@ package manager
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/decoder"
 	"github.com/huzhongqing/qelog/pkg/types"
 
 	"github.com/huzhongqing/qelog/infra/alert"
@@ -74,6 +77,12 @@ func (srv *Service) FindModuleList(ctx context.Context, in *entity.FindModuleLis
 			Desc:                 v.Desc,
 			ShardingIndex:        v.ShardingIndex,
 			HistoryShardingIndex: v.HistoryShardingIndex,
+			Decoder:              entity.ModuleDecoder(v.Decoder),
+			Quota:                entity.ModuleQuota(v.Quota),
+			Pending:              v.Pending,
+			FullText:             v.FullText,
+			StructuredFull:       v.StructuredFull,
+			PatternMining:        v.PatternMining,
 			UpdatedTsSec:         v.UpdatedAt.Unix(),
 		}
 		list = append(list, d)
@@ -83,12 +92,21 @@ func (srv *Service) FindModuleList(ctx context.Context, in *entity.FindModuleLis
 }
 
 func (srv *Service) CreateModule(ctx context.Context, in *entity.CreateModuleReq) error {
+	dec := model.ModuleDecoder(in.Decoder)
+	if _, err := decoder.New(dec); err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
 
 	doc := &model.Module{
 		Name:                 in.Name,
 		Desc:                 in.Desc,
 		ShardingIndex:        in.ShardingIndex,
 		HistoryShardingIndex: make([]int, 0),
+		Decoder:              dec,
+		Quota:                model.ModuleQuota(in.Quota),
+		FullText:             in.FullText,
+		StructuredFull:       in.StructuredFull,
+		PatternMining:        in.PatternMining,
 		UpdatedAt:            time.Now().Local(),
 	}
 	if err := srv.store.InsertModule(ctx, doc); err != nil {
@@ -109,6 +127,22 @@ func (srv *Service) UpdateModule(ctx context.Context, in *entity.UpdateModuleReq
 	} else if !ok {
 		return httputil.ErrNotFound
 	}
+	update, err := moduleUpdate(doc, in)
+	if err != nil {
+		return err
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	filter := bson.M{
+		"_id":        doc.ID,
+		"updated_at": doc.UpdatedAt,
+	}
+	return srv.store.UpdateModule(ctx, filter, update)
+}
+
+// moduleUpdate 只修改请求中传入的字段
+func moduleUpdate(doc *model.Module, in *entity.UpdateModuleReq) (bson.M, error) {
 	update := bson.M{}
 	fields := bson.M{}
 	if doc.ShardingIndex != in.ShardingIndex {
@@ -118,18 +152,34 @@ func (srv *Service) UpdateModule(ctx context.Context, in *entity.UpdateModuleReq
 	if doc.Desc != in.Desc {
 		fields["desc"] = in.Desc
 	}
+	if in.Decoder != nil {
+		dec := model.ModuleDecoder(*in.Decoder)
+		if !reflect.DeepEqual(doc.Decoder, dec) {
+			if _, err := decoder.New(dec); err != nil {
+				return nil, httputil.ErrArgsInvalid.MergeError(err)
+			}
+			fields["decoder"] = dec
+		}
+	}
+	if in.Quota != nil {
+		if q := model.ModuleQuota(*in.Quota); doc.Quota != q {
+			fields["quota"] = q
+		}
+	}
+	if in.FullText != nil && doc.FullText != *in.FullText {
+		fields["full_text"] = *in.FullText
+	}
+	if in.StructuredFull != nil && doc.StructuredFull != *in.StructuredFull {
+		fields["structured_full"] = *in.StructuredFull
+	}
+	if in.PatternMining != nil && doc.PatternMining != *in.PatternMining {
+		fields["pattern_mining"] = *in.PatternMining
+	}
 	if len(fields) > 0 {
 		fields["updated_at"] = time.Now().Local()
 		update["$set"] = fields
 	}
-	if len(update) == 0 {
-		return nil
-	}
-	filter := bson.M{
-		"_id":        doc.ID,
-		"updated_at": doc.UpdatedAt,
-	}
-	return srv.store.UpdateModule(ctx, filter, update)
+	return update, nil
 }
 
 func (srv *Service) DeleteModule(ctx context.Context, in *entity.DeleteModuleReq) error {
@@ -149,28 +199,48 @@ func (srv *Service) DeleteModule(ctx context.Context, in *entity.DeleteModuleReq
 	return srv.store.DeleteModule(ctx, id)
 }
 
+// ApproveModule 审批通过自动注册的模块，receiver 更新配置后开始写入
+func (srv *Service) ApproveModule(ctx context.Context, in *entity.ApproveModuleReq) error {
+	id, err := in.ObjectID()
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+	filter := bson.M{
+		"_id":     id,
+		"pending": true,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"pending":    false,
+			"updated_at": time.Now().Local(),
+		},
+	}
+	if err := srv.store.UpdateModule(ctx, filter, update); err != nil {
+		if err == storage.ErrNotMatched {
+			return httputil.ErrNotFound
+		}
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	return nil
+}
+
 type AscShardingIndexState []entity.ShardingIndexState
 
-func (asc AscShardingIndexState) Len() int           { return len(asc) }
-func (asc AscShardingIndexState) Swap(i, j int)      { asc[i], asc[j] = asc[j], asc[i] }
-func (asc AscShardingIndexState) Less(i, j int) bool { return asc[i].Use < asc[j].Use }
+func (asc AscShardingIndexState) Len() int      { return len(asc) }
+func (asc AscShardingIndexState) Swap(i, j int) { asc[i], asc[j] = asc[j], asc[i] }
+func (asc AscShardingIndexState) Less(i, j int) bool {
+	if asc[i].Use == asc[j].Use {
+		return asc[i].Index < asc[j].Index
+	}
+	return asc[i].Use < asc[j].Use
+}
 
 func (srv *Service) GetShardingIndex(ctx context.Context, out *entity.GetShardingIndexResp) error {
 	docs, err := srv.store.FindAllModule(ctx)
 	if err != nil {
 		return httputil.ErrSystemException.MergeError(err)
 	}
-	state := make(map[int]int)
-	for i := 1; i <= model.ShardingIndexSize; i++ {
-		state[i] = 0
-	}
-	for _, v := range docs {
-		num, ok := state[v.ShardingIndex]
-		if ok {
-			state[v.ShardingIndex] = num + 1
-		}
-	}
-
+	state := model.ShardingIndexUse(docs)
 	states := make([]entity.ShardingIndexState, 0, len(state))
 	for k, v := range state {
 		states = append(states, entity.ShardingIndexState{
@@ -180,11 +250,8 @@ func (srv *Service) GetShardingIndex(ctx context.Context, out *entity.GetShardin
 	}
 	sort.Sort(AscShardingIndexState(states))
 
-	// 找到最小的，作为推荐
-	suggestDBIndex := model.ShardingIndexSize
-	if len(states) > 0 {
-		suggestDBIndex = states[0].Index
-	}
+	// 找到最小的，作为推荐，与 receiver 自动注册模块使用相同的规则
+	suggestDBIndex := model.SuggestShardingIndex(docs)
 
 	out.SuggestIndex = suggestDBIndex
 	out.ShardingIndexSize = model.ShardingIndexSize
@@ -221,16 +288,29 @@ func (srv *Service) FindAlarmRuleList(ctx context.Context, in *entity.FindAlarmR
 	list := make([]*entity.FindAlarmRuleList, 0, len(docs))
 	for _, v := range docs {
 		d := &entity.FindAlarmRuleList{
-			ID:           v.ID.Hex(),
-			Enable:       v.Enable,
-			ModuleName:   v.ModuleName,
-			Short:        v.Short,
-			Level:        v.Level.Int32(),
-			Tag:          v.Tag,
-			RateSec:      v.RateSec,
-			Method:       v.Method.Int32(),
-			HookID:       v.HookID,
-			UpdatedTsSec: v.UpdatedAt.Unix(),
+			ID:             v.ID.Hex(),
+			Enable:         v.Enable,
+			ModuleName:     v.ModuleName,
+			Short:          v.Short,
+			ShortMatch:     v.ShortMatch,
+			Full:           v.Full,
+			FullMatch:      v.FullMatch,
+			Level:          v.Level.Int32(),
+			LevelOp:        v.LevelOp,
+			IP:             v.IP,
+			ConditionOne:   v.ConditionOne,
+			ConditionTwo:   v.ConditionTwo,
+			ConditionThree: v.ConditionThree,
+			Type:           v.Type.Int32(),
+			WindowSec:      v.WindowSec,
+			Threshold:      v.Threshold,
+			EvalSec:        v.EvalSec,
+			Tag:            v.Tag,
+			RateSec:        v.RateSec,
+			Method:         v.Method.Int32(),
+			HookID:         v.HookID,
+			SavedSearchID:  v.SavedSearchID,
+			UpdatedTsSec:   v.UpdatedAt.Unix(),
 		}
 		list = append(list, d)
 	}
@@ -239,18 +319,19 @@ func (srv *Service) FindAlarmRuleList(ctx context.Context, in *entity.FindAlarmR
 	return nil
 }
 
-func (srv *Service) CreateAlarmRule(ctx context.Context, in *entity.CreateAlarmRuleReq) error {
+func (srv *Service) CreateAlarmRule(ctx context.Context, owner string, in *entity.CreateAlarmRuleReq) error {
+	if err := srv.applyAlarmSavedSearch(ctx, owner, in); err != nil {
+		return err
+	}
 	doc := &model.AlarmRule{
 		Enable:     true,
 		ModuleName: in.ModuleName,
-		Short:      in.Short,
-		Level:      model.Level(in.Level),
-		Tag:        in.Tag,
-		RateSec:    in.RateSec,
-		Method:     model.Method(in.Method),
-		HookID:     in.HookID,
-		UpdatedAt:  time.Now().Local(),
 	}
+	setAlarmRule(doc, in)
+	if err := checkAlarmRule(doc); err != nil {
+		return err
+	}
+	doc.UpdatedAt = time.Now().Local()
 
 	if err := srv.store.InsertAlarmRule(ctx, doc); err != nil {
 		return httputil.ErrSystemException.MergeError(err)
@@ -259,49 +340,37 @@ func (srv *Service) CreateAlarmRule(ctx context.Context, in *entity.CreateAlarmR
 	return nil
 }
 
-func (srv *Service) UpdateAlarmRule(ctx context.Context, in *entity.UpdateAlarmRuleReq) error {
+func (srv *Service) UpdateAlarmRule(ctx context.Context, owner string, in *entity.UpdateAlarmRuleReq) error {
 	id, err := in.ObjectID()
 	if err != nil {
 		return httputil.ErrArgsInvalid.MergeError(err)
 	}
-
 	doc := &model.AlarmRule{}
 	if ok, err := srv.store.FindOneAlarmRule(ctx, bson.M{"_id": id}, doc); err != nil {
 		return httputil.ErrSystemException.MergeError(err)
 	} else if !ok {
 		return httputil.ErrNotFound
 	}
-	update := bson.M{}
-	fields := bson.M{}
-	if in.Enable != doc.Enable {
-		fields["enable"] = in.Enable
-	}
-	if in.Short != doc.Short {
-		fields["short"] = in.Short
-	}
-	if in.RateSec != doc.RateSec {
-		fields["rate_sec"] = in.RateSec
-	}
-	if in.Level != doc.Level.Int32() {
-		fields["level"] = in.Level
-	}
-	if in.Tag != doc.Tag {
-		fields["tag"] = in.Tag
+	if err := srv.applyAlarmSavedSearch(ctx, owner, &in.CreateAlarmRuleReq); err != nil {
+		return err
 	}
-	if in.Method != doc.Method.Int32() {
-		fields["method"] = in.Method
+	// 模块不支持修改，关联其他模块的查询时条件与模块不一致
+	if in.SavedSearchID != "" && in.ModuleName != doc.ModuleName {
+		return httputil.ErrArgsInvalid.MergeString("保存的查询与报警规则的模块不一致")
 	}
-	if in.HookID != doc.HookID {
-		fields["hook_id"] = in.HookID
+	rule := *doc
+	rule.Enable = in.Enable
+	setAlarmRule(&rule, &in.CreateAlarmRuleReq)
+	if err := checkAlarmRule(&rule); err != nil {
+		return err
 	}
 
-	if len(fields) > 0 {
-		fields["updated_at"] = time.Now().Local()
-		update["$set"] = fields
-	}
-	if len(update) == 0 {
+	fields := alarmRuleUpdate(doc, &rule)
+	if len(fields) == 0 {
 		return nil
 	}
+	fields["updated_at"] = time.Now().Local()
+	update := bson.M{"$set": fields}
 
 	filter := bson.M{
 		"_id":        id,
@@ -315,6 +384,203 @@ func (srv *Service) UpdateAlarmRule(ctx context.Context, in *entity.UpdateAlarmR
 	return nil
 }
 
+// setAlarmRule 请求中为空的指针字段保持规则原来的值，module_name 不支持修改
+func setAlarmRule(rule *model.AlarmRule, in *entity.CreateAlarmRuleReq) {
+	rule.Short = in.Short
+	rule.Level = model.Level(in.Level)
+	if in.ShortMatch != nil {
+		rule.ShortMatch = *in.ShortMatch
+	}
+	if in.Full != nil {
+		rule.Full = *in.Full
+	}
+	if in.FullMatch != nil {
+		rule.FullMatch = *in.FullMatch
+	}
+	if in.LevelOp != nil {
+		rule.LevelOp = *in.LevelOp
+	}
+	if in.IP != nil {
+		rule.IP = *in.IP
+	}
+	if in.ConditionOne != nil {
+		rule.ConditionOne = *in.ConditionOne
+	}
+	if in.ConditionTwo != nil {
+		rule.ConditionTwo = *in.ConditionTwo
+	}
+	if in.ConditionThree != nil {
+		rule.ConditionThree = *in.ConditionThree
+	}
+	if in.Type != nil {
+		rule.Type = model.AlarmRuleType(*in.Type)
+	}
+	if in.WindowSec != nil {
+		rule.WindowSec = *in.WindowSec
+	}
+	if in.Threshold != nil {
+		rule.Threshold = *in.Threshold
+	}
+	if in.EvalSec != nil {
+		rule.EvalSec = *in.EvalSec
+	}
+	rule.Tag = in.Tag
+	rule.RateSec = in.RateSec
+	rule.Method = model.Method(in.Method)
+	rule.HookID = in.HookID
+	rule.SavedSearchID = in.SavedSearchID
+}
+
+// alarmRuleUpdate 合并请求后的规则与原规则不同的字段
+func alarmRuleUpdate(doc, rule *model.AlarmRule) bson.M {
+	fields := bson.M{}
+	if rule.Enable != doc.Enable {
+		fields["enable"] = rule.Enable
+	}
+	if rule.Short != doc.Short {
+		fields["short"] = rule.Short
+	}
+	if rule.RateSec != doc.RateSec {
+		fields["rate_sec"] = rule.RateSec
+	}
+	if rule.Level != doc.Level {
+		fields["level"] = rule.Level
+	}
+	if rule.ShortMatch != doc.ShortMatch {
+		fields["short_match"] = rule.ShortMatch
+	}
+	if rule.Full != doc.Full {
+		fields["full"] = rule.Full
+	}
+	if rule.FullMatch != doc.FullMatch {
+		fields["full_match"] = rule.FullMatch
+	}
+	if rule.LevelOp != doc.LevelOp {
+		fields["level_op"] = rule.LevelOp
+	}
+	if rule.IP != doc.IP {
+		fields["ip"] = rule.IP
+	}
+	if rule.ConditionOne != doc.ConditionOne {
+		fields["condition_one"] = rule.ConditionOne
+	}
+	if rule.ConditionTwo != doc.ConditionTwo {
+		fields["condition_two"] = rule.ConditionTwo
+	}
+	if rule.ConditionThree != doc.ConditionThree {
+		fields["condition_three"] = rule.ConditionThree
+	}
+	if rule.Type != doc.Type {
+		fields["type"] = rule.Type
+	}
+	if rule.WindowSec != doc.WindowSec {
+		fields["window_sec"] = rule.WindowSec
+	}
+	if rule.Threshold != doc.Threshold {
+		fields["threshold"] = rule.Threshold
+	}
+	if rule.EvalSec != doc.EvalSec {
+		fields["eval_sec"] = rule.EvalSec
+	}
+	if rule.Tag != doc.Tag {
+		fields["tag"] = rule.Tag
+	}
+	if rule.Method != doc.Method {
+		fields["method"] = rule.Method
+	}
+	if rule.HookID != doc.HookID {
+		fields["hook_id"] = rule.HookID
+	}
+	if rule.SavedSearchID != doc.SavedSearchID {
+		fields["saved_search_id"] = rule.SavedSearchID
+	}
+	return fields
+}
+
+// applyAlarmSavedSearch 报警按模块、短消息与等级匹配，保存的查询只能包含这些条件
+func (srv *Service) applyAlarmSavedSearch(ctx context.Context, owner string, in *entity.CreateAlarmRuleReq) error {
+	if in.SavedSearchID == "" {
+		return nil
+	}
+	doc, err := srv.findSavedSearch(ctx, owner, in.SavedSearchID)
+	if err != nil {
+		return err
+	}
+	f := doc.Filter
+	if f.Query != "" || f.ModuleName == "" {
+		return httputil.ErrArgsInvalid.MergeString("保存的查询需要包含模块，且不能使用查询语句")
+	}
+	if f.Keyword != "" || len(f.Fields) > 0 || f.PatternID != "" {
+		return httputil.ErrArgsInvalid.MergeString("报警不支持全文搜索、字段与模板条件")
+	}
+	setAlarmSearchFilter(in, &f)
+	return nil
+}
+
+// setAlarmSearchFilter 条件与日志列表的查询一致：等级为 -2 时不限制等级，短消息为不区分大小写的正则，
+// 条件需要前一个条件不为空才生效
+func setAlarmSearchFilter(in *entity.CreateAlarmRuleReq, f *model.SearchFilter) {
+	shortMatch, levelOp := model.MatchRegex, model.LevelOpEq
+	in.ModuleName = f.ModuleName
+	in.Short = ""
+	if f.Short != "" {
+		in.Short = "(?i)" + f.Short
+	}
+	in.ShortMatch = &shortMatch
+	in.Level = f.Level
+	if f.Level <= -2 {
+		levelOp = model.LevelOpGte
+		in.Level = -1
+	}
+	in.LevelOp = &levelOp
+	var one, two, three string
+	if f.ConditionOne != "" {
+		one = f.ConditionOne
+		if f.ConditionTwo != "" {
+			two = f.ConditionTwo
+			if f.ConditionThree != "" {
+				three = f.ConditionThree
+			}
+		}
+	}
+	in.IP = &f.IP
+	in.ConditionOne = &one
+	in.ConditionTwo = &two
+	in.ConditionThree = &three
+}
+
+// checkAlarmRule 完全相同的逐条匹配需要短消息，窗口规则需要窗口，除没有日志的规则外需要阈值，正则需要能编译
+func checkAlarmRule(rule *model.AlarmRule) error {
+	for _, v := range [][2]string{{rule.ShortMatch, rule.Short}, {rule.FullMatch, rule.Full}} {
+		if v[0] != model.MatchRegex || v[1] == "" {
+			continue
+		}
+		if _, err := regexp.Compile(v[1]); err != nil {
+			return httputil.ErrArgsInvalid.MergeError(err)
+		}
+	}
+	t := rule.Type
+	if !t.Windowed() {
+		if rule.Plain() && rule.Short == "" {
+			return httputil.ErrArgsInvalid.MergeString("short required")
+		}
+		return nil
+	}
+	if rule.WindowSec < 60 {
+		return httputil.ErrArgsInvalid.MergeString("windowSec 需要大于等于 60")
+	}
+	if rule.EvalSec != 0 && rule.EvalSec < 10 {
+		return httputil.ErrArgsInvalid.MergeString("evalSec 需要大于等于 10")
+	}
+	if !t.Absence() && rule.Threshold <= 0 {
+		return httputil.ErrArgsInvalid.MergeString("threshold required")
+	}
+	if t == model.AlarmRuleTypeRatio && rule.Threshold >= 100 {
+		return httputil.ErrArgsInvalid.MergeString("百分比阈值需要小于 100")
+	}
+	return nil
+}
+
 func (srv *Service) DeleteAlarmRule(ctx context.Context, in *entity.DeleteAlarmRuleReq) error {
 	id, err := in.ObjectID()
 	if err != nil {
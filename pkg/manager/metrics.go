@@ -22,6 +22,7 @@ import (
 )
 
 func (srv *Service) MetricsDBStats(ctx context.Context, out *entity.ListResp) error {
+	defer observeQuery("db_stats", time.Now())
 	// 先查看最后一条， 如果超时就去库里查询
 	mainCfg := srv.sharding.MainCfg()
 	shardingCfg := srv.sharding.ShardingCfg()
@@ -73,6 +74,7 @@ func (srv *Service) MetricsDBStats(ctx context.Context, out *entity.ListResp) er
 }
 
 func (srv *Service) MetricsCollStats(ctx context.Context, in *entity.MetricsCollStatsReq, out *entity.ListResp) error {
+	defer observeQuery("coll_stats", time.Now())
 	uri := ""
 	mainCfg := srv.sharding.MainCfg()
 	shardingCfg := srv.sharding.ShardingCfg()
@@ -124,6 +126,7 @@ func (srv *Service) MetricsCollStats(ctx context.Context, in *entity.MetricsColl
 }
 
 func (srv *Service) MetricsModuleList(ctx context.Context, in *entity.MetricsModuleListReq, out *entity.ListResp) error {
+	defer observeQuery("module_metrics_list", time.Now())
 	y, m, d := time.Unix(in.DateTsSec, 0).Date()
 	date := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
 
@@ -166,6 +169,7 @@ func (srv *Service) MetricsModuleList(ctx context.Context, in *entity.MetricsMod
 }
 
 func (srv *Service) MetricsModuleTrend(ctx context.Context, in *entity.MetricsModuleTrendReq, out *entity.MetricsModuleTrendResp) error {
+	defer observeQuery("module_metrics_trend", time.Now())
 	now := time.Now()
 	lastDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, -in.LastDay)
 	filter := bson.M{
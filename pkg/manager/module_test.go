@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+// bindPut 与接口相同的方式绑定 PUT 请求
+func bindPut(t *testing.T, body string, in interface{}) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("PUT", "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	if err := c.ShouldBind(in); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func bindUpdateModule(t *testing.T, body string) *entity.UpdateModuleReq {
+	in := &entity.UpdateModuleReq{}
+	bindPut(t, body, in)
+	return in
+}
+
+// 旧版本页面只传入名称、描述与分片，其他配置保持不变
+func TestModuleUpdateKeepsOmittedFields(t *testing.T) {
+	doc := &model.Module{
+		ShardingIndex:  1,
+		Desc:           "order",
+		Decoder:        model.ModuleDecoder{Type: "logfmt"},
+		Quota:          model.ModuleQuota{LinesPerSec: 100},
+		FullText:       true,
+		StructuredFull: true,
+		PatternMining:  true,
+	}
+	in := bindUpdateModule(t, `{"id":"5f7c2a9b1c9d440000a1b2c3","shardingIndex":1,"desc":"order service"}`)
+	update, err := moduleUpdate(doc, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := update["$set"].(bson.M)
+	if fields["desc"] != "order service" {
+		t.Fatal(fields)
+	}
+	for _, k := range []string{"decoder", "quota", "full_text", "structured_full", "pattern_mining"} {
+		if _, ok := fields[k]; ok {
+			t.Fatalf("%s should be kept: %v", k, fields)
+		}
+	}
+
+	in = bindUpdateModule(t, `{"id":"5f7c2a9b1c9d440000a1b2c3","shardingIndex":1,"desc":"order","decoder":{},"patternMining":false}`)
+	update, err = moduleUpdate(doc, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := update["$set"].(bson.M); fields["decoder"] == nil || fields["pattern_mining"] != false {
+		t.Fatal(update)
+	}
+}
@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+)
+
+// FindTopPattern 时间范围内数量最多的模板，按小时统计，开始时间向前对齐到整点
+func (srv *Service) FindTopPattern(ctx context.Context, in *entity.FindTopPatternReq, out *entity.ListResp) error {
+	b, e := in.InitTimeSection(24 * time.Hour)
+	b = b.Truncate(time.Hour)
+	limit := in.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+	pipeline := []bson.M{
+		{"$match": bson.M{"module_name": in.ModuleName, "hour": bson.M{"$gte": b, "$lt": e}}},
+		{"$group": bson.M{"_id": "$pattern_id", "count": bson.M{"$sum": "$count"}}},
+		{"$sort": bson.M{"count": -1}},
+		{"$limit": limit},
+	}
+	groups := make([]struct {
+		ID    string `bson:"_id"`
+		Count int64  `bson:"count"`
+	}, 0)
+	if err := srv.store.AggregateLoggingPatternStats(ctx, pipeline, &groups); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+
+	ids := make([]string, 0, len(groups))
+	for _, v := range groups {
+		ids = append(ids, v.ID)
+	}
+	docs, err := srv.store.FindLoggingPattern(ctx, bson.M{"module_name": in.ModuleName, "pattern_id": bson.M{"$in": ids}})
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+
+	list := make([]*entity.TopPattern, 0, len(groups))
+	for _, g := range groups {
+		d := &entity.TopPattern{PatternID: g.ID, Count: g.Count, SampleIDs: []string{}}
+		for _, v := range docs {
+			if v.PatternID != g.ID {
+				continue
+			}
+			d.Template = v.Template
+			d.TotalCount = v.Count
+			d.FirstSeenTsSec = v.FirstSeen.Unix()
+			d.LastSeenTsSec = v.LastSeen.Unix()
+			d.SampleIDs = v.SampleIDs
+		}
+		list = append(list, d)
+	}
+	out.Count = int64(len(list))
+	out.List = list
+	return nil
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/pipeline"
+)
+
+// 写入处理规则，receiver 定时同步
+
+func (srv *Service) FindProcessorList(ctx context.Context, in *entity.FindProcessorListReq, out *entity.ListResp) error {
+	filter := bson.M{}
+	if in.ModuleName != "" {
+		filter["module_name"] = primitive.Regex{
+			Pattern: in.ModuleName,
+			Options: "i",
+		}
+	}
+	if in.Enable > 0 {
+		filter["enable"] = in.Enable == 1
+	}
+
+	opt := options.Find()
+	in.SetPage(opt)
+	opt.SetSort(bson.D{{Key: "module_name", Value: 1}, {Key: "sort", Value: 1}})
+	docs := make([]*model.Processor, 0, in.Limit)
+	c, err := srv.store.FindProcessorList(ctx, filter, &docs, opt)
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+
+	out.Count = c
+	list := make([]*entity.FindProcessorList, 0, len(docs))
+	for _, v := range docs {
+		list = append(list, &entity.FindProcessorList{
+			ID:           v.ID.Hex(),
+			Enable:       v.Enable,
+			ModuleName:   v.ModuleName,
+			Sort:         v.Sort,
+			Type:         v.Type,
+			Field:        v.Field,
+			Target:       v.Target,
+			Pattern:      v.Pattern,
+			Value:        v.Value,
+			Rate:         v.Rate,
+			MaxLen:       v.MaxLen,
+			UpdatedTsSec: v.UpdatedAt.Unix(),
+		})
+	}
+	out.List = list
+	return nil
+}
+
+func (srv *Service) CreateProcessor(ctx context.Context, in *entity.CreateProcessorReq) error {
+	doc := &model.Processor{
+		Enable:     true,
+		ModuleName: in.ModuleName,
+		Sort:       in.Sort,
+		Type:       in.Type,
+		Field:      in.Field,
+		Target:     in.Target,
+		Pattern:    in.Pattern,
+		Value:      in.Value,
+		Rate:       in.Rate,
+		MaxLen:     in.MaxLen,
+		UpdatedAt:  time.Now().Local(),
+	}
+	if _, err := pipeline.New(doc); err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+
+	if err := srv.store.InsertProcessor(ctx, doc); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	return nil
+}
+
+func (srv *Service) UpdateProcessor(ctx context.Context, in *entity.UpdateProcessorReq) error {
+	id, err := in.ObjectID()
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+
+	doc := &model.Processor{}
+	if ok, err := srv.store.FindOneProcessor(ctx, bson.M{"_id": id}, doc); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	} else if !ok {
+		return httputil.ErrNotFound
+	}
+	next := *doc
+	next.Enable = in.Enable
+	next.Sort = in.Sort
+	next.Type = in.Type
+	next.Field = in.Field
+	next.Target = in.Target
+	next.Pattern = in.Pattern
+	next.Value = in.Value
+	next.Rate = in.Rate
+	next.MaxLen = in.MaxLen
+	if next == *doc {
+		return nil
+	}
+	if _, err := pipeline.New(&next); err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"enable":     next.Enable,
+			"sort":       next.Sort,
+			"type":       next.Type,
+			"field":      next.Field,
+			"target":     next.Target,
+			"pattern":    next.Pattern,
+			"value":      next.Value,
+			"rate":       next.Rate,
+			"max_len":    next.MaxLen,
+			"updated_at": time.Now().Local(),
+		},
+	}
+	filter := bson.M{
+		"_id":        id,
+		"updated_at": doc.UpdatedAt,
+	}
+	if err := srv.store.UpdateProcessor(ctx, filter, update); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	return nil
+}
+
+func (srv *Service) DeleteProcessor(ctx context.Context, in *entity.DeleteProcessorReq) error {
+	id, err := in.ObjectID()
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+	if err := srv.store.DeleteProcessor(ctx, id); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package manager
+
+import (
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/prom"
+)
+
+var promQueryDuration = prom.NewHistogramVec("qelog_manager_query_duration_seconds",
+	"Manager query latency by query name.", []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}, "query")
+
+// observeQuery 使用 defer observeQuery("name", time.Now()) 记录查询耗时
+func observeQuery(name string, start time.Time) {
+	promQueryDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+}
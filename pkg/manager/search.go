@@ -0,0 +1,261 @@
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+const (
+	shortIDAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	shortIDLength   = 8
+	// 分享链接的时间范围
+	maxShareSection = 7 * 24 * time.Hour
+)
+
+// FindSavedSearchList 自己的查询与其他人共享的查询，不包括分享链接
+func (srv *Service) FindSavedSearchList(ctx context.Context, owner string, in *entity.FindSavedSearchListReq, out *entity.ListResp) error {
+	filter := bson.M{
+		"temporary": false,
+		"$or":       bson.A{bson.M{"owner": owner}, bson.M{"shared": true}},
+	}
+	if in.Name != "" {
+		filter["name"] = primitive.Regex{
+			Pattern: in.Name,
+			Options: "i",
+		}
+	}
+
+	opt := options.Find()
+	in.SetPage(opt)
+	opt.SetSort(bson.M{"updated_at": -1})
+	docs := make([]*model.SavedSearch, 0, in.Limit)
+	c, err := srv.store.FindSavedSearchList(ctx, filter, &docs, opt)
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+
+	out.Count = c
+	list := make([]*entity.FindSavedSearchList, 0, len(docs))
+	for _, v := range docs {
+		list = append(list, &entity.FindSavedSearchList{
+			ID:           v.ID.Hex(),
+			ShortID:      v.ShortID,
+			Name:         v.Name,
+			Owner:        v.Owner,
+			Shared:       v.Shared,
+			Filter:       searchFilterEntity(v.Filter),
+			RelativeSec:  v.RelativeSec,
+			UpdatedTsSec: v.UpdatedAt.Unix(),
+		})
+	}
+	out.List = list
+	return nil
+}
+
+func (srv *Service) CreateSavedSearch(ctx context.Context, owner string, in *entity.CreateSavedSearchReq) error {
+	shortID, err := newShortID()
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	now := time.Now().Local()
+	doc := &model.SavedSearch{
+		ShortID:     shortID,
+		Name:        in.Name,
+		Owner:       owner,
+		Shared:      in.Shared,
+		Filter:      searchFilterModel(&in.Filter),
+		RelativeSec: in.RelativeSec,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := srv.store.InsertSavedSearch(ctx, doc); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	return nil
+}
+
+// UpdateSavedSearch 只有创建者可以修改
+func (srv *Service) UpdateSavedSearch(ctx context.Context, owner string, in *entity.UpdateSavedSearchReq) error {
+	id, err := in.ObjectID()
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+	filter := bson.M{"_id": id, "owner": owner, "temporary": false}
+	update := bson.M{
+		"$set": bson.M{
+			"name":         in.Name,
+			"shared":       in.Shared,
+			"filter":       searchFilterModel(&in.Filter),
+			"relative_sec": in.RelativeSec,
+			"updated_at":   time.Now().Local(),
+		},
+	}
+	if err := srv.store.UpdateSavedSearch(ctx, filter, update); err != nil {
+		if err == storage.ErrNotMatched {
+			return httputil.ErrNotFound
+		}
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	return nil
+}
+
+// DeleteSavedSearch 只有创建者可以删除，已关联的报警规则保留复制的条件
+func (srv *Service) DeleteSavedSearch(ctx context.Context, owner string, in *entity.DeleteSavedSearchReq) error {
+	id, err := in.ObjectID()
+	if err != nil {
+		return httputil.ErrArgsInvalid.MergeError(err)
+	}
+	if err := srv.store.DeleteSavedSearch(ctx, bson.M{"_id": id, "owner": owner, "temporary": false}); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	return nil
+}
+
+// CreateShareLink 分享保存的查询时直接使用其短 ID，分享当前条件时保存为临时链接，按绝对时间查询
+func (srv *Service) CreateShareLink(ctx context.Context, owner string, in *entity.CreateShareLinkReq, out *entity.CreateShareLinkResp) error {
+	if in.SavedSearchID != "" {
+		doc, err := srv.findSavedSearch(ctx, owner, in.SavedSearchID)
+		if err != nil {
+			return err
+		}
+		out.ShortID = doc.ShortID
+		return nil
+	}
+
+	b, e := in.InitTimeSection(time.Hour)
+	if !e.After(b) || e.Sub(b) > maxShareSection {
+		return httputil.ErrArgsInvalid.MergeString("时间范围不能超过 7 天")
+	}
+	shortID, err := newShortID()
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	now := time.Now().Local()
+	doc := &model.SavedSearch{
+		ShortID:    shortID,
+		Owner:      owner,
+		Shared:     true,
+		Filter:     searchFilterModel(in.Filter),
+		BeginTsSec: b.Unix(),
+		EndTsSec:   e.Unix(),
+		Temporary:  true,
+		SharedAt:   now,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := srv.store.InsertSavedSearch(ctx, doc); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	out.ShortID = shortID
+	return nil
+}
+
+// ResolveShareLink 返回具体的查询条件，保存的查询按 atTsSec 计算时间范围
+func (srv *Service) ResolveShareLink(ctx context.Context, in *entity.ResolveShareLinkReq, out *entity.ResolveShareLinkResp) error {
+	doc := &model.SavedSearch{}
+	if ok, err := srv.store.FindOneSavedSearch(ctx, bson.M{"short_id": in.ShortID}, doc); err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	} else if !ok {
+		return httputil.ErrNotFound
+	}
+
+	out.Name = doc.Name
+	out.Temporary = doc.Temporary
+	out.Filter = searchFilterEntity(doc.Filter)
+	if doc.Temporary {
+		out.BeginTsSec, out.EndTsSec = doc.BeginTsSec, doc.EndTsSec
+		return nil
+	}
+	at := in.AtTsSec
+	if at <= 0 {
+		at = time.Now().Unix()
+	}
+	out.BeginTsSec, out.EndTsSec = at-doc.RelativeSec, at
+	return nil
+}
+
+// findSavedSearch 自己的查询或者共享的查询
+func (srv *Service) findSavedSearch(ctx context.Context, owner, hexID string) (*model.SavedSearch, error) {
+	id, err := primitive.ObjectIDFromHex(hexID)
+	if err != nil {
+		return nil, httputil.ErrArgsInvalid.MergeError(err)
+	}
+	doc := &model.SavedSearch{}
+	filter := bson.M{
+		"_id":       id,
+		"temporary": false,
+		"$or":       bson.A{bson.M{"owner": owner}, bson.M{"shared": true}},
+	}
+	if ok, err := srv.store.FindOneSavedSearch(ctx, filter, doc); err != nil {
+		return nil, httputil.ErrSystemException.MergeError(err)
+	} else if !ok {
+		return nil, httputil.ErrNotFound
+	}
+	return doc, nil
+}
+
+func newShortID() (string, error) {
+	b := make([]byte, shortIDLength)
+	max := big.NewInt(int64(len(shortIDAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = shortIDAlphabet[n.Int64()]
+	}
+	return string(b), nil
+}
+
+func searchFilterModel(v *entity.SearchFilter) model.SearchFilter {
+	f := model.SearchFilter{
+		ShardingIndex:  v.ShardingIndex,
+		ModuleName:     v.ModuleName,
+		Level:          v.Level,
+		Short:          v.Short,
+		IP:             v.IP,
+		ConditionOne:   v.ConditionOne,
+		ConditionTwo:   v.ConditionTwo,
+		ConditionThree: v.ConditionThree,
+		Keyword:        v.Keyword,
+		Fields:         make([]model.SearchField, 0, len(v.Fields)),
+		PatternID:      v.PatternID,
+		Query:          v.Query,
+	}
+	for _, p := range v.Fields {
+		f.Fields = append(f.Fields, model.SearchField{Key: p.Key, Op: p.Op, Value: p.Value})
+	}
+	return f
+}
+
+func searchFilterEntity(v model.SearchFilter) *entity.SearchFilter {
+	f := &entity.SearchFilter{
+		ShardingIndex:  v.ShardingIndex,
+		ModuleName:     v.ModuleName,
+		Level:          v.Level,
+		Short:          v.Short,
+		IP:             v.IP,
+		ConditionOne:   v.ConditionOne,
+		ConditionTwo:   v.ConditionTwo,
+		ConditionThree: v.ConditionThree,
+		Keyword:        v.Keyword,
+		Fields:         make([]entity.FieldPredicate, 0, len(v.Fields)),
+		PatternID:      v.PatternID,
+		Query:          v.Query,
+	}
+	for _, p := range v.Fields {
+		f.Fields = append(f.Fields, entity.FieldPredicate{Key: p.Key, Op: p.Op, Value: p.Value})
+	}
+	return f
+}
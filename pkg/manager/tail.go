@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/manager/tail"
+)
+
+var (
+	tailHubOnce sync.Once
+	tailHub     *tail.Hub
+)
+
+// getTailHub HTTP 与 gRPC 共用订阅数限制与监听
+func getTailHub() *tail.Hub {
+	tailHubOnce.Do(func() {
+		tailHub = tail.NewHub(config.Global.Tail.MaxSubscribers)
+	})
+	return tailHub
+}
+
+// TailLogging 订阅结束后需要调用 StopTailLogging
+func (srv *Service) TailLogging(in *entity.TailLoggingReq) (*tail.Subscriber, error) {
+	store, err := srv.sharding.GetStore(in.ShardingIndex)
+	if err != nil {
+		return nil, httputil.ErrArgsInvalid.MergeError(err)
+	}
+	var level *model.Level
+	if in.Level != nil {
+		v := model.Level(*in.Level)
+		level = &v
+	}
+	filter, err := tail.NewFilter(strings.TrimSpace(in.ModuleName), level, in.Short, in.IP)
+	if err != nil {
+		return nil, httputil.ErrArgsInvalid.MergeError(err)
+	}
+
+	cfg := config.Global.Tail
+	opt := tail.Options{Buffer: cfg.Buffer, RatePerSec: cfg.RatePerSec}
+	if in.Rate > 0 && (opt.RatePerSec <= 0 || in.Rate < opt.RatePerSec) {
+		opt.RatePerSec = in.Rate
+	}
+	s, err := getTailHub().Subscribe(store, filter, opt)
+	if err != nil {
+		return nil, httputil.ErrThrottled.MergeError(err)
+	}
+	return s, nil
+}
+
+func (srv *Service) StopTailLogging(s *tail.Subscriber) {
+	getTailHub().Unsubscribe(s)
+}
+
+func tailLoggingEntity(v *model.Logging) *entity.FindLoggingList {
+	return &entity.FindLoggingList{
+		ID:             v.ID.Hex(),
+		TsMill:         v.TimeMill,
+		Level:          int32(v.Level),
+		Short:          v.Short,
+		Full:           v.FullString(),
+		ConditionOne:   v.Condition1,
+		ConditionTwo:   v.Condition2,
+		ConditionThree: v.Condition3,
+		IP:             v.IP,
+		TraceID:        v.TraceID,
+	}
+}
@@ -0,0 +1,91 @@
+package tail
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	// 注册默认的 proto 编码
+	_ "google.golang.org/grpc/encoding/proto"
+)
+
+// 实时日志 gRPC 服务，服务端流式推送，消息定义见 proto.go
+// service Tail {
+//   rpc Subscribe(SubscribeRequest) returns (stream LogEntry);
+// }
+
+const ServiceName = "qelog.manager.Tail"
+
+type TailServer interface {
+	Subscribe(in *SubscribeRequest, stream SubscribeServer) error
+}
+
+type SubscribeServer interface {
+	Send(*LogEntry) error
+	grpc.ServerStream
+}
+
+func RegisterTailServer(s *grpc.Server, srv TailServer) {
+	s.RegisterService(&tailServiceDesc, srv)
+}
+
+var tailServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*TailServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       subscribeHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "qelog/manager/tail.proto",
+}
+
+func subscribeHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(SubscribeRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(TailServer).Subscribe(in, &subscribeServer{stream})
+}
+
+type subscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *subscribeServer) Send(m *LogEntry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Codec 通过 grpc.CustomCodec 设置到服务端
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	switch val := v.(type) {
+	case *LogEntry:
+		return MarshalLogEntry(val), nil
+	}
+	return protoCodec().Marshal(v)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	switch val := v.(type) {
+	case *SubscribeRequest:
+		return UnmarshalSubscribeRequest(data, val)
+	}
+	return protoCodec().Unmarshal(data, v)
+}
+
+func (Codec) String() string {
+	return "proto"
+}
+
+func protoCodec() encoding.Codec {
+	codec := encoding.GetCodec("proto")
+	if codec == nil {
+		panic(fmt.Sprintf("grpc codec %s unregistered", "proto"))
+	}
+	return codec
+}
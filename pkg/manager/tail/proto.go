@@ -0,0 +1,152 @@
+package tail
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var ErrInvalidProto = errors.New("tail invalid protobuf")
+
+//	message SubscribeRequest {
+//	  int32 sharding_index = 1;
+//	  string module_name = 2;
+//	  optional int32 level = 3;
+//	  string short = 4;
+//	  string ip = 5;
+//	  int32 rate = 6;
+//	}
+type SubscribeRequest struct {
+	ShardingIndex int32
+	ModuleName    string
+	// 为 nil 表示所有等级
+	Level *int32
+	Short string
+	IP    string
+	Rate  int32
+}
+
+//	message LogEntry {
+//	  string id = 1;
+//	  int64 ts_mill = 2;
+//	  int32 level = 3;
+//	  string short = 4;
+//	  string full = 5;
+//	  string condition_one = 6;
+//	  string condition_two = 7;
+//	  string condition_three = 8;
+//	  string trace_id = 9;
+//	  string ip = 10;
+//	  uint64 dropped = 11;
+//	}
+type LogEntry struct {
+	ID             string
+	TsMill         int64
+	Level          int32
+	Short          string
+	Full           string
+	ConditionOne   string
+	ConditionTwo   string
+	ConditionThree string
+	TraceID        string
+	IP             string
+	// 订阅开始后累计丢弃的条数
+	Dropped uint64
+}
+
+func UnmarshalSubscribeRequest(b []byte, req *SubscribeRequest) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		b = b[n:]
+		switch {
+		case typ == protowire.VarintType && (num == 1 || num == 3 || num == 6):
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return ErrInvalidProto
+			}
+			b = b[n:]
+			switch num {
+			case 1:
+				req.ShardingIndex = int32(v)
+			case 3:
+				level := int32(v)
+				req.Level = &level
+			case 6:
+				req.Rate = int32(v)
+			}
+		case typ == protowire.BytesType && (num == 2 || num == 4 || num == 5):
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return ErrInvalidProto
+			}
+			b = b[n:]
+			switch num {
+			case 2:
+				req.ModuleName = string(v)
+			case 4:
+				req.Short = string(v)
+			case 5:
+				req.IP = string(v)
+			}
+		default:
+			// 未知字段跳过
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return ErrInvalidProto
+			}
+			b = b[n:]
+		}
+	}
+	return nil
+}
+
+// MarshalSubscribeRequest 客户端使用
+func MarshalSubscribeRequest(req *SubscribeRequest) []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(req.ShardingIndex))
+	b = appendString(b, 2, req.ModuleName)
+	if req.Level != nil {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*req.Level))
+	}
+	b = appendString(b, 4, req.Short)
+	b = appendString(b, 5, req.IP)
+	b = appendVarint(b, 6, uint64(req.Rate))
+	return b
+}
+
+func MarshalLogEntry(e *LogEntry) []byte {
+	var b []byte
+	b = appendString(b, 1, e.ID)
+	b = appendVarint(b, 2, uint64(e.TsMill))
+	b = appendVarint(b, 3, uint64(e.Level))
+	b = appendString(b, 4, e.Short)
+	b = appendString(b, 5, e.Full)
+	b = appendString(b, 6, e.ConditionOne)
+	b = appendString(b, 7, e.ConditionTwo)
+	b = appendString(b, 8, e.ConditionThree)
+	b = appendString(b, 9, e.TraceID)
+	b = appendString(b, 10, e.IP)
+	b = appendVarint(b, 11, e.Dropped)
+	return b
+}
+
+// 默认值不写入，与 proto3 一致
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
@@ -0,0 +1,295 @@
+package tail
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// 实时查看模块写入的日志
+// 每个分片实例只监听一个 change stream，按订阅的条件分发
+// 每个订阅有独立的缓冲与速率限制，客户端读取慢或超出速率时丢弃并计数，不影响其他订阅
+
+var (
+	ErrTooManySubscribers = errors.New("tail too many subscribers")
+	ErrWatchStopped       = errors.New("tail watch stopped")
+)
+
+type Filter struct {
+	ModuleName string
+	// 为 nil 表示所有等级
+	Level *model.Level
+	// 短消息正则，不区分大小写
+	Short *regexp.Regexp
+	IP    string
+}
+
+// NewFilter short 为空时不过滤短消息
+func NewFilter(moduleName string, level *model.Level, short, ip string) (Filter, error) {
+	f := Filter{ModuleName: moduleName, Level: level, IP: ip}
+	if short != "" {
+		re, err := regexp.Compile("(?i)" + short)
+		if err != nil {
+			return f, err
+		}
+		f.Short = re
+	}
+	return f, nil
+}
+
+func (f Filter) match(doc *model.Logging) bool {
+	if doc.Module != f.ModuleName {
+		return false
+	}
+	if f.Level != nil && doc.Level != *f.Level {
+		return false
+	}
+	if f.IP != "" && doc.IP != f.IP {
+		return false
+	}
+	if f.Short != nil && !f.Short.MatchString(doc.Short) {
+		return false
+	}
+	return true
+}
+
+type Subscriber struct {
+	filter  Filter
+	ch      chan *model.Logging
+	bucket  *tokenBucket
+	dropped uint64
+	watcher *watcher
+
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// C 订阅结束后不再写入，通过 Done 判断是否结束
+func (s *Subscriber) C() <-chan *model.Logging {
+	return s.ch
+}
+
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 监听出错结束时返回原因
+func (s *Subscriber) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Dropped 缓冲已满或超出速率丢弃的条数
+func (s *Subscriber) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscriber) offer(doc *model.Logging) {
+	if !s.filter.match(doc) {
+		return
+	}
+	if !s.bucket.take() {
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
+	select {
+	case s.ch <- doc:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+}
+
+func (s *Subscriber) stop(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
+
+type Options struct {
+	// 每个订阅的缓冲条数
+	Buffer int
+	// 每个订阅每秒最多推送的条数
+	RatePerSec int
+}
+
+type Hub struct {
+	mutex          sync.Mutex
+	watchers       map[*storage.Store]*watcher
+	subscribers    int
+	maxSubscribers int
+}
+
+func NewHub(maxSubscribers int) *Hub {
+	return &Hub{
+		watchers:       make(map[*storage.Store]*watcher),
+		maxSubscribers: maxSubscribers,
+	}
+}
+
+// Subscribe 订阅结束后需要调用 Unsubscribe
+func (h *Hub) Subscribe(store *storage.Store, filter Filter, opt Options) (*Subscriber, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.maxSubscribers > 0 && h.subscribers >= h.maxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+	w, ok := h.watchers[store]
+	if !ok {
+		w = newWatcher(h, store)
+		h.watchers[store] = w
+		go w.run()
+	}
+	s := &Subscriber{
+		filter: filter,
+		ch:     make(chan *model.Logging, opt.Buffer),
+		bucket: newTokenBucket(float64(opt.RatePerSec)),
+		done:   make(chan struct{}),
+	}
+	s.watcher = w
+	w.add(s)
+	h.subscribers++
+	return s, nil
+}
+
+// Unsubscribe 最后一个订阅退出时停止监听
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !s.watcher.remove(s) {
+		return
+	}
+	h.subscribers--
+	s.stop(nil)
+	if s.watcher.empty() {
+		s.watcher.cancel()
+		if h.watchers[s.watcher.store] == s.watcher {
+			delete(h.watchers, s.watcher.store)
+		}
+	}
+}
+
+// watcherStopped 监听出错，结束所有订阅，客户端重新订阅时重新监听
+func (h *Hub) watcherStopped(w *watcher, err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.watchers[w.store] == w {
+		delete(h.watchers, w.store)
+	}
+	for _, s := range w.all() {
+		s.stop(err)
+	}
+}
+
+type watcher struct {
+	hub    *Hub
+	store  *storage.Store
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex       sync.RWMutex
+	subscribers map[*Subscriber]struct{}
+}
+
+func newWatcher(h *Hub, store *storage.Store) *watcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &watcher{
+		hub:         h,
+		store:       store,
+		ctx:         ctx,
+		cancel:      cancel,
+		subscribers: make(map[*Subscriber]struct{}),
+	}
+}
+
+func (w *watcher) run() {
+	err := w.store.WatchLogging(w.ctx, func(doc *model.Logging) {
+		w.mutex.RLock()
+		for s := range w.subscribers {
+			s.offer(doc)
+		}
+		w.mutex.RUnlock()
+	})
+	if w.ctx.Err() != nil {
+		return
+	}
+	if err == nil {
+		err = ErrWatchStopped
+	}
+	logs.Qezap.Error("TailWatch", zap.String("database", w.store.Database().Name()), zap.Error(err))
+	w.hub.watcherStopped(w, err)
+}
+
+func (w *watcher) add(s *Subscriber) {
+	w.mutex.Lock()
+	w.subscribers[s] = struct{}{}
+	w.mutex.Unlock()
+}
+
+func (w *watcher) remove(s *Subscriber) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, ok := w.subscribers[s]; !ok {
+		return false
+	}
+	delete(w.subscribers, s)
+	return true
+}
+
+func (w *watcher) empty() bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return len(w.subscribers) == 0
+}
+
+func (w *watcher) all() []*Subscriber {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	out := make([]*Subscriber, 0, len(w.subscribers))
+	for s := range w.subscribers {
+		out = append(out, s)
+	}
+	return out
+}
+
+// tokenBucket 容量为一秒的速率，只有分发协程调用
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+func (b *tokenBucket) take() bool {
+	if b.rate <= 0 {
+		return true
+	}
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
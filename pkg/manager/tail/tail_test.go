@@ -0,0 +1,71 @@
+package tail
+
+import (
+	"testing"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+func TestSubscriber_Offer(t *testing.T) {
+	lvl := model.Level(3)
+	f, err := NewFilter("example", &lvl, "timeout", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Subscriber{
+		filter: f,
+		ch:     make(chan *model.Logging, 2),
+		bucket: newTokenBucket(100),
+		done:   make(chan struct{}),
+	}
+	s.offer(&model.Logging{Module: "other", Level: 3, Short: "timeout"})
+	s.offer(&model.Logging{Module: "example", Level: 2, Short: "timeout"})
+	s.offer(&model.Logging{Module: "example", Level: 3, Short: "ok"})
+	if len(s.ch) != 0 || s.Dropped() != 0 {
+		t.Fatal("filter not applied")
+	}
+	for i := 0; i < 3; i++ {
+		s.offer(&model.Logging{Module: "example", Level: 3, Short: "Read Timeout"})
+	}
+	if len(s.ch) != 2 || s.Dropped() != 1 {
+		t.Fatal(len(s.ch), s.Dropped())
+	}
+
+	// 超出速率
+	s.ch = make(chan *model.Logging, 10)
+	s.bucket = newTokenBucket(2)
+	for i := 0; i < 5; i++ {
+		s.offer(&model.Logging{Module: "example", Level: 3, Short: "timeout"})
+	}
+	if len(s.ch) != 2 || s.Dropped() != 4 {
+		t.Fatal(len(s.ch), s.Dropped())
+	}
+
+	if _, err := NewFilter("example", nil, "(", ""); err == nil {
+		t.Fatal("expected regexp error")
+	}
+}
+
+func TestSubscribeRequest_Proto(t *testing.T) {
+	level := int32(0)
+	in := &SubscribeRequest{ShardingIndex: 2, ModuleName: "example", Level: &level, Short: "timeout", Rate: 10}
+	out := &SubscribeRequest{}
+	if err := UnmarshalSubscribeRequest(MarshalSubscribeRequest(in), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ShardingIndex != 2 || out.ModuleName != "example" || out.Level == nil || *out.Level != 0 ||
+		out.Short != "timeout" || out.IP != "" || out.Rate != 10 {
+		t.Fatalf("%+v", out)
+	}
+
+	out = &SubscribeRequest{}
+	if err := UnmarshalSubscribeRequest(MarshalSubscribeRequest(&SubscribeRequest{ModuleName: "example"}), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Level != nil {
+		t.Fatal("level should be nil")
+	}
+	if err := UnmarshalSubscribeRequest([]byte{0x0a, 0x05, 'a'}, out); err == nil {
+		t.Fatal("expected invalid proto")
+	}
+}
@@ -0,0 +1,174 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	apiTypes "github.com/huzhongqing/qelog/api/types"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/entity"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+const (
+	// 一次调用最多返回的日志数
+	maxTraceLogging = 10000
+	// 传入时间时最大的时间范围
+	maxTraceSection = 24 * time.Hour
+)
+
+// FindTrace 在所有模块当前与历史分片索引的集合中并发查找同一个 TraceID
+// 只使用 ti 索引，不需要模块名
+func (srv *Service) FindTrace(ctx context.Context, in *entity.FindTraceReq, out *entity.FindTraceResp) error {
+	defer observeQuery("trace", time.Now())
+	var b, e time.Time
+	if in.BeginTsSec > 0 || in.EndTsSec > 0 {
+		b, e = in.InitTimeSection(2 * time.Hour)
+		if e.Sub(b) > maxTraceSection {
+			return httputil.ErrArgsInvalid.MergeString("时间范围不能超过 24 小时")
+		}
+	} else {
+		// qelog 生成的 TraceID 包含时间，其他格式需要传入时间
+		tid, err := apiTypes.TraceIDFromHex(in.TraceID)
+		if err != nil {
+			return httputil.ErrArgsInvalid.MergeString("TraceID 不包含时间，需要传入时间范围")
+		}
+		b = tid.Time().Add(-2 * time.Hour)
+		e = tid.Time().Add(2 * time.Hour)
+	}
+
+	modules, err := srv.store.FindAllModule(ctx)
+	if err != nil {
+		return httputil.ErrSystemException.MergeError(err)
+	}
+	indexes := make(map[int]struct{})
+	for _, m := range modules {
+		indexes[m.ShardingIndex] = struct{}{}
+		for _, v := range m.HistoryShardingIndex {
+			indexes[v] = struct{}{}
+		}
+	}
+	targets := make([]loggingTarget, 0)
+	for index := range indexes {
+		store, err := srv.sharding.GetStore(index)
+		if err != nil {
+			// 历史索引的实例可能已经移除
+			continue
+		}
+		for _, name := range srv.lcn.ScopeNames(index, b.Unix(), e.Unix()) {
+			targets = append(targets, loggingTarget{store: store, name: name})
+		}
+	}
+
+	filter := bson.M{
+		"ti": in.TraceID,
+		"ts": bson.M{"$gte": b.Unix(), "$lt": e.Unix()},
+	}
+	var (
+		wg    sync.WaitGroup
+		lists = make([][]*model.Logging, len(targets))
+		errs  = make([]error, len(targets))
+	)
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t loggingTarget) {
+			defer wg.Done()
+			opt := options.Find().SetSort(bson.M{"tm": 1}).SetLimit(maxTraceLogging + 1).SetProjection(bson.M{"tk": 0})
+			lists[i] = make([]*model.Logging, 0)
+			errs[i] = t.store.FindLogging(ctx, t.name, filter, &lists[i], opt)
+		}(i, t)
+	}
+	wg.Wait()
+
+	docs := make([]*model.Logging, 0)
+	for i := range targets {
+		if errs[i] != nil {
+			return httputil.ErrSystemException.MergeError(errs[i])
+		}
+		docs = append(docs, lists[i]...)
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		if docs[i].TimeMill != docs[j].TimeMill {
+			return docs[i].TimeMill < docs[j].TimeMill
+		}
+		return bytes.Compare(docs[i].ID[:], docs[j].ID[:]) < 0
+	})
+	// 过滤掉重复写入的数据
+	hitMap := map[string]struct{}{}
+	unique := docs[:0]
+	for _, v := range docs {
+		if _, ok := hitMap[v.MessageID]; ok {
+			continue
+		}
+		hitMap[v.MessageID] = struct{}{}
+		unique = append(unique, v)
+	}
+	docs = unique
+	if len(docs) > maxTraceLogging {
+		docs = docs[:maxTraceLogging]
+		out.Truncated = true
+	}
+
+	out.TraceID = in.TraceID
+	out.Count = int64(len(docs))
+	out.Modules = traceModules(docs)
+	out.Spans = traceSpans(types.BuildSpanTree(docs))
+	out.List = make([]*entity.TraceLogging, 0, len(docs))
+	for _, v := range docs {
+		d := &entity.TraceLogging{FindLoggingList: *loggingEntity(v), ModuleName: v.Module}
+		d.SpanID, d.ParentSpanID = types.TraceSpanIDs(v)
+		out.List = append(out.List, d)
+	}
+	if len(docs) > 0 {
+		out.StartTsMill = docs[0].TimeMill
+		out.EndTsMill = docs[len(docs)-1].TimeMill
+		out.DurationMill = out.EndTsMill - out.StartTsMill
+	}
+	return nil
+}
+
+// traceModules 按模块第一条日志的时间排序
+func traceModules(docs []*model.Logging) []*entity.TraceModule {
+	out := make([]*entity.TraceModule, 0)
+	index := make(map[string]*entity.TraceModule)
+	for _, v := range docs {
+		m, ok := index[v.Module]
+		if !ok {
+			m = &entity.TraceModule{ModuleName: v.Module, StartTsMill: v.TimeMill}
+			index[v.Module] = m
+			out = append(out, m)
+		}
+		m.Count++
+		if v.Level >= model.Level(2) {
+			m.ErrorCount++
+		}
+		m.EndTsMill = v.TimeMill
+		m.DurationMill = m.EndTsMill - m.StartTsMill
+	}
+	return out
+}
+
+func traceSpans(spans []*types.TraceSpan) []*entity.TraceSpan {
+	out := make([]*entity.TraceSpan, 0, len(spans))
+	for _, s := range spans {
+		out = append(out, &entity.TraceSpan{
+			SpanID:       s.SpanID,
+			ParentSpanID: s.ParentSpanID,
+			ModuleName:   s.Module,
+			StartTsMill:  s.StartMill,
+			EndTsMill:    s.EndMill,
+			DurationMill: s.EndMill - s.StartMill,
+			Count:        s.Count,
+			Children:     traceSpans(s.Children),
+		})
+	}
+	return out
+}
@@ -0,0 +1,241 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+// 模块写入前的处理链，按 Sort 依次执行，返回 false 表示丢弃
+
+var (
+	ErrUnknownType     = errors.New("processor unknown type")
+	ErrFieldRequired   = errors.New("processor field required")
+	ErrTargetRequired  = errors.New("processor target required")
+	ErrPatternRequired = errors.New("processor pattern required")
+	ErrRateInvalid     = errors.New("processor rate must be between 0 and 1")
+	ErrMaxLenInvalid   = errors.New("processor max_len must be greater than 0")
+)
+
+type processor func(r *record) bool
+
+// New 编译处理规则，管理端保存前也用来校验
+func New(doc *model.Processor) (processor, error) {
+	var re *regexp.Regexp
+	if doc.Pattern != "" {
+		var err error
+		if re, err = regexp.Compile(doc.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	field := doc.Field
+	if field == "" {
+		switch doc.Type {
+		case model.ProcessorDrop, model.ProcessorMask, model.ProcessorExtract:
+			field = fieldShort
+		case model.ProcessorSample:
+		default:
+			return nil, ErrFieldRequired
+		}
+	}
+
+	switch doc.Type {
+	case model.ProcessorDrop:
+		if re == nil {
+			return nil, ErrPatternRequired
+		}
+		return func(r *record) bool {
+			v, ok := r.get(field)
+			return !ok || !re.MatchString(v)
+		}, nil
+
+	case model.ProcessorSample:
+		if doc.Rate < 0 || doc.Rate > 1 {
+			return nil, ErrRateInvalid
+		}
+		rate := doc.Rate
+		return func(r *record) bool {
+			if re != nil {
+				if v, ok := r.get(fieldOr(field, fieldShort)); !ok || !re.MatchString(v) {
+					return true
+				}
+			}
+			return rand.Float64() < rate
+		}, nil
+
+	case model.ProcessorSet:
+		value := doc.Value
+		return func(r *record) bool {
+			r.set(field, value)
+			return true
+		}, nil
+
+	case model.ProcessorRename:
+		if doc.Target == "" {
+			return nil, ErrTargetRequired
+		}
+		target := doc.Target
+		return func(r *record) bool {
+			var v interface{}
+			if builtin(field) {
+				v, _ = r.get(field)
+			} else if v, _ = lookup(r.parse(), field); v == nil {
+				return true
+			}
+			r.remove(field)
+			r.set(target, v)
+			return true
+		}, nil
+
+	case model.ProcessorRemove:
+		return func(r *record) bool {
+			r.remove(field)
+			return true
+		}, nil
+
+	case model.ProcessorParseJSON:
+		target := doc.Target
+		return func(r *record) bool {
+			v, ok := r.get(field)
+			if !ok || !strings.HasPrefix(strings.TrimSpace(v), "{") {
+				return true
+			}
+			sub := make(map[string]interface{})
+			if err := json.Unmarshal([]byte(v), &sub); err != nil {
+				return true
+			}
+			if field != fieldFull {
+				r.remove(field)
+			}
+			if target != "" {
+				r.set(target, sub)
+				return true
+			}
+			for k, v := range sub {
+				r.set(k, v)
+			}
+			return true
+		}, nil
+
+	case model.ProcessorExtract:
+		if re == nil {
+			return nil, ErrPatternRequired
+		}
+		names := re.SubexpNames()
+		return func(r *record) bool {
+			v, ok := r.get(field)
+			if !ok {
+				return true
+			}
+			match := re.FindStringSubmatch(v)
+			for i, name := range names {
+				if match == nil || name == "" || match[i] == "" {
+					continue
+				}
+				r.set(name, match[i])
+			}
+			return true
+		}, nil
+
+	case model.ProcessorTruncate:
+		if doc.MaxLen <= 0 {
+			return nil, ErrMaxLenInvalid
+		}
+		max := doc.MaxLen
+		return func(r *record) bool {
+			if v, ok := r.get(field); ok && len(v) > max {
+				r.set(field, truncate(v, max))
+			}
+			return true
+		}, nil
+
+	case model.ProcessorMask:
+		if re == nil {
+			return nil, ErrPatternRequired
+		}
+		value := doc.Value
+		if value == "" {
+			value = "***"
+		}
+		return func(r *record) bool {
+			if v, ok := r.get(field); ok && re.MatchString(v) {
+				r.set(field, re.ReplaceAllString(v, value))
+			}
+			return true
+		}, nil
+	}
+	return nil, ErrUnknownType
+}
+
+func fieldOr(field, def string) string {
+	if field == "" {
+		return def
+	}
+	return field
+}
+
+func truncate(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+type Pipeline struct {
+	mutex  sync.RWMutex
+	chains map[string][]processor
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{chains: make(map[string][]processor)}
+}
+
+// InitRules docs 需按 module_name sort 排好序，编译失败的规则跳过并返回第一个错误
+func (p *Pipeline) InitRules(docs []*model.Processor) error {
+	var firstErr error
+	chains := make(map[string][]processor)
+	for _, doc := range docs {
+		fn, err := New(doc)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.New(doc.ID.Hex() + " " + err.Error())
+			}
+			continue
+		}
+		chains[doc.ModuleName] = append(chains[doc.ModuleName], fn)
+	}
+	p.mutex.Lock()
+	p.chains = chains
+	p.mutex.Unlock()
+	return firstErr
+}
+
+// Process 返回保留下来的日志，没有处理规则时原样返回
+func (p *Pipeline) Process(moduleName string, docs []*model.Logging) []*model.Logging {
+	p.mutex.RLock()
+	chain := p.chains[moduleName]
+	p.mutex.RUnlock()
+	if len(chain) == 0 {
+		return docs
+	}
+
+	out := docs[:0]
+loop:
+	for _, doc := range docs {
+		r := &record{doc: doc}
+		for _, fn := range chain {
+			if !fn(r) {
+				continue loop
+			}
+		}
+		r.flush()
+		out = append(out, doc)
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+func TestPipeline_Process(t *testing.T) {
+	p := NewPipeline()
+	err := p.InitRules([]*model.Processor{
+		{ModuleName: "a", Type: model.ProcessorDrop, Field: "path", Pattern: `^/health`},
+		{ModuleName: "a", Type: model.ProcessorParseJSON, Field: "body"},
+		{ModuleName: "a", Type: model.ProcessorRename, Field: "msg", Target: "short"},
+		{ModuleName: "a", Type: model.ProcessorExtract, Field: "short", Pattern: `user=(?P<c1>\d+)`},
+		{ModuleName: "a", Type: model.ProcessorMask, Field: "phone", Pattern: `\d{4}$`},
+		{ModuleName: "a", Type: model.ProcessorRemove, Field: "debug.detail"},
+		{ModuleName: "a", Type: model.ProcessorSet, Field: "env", Value: "prod"},
+		{ModuleName: "a", Type: model.ProcessorTruncate, Field: "short", MaxLen: 12},
+		{ModuleName: "b", Type: "unknown"},
+	})
+	if err == nil {
+		t.Fatal("expected unknown type error")
+	}
+
+	docs := []*model.Logging{
+		{Short: "GET", Full: `{"path":"/health"}`},
+		{Full: `{"path":"/v1","body":"{\"msg\":\"login user=42 ok\"}","phone":"13800001234","debug":{"detail":"x"}}`},
+	}
+	out := p.Process("a", docs)
+	if len(out) != 1 {
+		t.Fatal(len(out))
+	}
+	doc := out[0]
+	if doc.Short != "login user=4" || doc.Condition1 != "42" {
+		t.Fatal(doc.Short, doc.Condition1)
+	}
+	if doc.Full != `{"debug":{},"env":"prod","path":"/v1","phone":"1380000***"}` {
+		t.Fatal(doc.Full)
+	}
+	if doc.Size != len(doc.Short)+len(doc.Full) {
+		t.Fatal(doc.Size)
+	}
+
+	plain := []*model.Logging{{Short: "x", Full: "raw text"}}
+	if out := p.Process("c", plain); out[0].Full != "raw text" {
+		t.Fatal(out[0].Full)
+	}
+}
+
+func TestNew_Sample(t *testing.T) {
+	if _, err := New(&model.Processor{Type: model.ProcessorSample, Rate: 2}); err != ErrRateInvalid {
+		t.Fatal(err)
+	}
+	fn, err := New(&model.Processor{Type: model.ProcessorSample, Rate: 0, Pattern: "^debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fn(&record{doc: &model.Logging{Short: "debug x"}}) || !fn(&record{doc: &model.Logging{Short: "info"}}) {
+		t.Fatal("sample")
+	}
+}
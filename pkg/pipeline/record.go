@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+// record 处理过程中的日志，full 为 JSON 时按需解析成字段
+type record struct {
+	doc    *model.Logging
+	fields map[string]interface{}
+	parsed bool
+	dirty  bool
+}
+
+const (
+	fieldShort   = "short"
+	fieldLevel   = "level"
+	fieldIP      = "ip"
+	fieldC1      = "c1"
+	fieldC2      = "c2"
+	fieldC3      = "c3"
+	fieldTraceID = "trace_id"
+	fieldFull    = "full"
+)
+
+func builtin(field string) bool {
+	switch field {
+	case fieldShort, fieldLevel, fieldIP, fieldC1, fieldC2, fieldC3, fieldTraceID, fieldFull:
+		return true
+	}
+	return false
+}
+
+// parse full 不是 JSON 对象时，fields 为 nil
+func (r *record) parse() map[string]interface{} {
+	if r.parsed {
+		return r.fields
+	}
+	r.parsed = true
+	full := strings.TrimSpace(r.doc.Full)
+	if !strings.HasPrefix(full, "{") {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(full), &fields); err == nil {
+		r.fields = fields
+	}
+	return r.fields
+}
+
+func (r *record) get(field string) (string, bool) {
+	switch field {
+	case fieldShort:
+		return r.doc.Short, true
+	case fieldLevel:
+		return r.doc.Level.String(), true
+	case fieldIP:
+		return r.doc.IP, true
+	case fieldC1:
+		return r.doc.Condition1, true
+	case fieldC2:
+		return r.doc.Condition2, true
+	case fieldC3:
+		return r.doc.Condition3, true
+	case fieldTraceID:
+		return r.doc.TraceID, true
+	case fieldFull:
+		r.flush()
+		return r.doc.Full, true
+	}
+	v, ok := lookup(r.parse(), field)
+	if !ok {
+		return "", false
+	}
+	return valueString(v), true
+}
+
+func (r *record) set(field string, v interface{}) {
+	switch field {
+	case fieldShort:
+		r.doc.Short = valueString(v)
+	case fieldLevel:
+		if lvl := types.LevelStr2Int(valueString(v)); lvl >= -1 {
+			r.doc.Level = lvl
+		}
+	case fieldIP:
+		r.doc.IP = valueString(v)
+	case fieldC1:
+		r.doc.Condition1 = valueString(v)
+	case fieldC2:
+		r.doc.Condition2 = valueString(v)
+	case fieldC3:
+		r.doc.Condition3 = valueString(v)
+	case fieldTraceID:
+		r.doc.TraceID = valueString(v)
+	case fieldFull:
+		r.doc.Full = valueString(v)
+		r.fields, r.parsed, r.dirty = nil, false, false
+	default:
+		fields := r.parse()
+		if fields == nil {
+			if strings.TrimSpace(r.doc.Full) != "" {
+				// 原文不是 JSON，保留到 full 字段
+				fields = map[string]interface{}{fieldFull: r.doc.Full}
+			} else {
+				fields = make(map[string]interface{})
+			}
+			r.fields = fields
+		}
+		store(fields, field, v)
+		r.dirty = true
+	}
+}
+
+func (r *record) remove(field string) {
+	switch field {
+	case fieldShort, fieldIP, fieldC1, fieldC2, fieldC3, fieldTraceID, fieldFull:
+		r.set(field, "")
+	case fieldLevel:
+	default:
+		if remove(r.parse(), field) {
+			r.dirty = true
+		}
+	}
+}
+
+// flush 字段有修改时重新生成 full
+func (r *record) flush() {
+	if r.dirty {
+		b, _ := json.Marshal(r.fields)
+		r.doc.Full = string(b)
+		r.dirty = false
+	}
+	r.doc.Size = len(r.doc.Short) + len(r.doc.Full)
+}
+
+func lookup(fields map[string]interface{}, path string) (interface{}, bool) {
+	if fields == nil {
+		return nil, false
+	}
+	if v, ok := fields[path]; ok {
+		return v, true
+	}
+	if i := strings.IndexByte(path, '.'); i > 0 {
+		if sub, ok := fields[path[:i]].(map[string]interface{}); ok {
+			return lookup(sub, path[i+1:])
+		}
+	}
+	return nil, false
+}
+
+func store(fields map[string]interface{}, path string, v interface{}) {
+	if i := strings.IndexByte(path, '.'); i > 0 {
+		if _, ok := fields[path]; !ok {
+			sub, ok := fields[path[:i]].(map[string]interface{})
+			if !ok {
+				sub = make(map[string]interface{})
+				fields[path[:i]] = sub
+			}
+			store(sub, path[i+1:], v)
+			return
+		}
+	}
+	fields[path] = v
+}
+
+func remove(fields map[string]interface{}, path string) bool {
+	if fields == nil {
+		return false
+	}
+	if _, ok := fields[path]; ok {
+		delete(fields, path)
+		return true
+	}
+	if i := strings.IndexByte(path, '.'); i > 0 {
+		if sub, ok := fields[path[:i]].(map[string]interface{}); ok {
+			return remove(sub, path[i+1:])
+		}
+	}
+	return false
+}
+
+func valueString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case nil:
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
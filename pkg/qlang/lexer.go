@@ -0,0 +1,109 @@
+package qlang
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenPipe
+	tokenComma
+)
+
+type token struct {
+	typ tokenType
+	val string
+	// 在查询语句中的字符位置，从 1 开始
+	pos int
+}
+
+// Error 查询语句错误，Pos 为字符位置，0 表示整个语句
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	if e.Pos <= 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("第 %d 个字符: %s", e.Pos, e.Msg)
+}
+
+func errorf(pos int, format string, args ...interface{}) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isOpChar(r rune) bool {
+	return strings.ContainsRune(":=!<>~", r)
+}
+
+func isWordChar(r rune) bool {
+	return !unicode.IsSpace(r) && !isOpChar(r) && r != '"' && r != '|' && r != ','
+}
+
+func lex(q string) ([]token, error) {
+	runes := []rune(q)
+	tokens := make([]token, 0)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '|':
+			tokens = append(tokens, token{typ: tokenPipe, val: "|", pos: pos})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{typ: tokenComma, val: ",", pos: pos})
+			i++
+		case r == '"':
+			var sb strings.Builder
+			j := i + 1
+			closed := false
+			for ; j < len(runes); j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+					sb.WriteRune(runes[j])
+					continue
+				}
+				if runes[j] == '"' {
+					closed = true
+					break
+				}
+				sb.WriteRune(runes[j])
+			}
+			if !closed {
+				return nil, errorf(pos, "引号未闭合")
+			}
+			tokens = append(tokens, token{typ: tokenString, val: sb.String(), pos: pos})
+			i = j + 1
+		case isOpChar(r):
+			op := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && (r == '!' || r == '<' || r == '>') {
+				op += "="
+			}
+			if op == "!" {
+				return nil, errorf(pos, "未知的操作符 !，不等于使用 !=")
+			}
+			tokens = append(tokens, token{typ: tokenOp, val: op, pos: pos})
+			i += len([]rune(op))
+		default:
+			j := i
+			for j < len(runes) && isWordChar(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, token{typ: tokenWord, val: string(runes[i:j]), pos: pos})
+			i = j
+		}
+	}
+	tokens = append(tokens, token{typ: tokenEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
@@ -0,0 +1,376 @@
+package qlang
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/huzhongqing/qelog/pkg/fieldquery"
+)
+
+// 日志查询语句，例如
+//   module:order level>=warn short~"timeout" c1=123 | count by ip
+// 条件之间为且的关系，没有字段的词或短语作为全文搜索关键词
+// 字段: module level short ip c1 c2 c3 trace pattern 以及结构化详情 fd.<path>
+// 操作符: : = != > >= < <= ~，short: 为包含，short~ 为正则，fd.<path>=* 为字段存在
+// 管道: count 统计数量，count by 字段 分组统计，limit N 限制返回条数
+// 时间范围不在语句中，由请求参数指定
+
+const (
+	// 分组统计最多的字段数
+	maxCountBy = 3
+	// MaxLimit limit 的最大值
+	MaxLimit = 1000
+)
+
+// 支持的字段与存储字段名
+var fieldNames = map[string]string{
+	"module":  "m",
+	"level":   "l",
+	"short":   "s",
+	"ip":      "ip",
+	"c1":      "c1",
+	"c2":      "c2",
+	"c3":      "c3",
+	"trace":   "ti",
+	"pattern": "pi",
+}
+
+var levelNames = map[string]int32{
+	"debug":  -1,
+	"info":   0,
+	"warn":   1,
+	"error":  2,
+	"dpanic": 3,
+	"panic":  4,
+	"fatal":  5,
+}
+
+var compareOps = map[string]string{
+	"!=": "$ne",
+	">":  "$gt",
+	">=": "$gte",
+	"<":  "$lt",
+	"<=": "$lte",
+}
+
+// Plan 校验后的查询计划
+type Plan struct {
+	Module string
+	// 索引字段的条件，包含 m，不包含时间
+	Filter bson.M
+	// 结构化详情的条件，不能使用索引
+	Fields []fieldquery.Predicate
+	// 全文搜索关键词，格式与 fulltext.ParseQuery 一致
+	Keyword string
+
+	Count bool
+	// 分组统计的字段，为查询语句中的字段名
+	CountBy []string
+	// 为 0 表示使用请求中的数量
+	Limit int64
+}
+
+// Parse 解析并校验查询语句
+func Parse(q string) (*Plan, error) {
+	tokens, err := lex(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, plan: &Plan{Filter: bson.M{}}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	if err := p.plan.validate(); err != nil {
+		return nil, err
+	}
+	return p.plan, nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+	plan   *Plan
+	// 没有字段的词与短语
+	keywords []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.typ != tokenEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) parse() error {
+	for {
+		t := p.peek()
+		if t.typ == tokenEOF || t.typ == tokenPipe {
+			break
+		}
+		if err := p.parseTerm(); err != nil {
+			return err
+		}
+	}
+	p.plan.Keyword = strings.Join(p.keywords, " ")
+	for p.peek().typ == tokenPipe {
+		p.next()
+		if err := p.parseStage(); err != nil {
+			return err
+		}
+	}
+	if t := p.peek(); t.typ != tokenEOF {
+		return errorf(t.pos, "多余的内容 %s", t.val)
+	}
+	return nil
+}
+
+func (p *parser) parseTerm() error {
+	t := p.next()
+	switch t.typ {
+	case tokenString:
+		p.keywords = append(p.keywords, strconv.Quote(t.val))
+		return nil
+	case tokenWord:
+	default:
+		return errorf(t.pos, "需要字段条件或关键词，得到 %s", t.val)
+	}
+	if p.peek().typ != tokenOp {
+		p.keywords = append(p.keywords, t.val)
+		return nil
+	}
+	op := p.next()
+	value := p.next()
+	if value.typ != tokenWord && value.typ != tokenString {
+		return errorf(value.pos, "%s%s 缺少值", t.val, op.val)
+	}
+	return p.addCondition(t, op, value)
+}
+
+func (p *parser) addCondition(field, op, value token) error {
+	name := strings.ToLower(field.val)
+	if strings.HasPrefix(name, "fd.") {
+		return p.addFieldPredicate(field, op, value)
+	}
+	key, ok := fieldNames[name]
+	if !ok {
+		return errorf(field.pos, "未知的字段 %s", field.val)
+	}
+	var v interface{} = value.val
+	if name == "level" {
+		lvl, err := parseLevel(value)
+		if err != nil {
+			return err
+		}
+		v = lvl
+	}
+
+	var cond interface{}
+	switch op.val {
+	case ":", "=":
+		cond = v
+		if name == "short" && op.val == ":" {
+			cond = primitive.Regex{Pattern: regexp.QuoteMeta(value.val), Options: "i"}
+		}
+	case "~":
+		if name != "short" {
+			return errorf(op.pos, "只有 short 支持正则 ~")
+		}
+		if _, err := regexp.Compile(value.val); err != nil {
+			return errorf(value.pos, "正则错误 %s", err.Error())
+		}
+		cond = primitive.Regex{Pattern: value.val, Options: "i"}
+	default:
+		if op.val != "!=" && name != "level" {
+			return errorf(op.pos, "%s 只支持 = != 比较", field.val)
+		}
+		if name == "module" {
+			return errorf(op.pos, "module 只支持 =")
+		}
+		return p.mergeOp(field, key, compareOps[op.val], v)
+	}
+	if _, ok := p.plan.Filter[key]; ok {
+		return errorf(field.pos, "%s 条件冲突", field.val)
+	}
+	p.plan.Filter[key] = cond
+	if name == "module" {
+		p.plan.Module = value.val
+	}
+	return nil
+}
+
+// mergeOp 同一字段多个比较条件合并，例如 level>=warn level<=error
+func (p *parser) mergeOp(field token, key, op string, v interface{}) error {
+	exist, ok := p.plan.Filter[key]
+	if !ok {
+		p.plan.Filter[key] = bson.M{op: v}
+		return nil
+	}
+	m, ok := exist.(bson.M)
+	if !ok {
+		return errorf(field.pos, "%s 条件冲突", field.val)
+	}
+	if _, ok := m[op]; ok {
+		return errorf(field.pos, "%s 条件冲突", field.val)
+	}
+	m[op] = v
+	return nil
+}
+
+func (p *parser) addFieldPredicate(field, op, value token) error {
+	pred := fieldquery.Predicate{Key: field.val[len("fd."):]}
+	switch op.val {
+	case ":", "=":
+		pred.Op = fieldquery.OpEq
+	case "!=":
+		pred.Op = fieldquery.OpNe
+	case ">":
+		pred.Op = fieldquery.OpGt
+	case ">=":
+		pred.Op = fieldquery.OpGte
+	case "<":
+		pred.Op = fieldquery.OpLt
+	case "<=":
+		pred.Op = fieldquery.OpLte
+	default:
+		return errorf(op.pos, "%s 不支持 %s", field.val, op.val)
+	}
+	pred.Value = fieldValue(value)
+	if value.typ == tokenWord && value.val == "*" {
+		if pred.Op != fieldquery.OpEq && pred.Op != fieldquery.OpNe {
+			return errorf(value.pos, "* 只能用于 = 或 !=")
+		}
+		pred.Value = pred.Op == fieldquery.OpEq
+		pred.Op = fieldquery.OpExists
+	}
+	if _, err := fieldquery.Build([]fieldquery.Predicate{pred}); err != nil {
+		return errorf(field.pos, "%s", err.Error())
+	}
+	p.plan.Fields = append(p.plan.Fields, pred)
+	return nil
+}
+
+// fieldValue 没有引号的数字与布尔值按类型比较
+func fieldValue(t token) interface{} {
+	if t.typ == tokenString {
+		return t.val
+	}
+	if f, err := strconv.ParseFloat(t.val, 64); err == nil {
+		return f
+	}
+	switch t.val {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return t.val
+}
+
+func parseLevel(t token) (int32, error) {
+	if v, ok := levelNames[strings.ToLower(t.val)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(t.val)
+	if err != nil || v < -1 || v > 5 {
+		return 0, errorf(t.pos, "level 为 debug info warn error dpanic panic fatal 或 -1 到 5")
+	}
+	return int32(v), nil
+}
+
+func (p *parser) parseStage() error {
+	t := p.next()
+	switch strings.ToLower(t.val) {
+	case "count":
+		if p.plan.Count {
+			return errorf(t.pos, "重复的 count")
+		}
+		p.plan.Count = true
+		if strings.ToLower(p.peek().val) != "by" || p.peek().typ != tokenWord {
+			return nil
+		}
+		p.next()
+		for {
+			f := p.next()
+			if f.typ != tokenWord {
+				return errorf(f.pos, "count by 需要字段")
+			}
+			name := strings.ToLower(f.val)
+			if _, ok := fieldNames[name]; !ok && !strings.HasPrefix(name, "fd.") {
+				return errorf(f.pos, "未知的字段 %s", f.val)
+			}
+			if strings.HasPrefix(name, "fd.") {
+				if _, err := fieldquery.Build([]fieldquery.Predicate{{Key: f.val[3:], Op: fieldquery.OpExists}}); err != nil {
+					return errorf(f.pos, "%s", err.Error())
+				}
+				name = "fd." + f.val[3:]
+			}
+			p.plan.CountBy = append(p.plan.CountBy, name)
+			if len(p.plan.CountBy) > maxCountBy {
+				return errorf(f.pos, "count by 最多 %d 个字段", maxCountBy)
+			}
+			if p.peek().typ != tokenComma {
+				return nil
+			}
+			p.next()
+		}
+	case "limit":
+		n := p.next()
+		v, err := strconv.ParseInt(n.val, 10, 64)
+		if n.typ != tokenWord || err != nil || v <= 0 || v > MaxLimit {
+			return errorf(n.pos, "limit 为 1 到 %d", MaxLimit)
+		}
+		p.plan.Limit = v
+		return nil
+	}
+	return errorf(t.pos, "未知的管道 %s，支持 count 与 limit", t.val)
+}
+
+// validate 与联合索引 (m, ts, l, s, c1) 的使用规则一致
+func (plan *Plan) validate() error {
+	if plan.Module == "" {
+		return &Error{Msg: "需要 module 条件"}
+	}
+	rules := []struct {
+		field, require, key string
+	}{
+		{"s", "l", "short 需要同时指定 level，才能使用索引 (m, ts, l, s, c1)"},
+		{"ip", "s", "ip 需要同时指定 short，才能缩小扫描范围"},
+		{"c2", "c1", "c2 需要同时指定 c1"},
+		{"c3", "c2", "c3 需要同时指定 c2"},
+	}
+	for _, v := range rules {
+		if _, ok := plan.Filter[v.field]; !ok {
+			continue
+		}
+		if _, ok := plan.Filter[v.require]; !ok {
+			return &Error{Msg: v.key}
+		}
+	}
+	return nil
+}
+
+// GroupKey count by 字段的存储字段名
+func GroupKey(name string) string {
+	if strings.HasPrefix(name, "fd.") {
+		return fieldquery.FieldPrefix + "." + name[3:]
+	}
+	return fieldNames[name]
+}
+
+// GroupStage count by 的分组，分组键依次为 k0 k1 ...
+func (plan *Plan) GroupStage() bson.M {
+	id := bson.M{}
+	for i, name := range plan.CountBy {
+		id["k"+strconv.Itoa(i)] = "$" + GroupKey(name)
+	}
+	return bson.M{"$group": bson.M{"_id": id, "count": bson.M{"$sum": 1}}}
+}
@@ -0,0 +1,82 @@
+package qlang
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/huzhongqing/qelog/pkg/fieldquery"
+)
+
+func TestParse(t *testing.T) {
+	plan, err := Parse(`module:order level>=warn level<=error short~"time\"out" c1=123 fd.status>=500 fd.user=* "connect db" retry | count by ip, fd.req.path | limit 10`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFilter := bson.M{
+		"m":  "order",
+		"l":  bson.M{"$gte": int32(1), "$lte": int32(2)},
+		"s":  primitive.Regex{Pattern: `time"out`, Options: "i"},
+		"c1": "123",
+	}
+	if !reflect.DeepEqual(plan.Filter, wantFilter) {
+		t.Fatal(plan.Filter)
+	}
+	wantFields := []fieldquery.Predicate{
+		{Key: "status", Op: fieldquery.OpGte, Value: float64(500)},
+		{Key: "user", Op: fieldquery.OpExists, Value: true},
+	}
+	if !reflect.DeepEqual(plan.Fields, wantFields) {
+		t.Fatal(plan.Fields)
+	}
+	if plan.Module != "order" || plan.Keyword != `"connect db" retry` || !plan.Count || plan.Limit != 10 ||
+		!reflect.DeepEqual(plan.CountBy, []string{"ip", "fd.req.path"}) {
+		t.Fatalf("%+v", plan)
+	}
+	wantGroup := bson.M{"$group": bson.M{"_id": bson.M{"k0": "$ip", "k1": "$fd.req.path"}, "count": bson.M{"$sum": 1}}}
+	if !reflect.DeepEqual(plan.GroupStage(), wantGroup) {
+		t.Fatal(plan.GroupStage())
+	}
+
+	plan, err = Parse(`module=order short:"a.b" level:info`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plan.Filter["s"], primitive.Regex{Pattern: `a\.b`, Options: "i"}) || plan.Filter["l"] != int32(0) {
+		t.Fatal(plan.Filter)
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	cases := map[string]string{
+		`level=warn`:                      "需要 module",
+		`module:a short~x`:                "short 需要同时指定 level",
+		`module:a level=1 ip=1.1.1.1`:     "ip 需要同时指定 short",
+		`module:a c2=1`:                   "c2 需要同时指定 c1",
+		`module:a level=verbose`:          "第 16 个字符",
+		`module:a foo=1`:                  "未知的字段 foo",
+		`module:a ip~1`:                   "只有 short 支持正则",
+		`module:a ip>1`:                   "ip 只支持 = != 比较",
+		`module:a level=1 level=2`:        "level 条件冲突",
+		`module:a "open`:                  "引号未闭合",
+		`module:a | count by`:             "count by 需要字段",
+		`module:a | limit 0`:              "limit 为 1 到",
+		`module:a | sort`:                 "未知的管道 sort",
+		`module:a fd.$x=1`:                "invalid key",
+		`module:a level=1 short~"("`:      "正则错误",
+		`module:a fd.a>*`:                 "* 只能用于",
+		`module:a level!1`:                "不等于使用 !=",
+		`module:a | count by a,b`:         "未知的字段 a",
+		`module:a | count by ip,l,s,m`:    "未知的字段 l",
+		`module:a | count by ip,c1,c2,c3`: "最多 3 个字段",
+	}
+	for q, want := range cases {
+		_, err := Parse(q)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+}
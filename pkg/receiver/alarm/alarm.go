@@ -11,35 +11,61 @@ import (
 	"github.com/huzhongqing/qelog/infra/alert"
 	"github.com/huzhongqing/qelog/infra/kit"
 	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/infra/prom"
 	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/receiver/worker"
 	"go.uber.org/zap"
 )
 
 var (
 	ContentPrefix = "[QELOG]"
 	machineIP, _  = kit.GetLocalIPV4()
+	// 单次发送超时
+	sendTimeout = 30 * time.Second
+
+	promSends = prom.NewCounterVec("qelog_receiver_alarm_sends_total",
+		"Alarm sends by method and result: success, error per failed attempt, failure after retries, dropped when the queue is full.", "method", "result")
 )
 
 type Alarm struct {
 	mutex     sync.RWMutex
 	ruleState map[string]*RuleState
-	hooks     map[string]*model.HookURL
-	modules   map[string]bool
+	// 不能按 Key 查找的规则，按模块索引，逐条比较
+	matchers map[string][]*RuleState
+	hooks    map[string]*model.HookURL
+	modules  map[string]bool
 	// 报警信息隐藏文字
 	hideTexts []string
+	// 发送队列与规则匹配分开，发送慢不影响匹配
+	dispatch *worker.Queue
+	retry    int
+	// 按时间窗口统计的规则，为空时不支持
+	window *Window
 }
 
-func NewAlarm() *Alarm {
+// NewAlarm retry 为发送失败后的重试次数，间隔从 1s 开始翻倍
+func NewAlarm(name string, queueSize, workers, retry int) *Alarm {
 	a := &Alarm{
 		mutex:     sync.RWMutex{},
 		ruleState: make(map[string]*RuleState, 0),
+		matchers:  make(map[string][]*RuleState),
 		hooks:     make(map[string]*model.HookURL, 0),
 		modules:   make(map[string]bool),
 		hideTexts: make([]string, 0),
+		retry:     retry,
 	}
+	a.dispatch = worker.NewQueue(name, queueSize, workers, a.send)
 	return a
 }
 
+// SetWindow 开启窗口规则，报警与逐条匹配的规则使用同一个发送队列
+func (a *Alarm) SetWindow(w *Window) {
+	w.dispatch = func(msg *message) bool {
+		return a.dispatch.Push(msg)
+	}
+	a.window = w
+}
+
 func (a *Alarm) AddHideText(txt []string) {
 	for _, v := range txt {
 		if v != "" {
@@ -56,17 +82,74 @@ func (a *Alarm) ModuleIsEnable(name string) bool {
 	return ok && enable
 }
 
+// AlarmIfHitRule 只做规则匹配，需要发送的报警放入发送队列
 func (a *Alarm) AlarmIfHitRule(docs []*model.Logging) {
+	if a.window != nil {
+		a.window.Count(docs)
+	}
+	msgs := make([]*message, 0)
 	a.mutex.RLock()
-	defer a.mutex.RUnlock()
 	for _, v := range docs {
-		state, ok := a.ruleState[v.Key()]
-		if ok {
-			state.Send(v)
+		if state, ok := a.ruleState[v.Key()]; ok {
+			if msg := state.hit(v); msg != nil {
+				msgs = append(msgs, msg)
+			}
+		}
+		for _, state := range a.matchers[v.Module] {
+			if state.matcher == nil || !state.matcher.match(v) {
+				continue
+			}
+			if msg := state.hit(v); msg != nil {
+				msgs = append(msgs, msg)
+			}
+		}
+	}
+	a.mutex.RUnlock()
+
+	for _, msg := range msgs {
+		if !a.dispatch.Push(msg) {
+			promSends.WithLabelValues(msg.method.Method(), "dropped").Inc()
+			msg.state.rollback(msg)
 		}
 	}
 }
 
+// send 发送失败按间隔重试，最终失败时恢复状态，下一次命中重新发送
+func (a *Alarm) send(v interface{}) {
+	msg := v.(*message)
+	backoff := time.Second
+	var err error
+	for i := 0; i <= a.retry; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err = msg.method.Send(ctx, msg.content)
+		cancel()
+		if err == nil {
+			promSends.WithLabelValues(msg.method.Method(), "success").Inc()
+			return
+		}
+		promSends.WithLabelValues(msg.method.Method(), "error").Inc()
+	}
+	promSends.WithLabelValues(msg.method.Method(), "failure").Inc()
+	logs.Qezap.Error("AlarmSend", zap.String(msg.method.Method(), err.Error()))
+	msg.state.rollback(msg)
+}
+
+// Close 窗口规则的计数写入主库，并等待发送队列中的报警发送完
+func (a *Alarm) Close(timeout time.Duration) bool {
+	if a.window != nil {
+		if err := a.window.Flush(); err != nil {
+			logs.Qezap.Error("AlarmWindowFlush", zap.Error(err))
+		}
+	}
+	return a.dispatch.Close(timeout)
+}
+
+// InitRuleState 每次都创建新的状态，在写锁内继承未修改规则的发送状态后替换
+// 旧状态可能仍被发送队列引用，不能直接修改
 func (a *Alarm) InitRuleState(rules []*model.AlarmRule, hooks []*model.HookURL) {
 	modules := make(map[string]bool)
 	ruleState := make(map[string]*RuleState, len(rules))
@@ -74,21 +157,45 @@ func (a *Alarm) InitRuleState(rules []*model.AlarmRule, hooks []*model.HookURL)
 	for _, v := range hooks {
 		hooksMap[v.ID.Hex()] = v
 	}
+	windowRules := make([]*model.AlarmRule, 0)
+	matchers := make(map[string][]*RuleState)
 	for _, rule := range rules {
-		ruleState[rule.Key()] = new(RuleState).UpsertRule(rule, hooksMap[rule.HookID])
+		if rule.Type.Windowed() {
+			if a.window != nil {
+				windowRules = append(windowRules, rule)
+				modules[rule.ModuleName] = true
+			}
+			continue
+		}
+		state := newRuleState(rule, hooksMap[rule.HookID])
+		if rule.Plain() {
+			ruleState[state.Key()] = state
+		} else {
+			matchers[rule.ModuleName] = append(matchers[rule.ModuleName], state)
+		}
 		modules[rule.ModuleName] = true
 	}
-	a.mutex.RLock()
-	for _, state := range a.ruleState {
-		v, ok := ruleState[state.Key()]
-		if ok {
-			ruleState[state.Key()] = state.UpsertRule(v.rule, v.hook)
-		}
+	if a.window != nil {
+		a.window.SetRules(windowRules, hooksMap)
 	}
-	a.mutex.RUnlock()
 	// 替换状态机
 	a.mutex.Lock()
+	for key, state := range ruleState {
+		state.inherit(a.ruleState[key])
+	}
+	prev := make(map[string]*RuleState)
+	for _, states := range a.matchers {
+		for _, state := range states {
+			prev[state.rule.ID.Hex()] = state
+		}
+	}
+	for _, states := range matchers {
+		for _, state := range states {
+			state.inherit(prev[state.rule.ID.Hex()])
+		}
+	}
 	a.ruleState = ruleState
+	a.matchers = matchers
 	a.modules = modules
 	a.hooks = hooksMap
 	a.mutex.Unlock()
@@ -101,42 +208,60 @@ type RuleState struct {
 	count          int32
 	latestSendTime int64
 	method         alert.Alarm
+	matcher        *matcher
 }
 
-func (rs *RuleState) Send(v *model.Logging) {
-	if v == nil {
-		return
+// rollbacker 发送失败时归还占用的发送
+type rollbacker interface {
+	rollback(msg *message)
+}
+
+type message struct {
+	state   rollbacker
+	method  alert.Alarm
+	content string
+	// 本次发送占用的时间与频次，发送失败时归还
+	sendTime int64
+	count    int32
+}
+
+// hit 超出发送间隔时，抢占本周期的发送并返回报警内容
+func (rs *RuleState) hit(v *model.Logging) *message {
+	if v == nil || rs.method == nil {
+		return nil
 	}
 	atomic.AddInt32(&rs.count, 1)
-	isSend := false
-	if atomic.LoadInt64(&rs.latestSendTime) == 0 {
-		//直接发送
-		isSend = true
-	} else if time.Now().Unix()-atomic.LoadInt64(&rs.latestSendTime) > rs.rule.RateSec {
-		// 超出了间隔
-		isSend = true
-	}
-	if isSend {
-		ctx, _ := context.WithTimeout(context.Background(), 30*time.Second)
-		err := rs.method.Send(ctx, rs.parsingContent(v))
-		if err != nil {
-			logs.Qezap.Error("AlarmSend", zap.String(rs.method.Method(), err.Error()))
-		} else {
-			atomic.StoreInt32(&rs.count, 0)
-			// 如果间隔时间 <= 0  那么每次都直接发送
-			latestSendTime := int64(0)
-			if rs.rule.RateSec > 0 {
-				latestSendTime = time.Now().Unix()
-			}
-			atomic.StoreInt64(&rs.latestSendTime, latestSendTime)
+	sendTime := int64(0)
+	if rs.rule.RateSec > 0 {
+		// 如果间隔时间 <= 0  那么每次都直接发送
+		latest := atomic.LoadInt64(&rs.latestSendTime)
+		now := time.Now().Unix()
+		if latest != 0 && now-latest <= rs.rule.RateSec {
+			return nil
+		}
+		if !atomic.CompareAndSwapInt64(&rs.latestSendTime, latest, now) {
+			return nil
 		}
-	} else {
-		atomic.AddInt32(&rs.count, 1)
+		sendTime = now
+	}
+	count := atomic.SwapInt32(&rs.count, 0)
+	return &message{
+		state:    rs,
+		method:   rs.method,
+		content:  rs.parsingContent(v, count),
+		sendTime: sendTime,
+		count:    count,
 	}
-	return
 }
 
-func (rs *RuleState) parsingContent(v *model.Logging) string {
+func (rs *RuleState) rollback(msg *message) {
+	atomic.AddInt32(&rs.count, msg.count)
+	if msg.sendTime != 0 {
+		atomic.CompareAndSwapInt64(&rs.latestSendTime, msg.sendTime, 0)
+	}
+}
+
+func (rs *RuleState) parsingContent(v *model.Logging, count int32) string {
 	str := fmt.Sprintf(`%s
 标签: %s
 IP: %s
@@ -146,7 +271,7 @@ IP: %s
 详情: %s
 频次: %d/%ds
 报警节点: %s`, rs.KeyWord(), rs.rule.Tag, v.IP, time.Unix(v.TimeSec, 0).Format("2006-01-02 15:04:05"), v.Level.String(),
-		v.Short, v.Full, atomic.LoadInt32(&rs.count), rs.rule.RateSec, machineIP)
+		v.Short, v.Full, count, rs.rule.RateSec, machineIP)
 
 	// 隐藏字段
 	if rs.hook != nil {
@@ -170,19 +295,43 @@ func (rs *RuleState) KeyWord() string {
 	return ContentPrefix
 }
 
-func (rs *RuleState) UpsertRule(new *model.AlarmRule, hook *model.HookURL) *RuleState {
-	if rs.rule == nil || !rs.rule.UpdatedAt.Equal(new.UpdatedAt) {
-		rs.rule = new
-		rs.hook = hook
-		rs.key = new.Key()
-		rs.latestSendTime = 0
-		switch rs.rule.Method {
-		case model.MethodDingDing:
-			rs.method = alert.NewDingDing()
-			if rs.hook != nil {
-				rs.method.SetHookURL(rs.hook.URL)
-			}
+func newRuleState(rule *model.AlarmRule, hook *model.HookURL) *RuleState {
+	return &RuleState{
+		key:     rule.Key(),
+		hook:    hook,
+		rule:    rule,
+		method:  newMethod(rule, hook),
+		matcher: newMatcher(rule),
+	}
+}
+
+// inherit 规则没有修改时保留频次与最近发送时间
+func (rs *RuleState) inherit(prev *RuleState) {
+	if prev == nil || prev.rule.ID != rs.rule.ID || !prev.rule.UpdatedAt.Equal(rs.rule.UpdatedAt) {
+		return
+	}
+	atomic.StoreInt32(&rs.count, atomic.LoadInt32(&prev.count))
+	atomic.StoreInt64(&rs.latestSendTime, atomic.LoadInt64(&prev.latestSendTime))
+}
+
+// newMatcher 条件不能编译时规则不生效，管理端保存时已经校验
+func newMatcher(rule *model.AlarmRule) *matcher {
+	m, err := compileMatcher(rule)
+	if err != nil {
+		logs.Qezap.Error("AlarmRuleMatcher", zap.String("rule", rule.ID.Hex()), zap.Error(err))
+		return nil
+	}
+	return m
+}
+
+func newMethod(rule *model.AlarmRule, hook *model.HookURL) alert.Alarm {
+	switch rule.Method {
+	case model.MethodDingDing:
+		method := alert.NewDingDing()
+		if hook != nil {
+			method.SetHookURL(hook.URL)
 		}
+		return method
 	}
-	return rs
+	return nil
 }
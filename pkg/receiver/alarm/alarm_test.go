@@ -0,0 +1,56 @@
+package alarm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// 重新加载规则与匹配同时进行，未修改的规则保留频次与发送时间
+func TestInitRuleStateKeepsSendState(t *testing.T) {
+	a := NewAlarm("test", 10, 1, 0)
+	defer a.Close(time.Second)
+	plain := &model.AlarmRule{ID: primitive.NewObjectID(), ModuleName: "order", Short: "timeout", Level: 2, RateSec: 3600, Method: model.MethodDingDing}
+	match := &model.AlarmRule{ID: primitive.NewObjectID(), ModuleName: "order", Short: "db", ShortMatch: model.MatchPrefix, Level: 2, RateSec: 3600, Method: model.MethodDingDing}
+	rules := []*model.AlarmRule{plain, match}
+	a.InitRuleState(rules, nil)
+	// 间隔内不发送，只累计频次
+	now := time.Now().Unix()
+	a.ruleState[plain.Key()].latestSendTime = now
+	a.matchers["order"][0].latestSendTime = now
+	old := a.ruleState[plain.Key()]
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			a.InitRuleState(rules, nil)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		a.AlarmIfHitRule([]*model.Logging{
+			{Module: "order", Short: "timeout", Level: 2},
+			{Module: "order", Short: "db down", Level: 2},
+		})
+	}
+	<-done
+
+	if a.ruleState[plain.Key()] == old {
+		t.Fatal("state should be replaced")
+	}
+	for _, state := range []*RuleState{a.ruleState[plain.Key()], a.matchers["order"][0]} {
+		if state.latestSendTime != now || state.count != 100 {
+			t.Fatal(state.rule.Short, state.latestSendTime, state.count)
+		}
+	}
+
+	// 规则修改后重新计算
+	updated := *plain
+	updated.UpdatedAt = time.Now()
+	a.InitRuleState([]*model.AlarmRule{&updated, match}, nil)
+	if state := a.ruleState[plain.Key()]; state.latestSendTime != 0 || state.count != 0 {
+		t.Fatal(state.latestSendTime, state.count)
+	}
+}
@@ -0,0 +1,112 @@
+package alarm
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+// matcher 规则的条件在规则更新时编译，逐条日志只做比较
+type matcher struct {
+	short     textMatcher
+	full      textMatcher
+	level     model.Level
+	levelGte  bool
+	ip        string
+	condOne   string
+	condTwo   string
+	condThree string
+}
+
+// textMatcher 文本为空时不限制
+type textMatcher struct {
+	op   string
+	text string
+	re   *regexp.Regexp
+}
+
+func compileMatcher(rule *model.AlarmRule) (*matcher, error) {
+	short, err := compileText(rule.ShortMatch, rule.Short)
+	if err != nil {
+		return nil, err
+	}
+	full, err := compileText(rule.FullMatch, rule.Full)
+	if err != nil {
+		return nil, err
+	}
+	levelGte := rule.LevelOp == model.LevelOpGte
+	if rule.LevelOp == "" {
+		levelGte = rule.Type.Windowed()
+	}
+	return &matcher{
+		short:     short,
+		full:      full,
+		level:     rule.Level,
+		levelGte:  levelGte,
+		ip:        rule.IP,
+		condOne:   rule.ConditionOne,
+		condTwo:   rule.ConditionTwo,
+		condThree: rule.ConditionThree,
+	}, nil
+}
+
+// Match 单条日志是否满足规则的条件，manager 用于确认规则与来源的查询条件一致
+func Match(rule *model.AlarmRule, v *model.Logging) (bool, error) {
+	m, err := compileMatcher(rule)
+	if err != nil {
+		return false, err
+	}
+	return m.match(v), nil
+}
+
+func compileText(op, text string) (textMatcher, error) {
+	m := textMatcher{op: op, text: text}
+	if op == model.MatchRegex && text != "" {
+		re, err := regexp.Compile(text)
+		if err != nil {
+			return m, err
+		}
+		m.re = re
+	}
+	return m, nil
+}
+
+// match 先比较代价小的条件，详情最后比较
+func (m *matcher) match(v *model.Logging) bool {
+	if m.levelGte {
+		if v.Level < m.level {
+			return false
+		}
+	} else if v.Level != m.level {
+		return false
+	}
+	if (m.ip != "" && v.IP != m.ip) ||
+		(m.condOne != "" && v.Condition1 != m.condOne) ||
+		(m.condTwo != "" && v.Condition2 != m.condTwo) ||
+		(m.condThree != "" && v.Condition3 != m.condThree) {
+		return false
+	}
+	if !m.short.match(v.Short) {
+		return false
+	}
+	if m.full.text != "" && !m.full.match(v.FullString()) {
+		return false
+	}
+	return true
+}
+
+func (m textMatcher) match(s string) bool {
+	if m.text == "" {
+		return true
+	}
+	switch m.op {
+	case model.MatchPrefix:
+		return strings.HasPrefix(s, m.text)
+	case model.MatchContains:
+		return strings.Contains(s, m.text)
+	case model.MatchRegex:
+		return m.re.MatchString(s)
+	}
+	return s == m.text
+}
@@ -0,0 +1,42 @@
+package alarm
+
+import (
+	"testing"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMatcher(t *testing.T) {
+	tests := []struct {
+		rule model.AlarmRule
+		doc  model.Logging
+		want bool
+	}{
+		{model.AlarmRule{Short: "timeout", Level: 2}, model.Logging{Short: "timeout", Level: 2}, true},
+		{model.AlarmRule{Short: "timeout", Level: 2}, model.Logging{Short: "timeout", Level: 3}, false},
+		{model.AlarmRule{Short: "timeout", Level: 2, LevelOp: model.LevelOpGte}, model.Logging{Short: "timeout", Level: 3}, true},
+		// 窗口规则默认不低于
+		{model.AlarmRule{Level: 1, Type: model.AlarmRuleTypeCount}, model.Logging{Short: "x", Level: 2}, true},
+		{model.AlarmRule{Short: "db", ShortMatch: model.MatchPrefix}, model.Logging{Short: "db timeout"}, true},
+		{model.AlarmRule{Short: "time", ShortMatch: model.MatchContains}, model.Logging{Short: "db timeout"}, true},
+		{model.AlarmRule{Short: `^order \d+ failed$`, ShortMatch: model.MatchRegex}, model.Logging{Short: "order 12 failed"}, true},
+		{model.AlarmRule{Short: `^order \d+ failed$`, ShortMatch: model.MatchRegex}, model.Logging{Short: "order x failed"}, false},
+		{model.AlarmRule{Full: "status", FullMatch: model.MatchContains}, model.Logging{Fields: bson.M{"status": 500}}, true},
+		{model.AlarmRule{IP: "10.0.0.1", ConditionOne: "pay"}, model.Logging{IP: "10.0.0.1", Condition1: "pay"}, true},
+		{model.AlarmRule{IP: "10.0.0.1", ConditionOne: "pay"}, model.Logging{IP: "10.0.0.1", Condition1: "order"}, false},
+	}
+	for i, tt := range tests {
+		m, err := compileMatcher(&tt.rule)
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if got := m.match(&tt.doc); got != tt.want {
+			t.Errorf("%d: got %v want %v", i, got, tt.want)
+		}
+	}
+
+	if _, err := compileMatcher(&model.AlarmRule{Short: "(", ShortMatch: model.MatchRegex}); err == nil {
+		t.Fatal("invalid regex")
+	}
+}
@@ -0,0 +1,568 @@
+package alarm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/huzhongqing/qelog/infra/alert"
+	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// 窗口规则，多个 receiver 实例共享计数
+// 每个实例在本地按周期计数，周期性的写入主库，检查时汇总所有实例窗口内的计数
+// 达到阈值后抢占主库中的报警记录，间隔内只有一个实例发送
+const maxOffenders = 5
+
+type Window struct {
+	mutex    sync.Mutex
+	store    *storage.Store
+	cfg      config.AlarmWindow
+	instance string
+	// 启动后一个窗口内不判断没有日志，其他实例的计数可能不完整
+	started time.Time
+	rules   map[string]*windowRule
+	modules map[string][]*windowRule
+	// 报警放入 Alarm 的发送队列
+	dispatch func(msg *message) bool
+}
+
+type windowRule struct {
+	window  *Window
+	id      string
+	rule    *model.AlarmRule
+	hook    *model.HookURL
+	method  alert.Alarm
+	matcher *matcher
+	// 未写入主库的计数
+	counts   map[windowKey]*windowCount
+	nextEval time.Time
+}
+
+type windowKey struct {
+	bucket int64
+	group  string
+}
+
+type windowCount struct {
+	hit   int64
+	total int64
+}
+
+// windowGroup 所有实例窗口内的计数
+type windowGroup struct {
+	Group string `bson:"_id"`
+	Hit   int64  `bson:"hit"`
+	Total int64  `bson:"total"`
+}
+
+func NewWindow(store *storage.Store, cfg config.AlarmWindow) *Window {
+	host, _ := os.Hostname()
+	return &Window{
+		store:    store,
+		cfg:      cfg,
+		instance: fmt.Sprintf("%s_%d_%s", host, os.Getpid(), primitive.NewObjectID().Hex()[18:]),
+		started:  time.Now(),
+		rules:    make(map[string]*windowRule),
+		modules:  make(map[string][]*windowRule),
+	}
+}
+
+// SetRules 规则更新后保留未写入的计数，规则修改后重新计算检查时间
+func (w *Window) SetRules(rules []*model.AlarmRule, hooks map[string]*model.HookURL) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	exists := make(map[string]*windowRule, len(rules))
+	modules := make(map[string][]*windowRule)
+	for _, rule := range rules {
+		id := rule.ID.Hex()
+		wr, ok := w.rules[id]
+		if !ok || !wr.rule.UpdatedAt.Equal(rule.UpdatedAt) {
+			counts := make(map[windowKey]*windowCount)
+			if ok {
+				counts = wr.counts
+			}
+			hook := hooks[rule.HookID]
+			wr = &windowRule{
+				window:  w,
+				id:      id,
+				rule:    rule,
+				hook:    hook,
+				method:  newMethod(rule, hook),
+				matcher: newMatcher(rule),
+				counts:  counts,
+			}
+		}
+		exists[id] = wr
+		modules[rule.ModuleName] = append(modules[rule.ModuleName], wr)
+	}
+	w.rules = exists
+	w.modules = modules
+}
+
+// Count 本地计数，按 IP 统计时每个周期超过 MaxGroups 的 IP 不再记录
+func (w *Window) Count(docs []*model.Logging) {
+	bucket := w.bucket(time.Now())
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, v := range docs {
+		for _, wr := range w.modules[v.Module] {
+			if wr.matcher == nil {
+				continue
+			}
+			hit := wr.matcher.match(v)
+			switch wr.rule.Type {
+			case model.AlarmRuleTypeRatio:
+				c := wr.count(windowKey{bucket: bucket})
+				c.total++
+				if hit {
+					c.hit++
+				}
+			case model.AlarmRuleTypeCount, model.AlarmRuleTypeAbsence:
+				if hit {
+					wr.count(windowKey{bucket: bucket}).hit++
+				}
+			case model.AlarmRuleTypeIPCount, model.AlarmRuleTypeIPAbsence:
+				if !hit {
+					continue
+				}
+				key := windowKey{bucket: bucket, group: v.IP}
+				if _, ok := wr.counts[key]; !ok && len(wr.counts) >= w.cfg.MaxGroups {
+					continue
+				}
+				wr.count(key).hit++
+			}
+		}
+	}
+}
+
+func (wr *windowRule) count(key windowKey) *windowCount {
+	c, ok := wr.counts[key]
+	if !ok {
+		c = &windowCount{}
+		wr.counts[key] = c
+	}
+	return c
+}
+
+func (w *Window) bucket(t time.Time) int64 {
+	sec := t.Unix()
+	return sec - sec%w.cfg.FlushSec
+}
+
+func (w *Window) BackgroundEvaluate() {
+	tick := time.NewTicker(time.Duration(w.cfg.FlushSec) * time.Second)
+	for now := range tick.C {
+		if err := w.Flush(); err != nil {
+			logs.Qezap.Error("AlarmWindowFlush", zap.Error(err))
+		}
+		w.Evaluate(now)
+	}
+}
+
+// Flush 本地计数写入主库，失败时留到下一次
+func (w *Window) Flush() error {
+	type pending struct {
+		wr     *windowRule
+		counts map[windowKey]*windowCount
+	}
+	w.mutex.Lock()
+	list := make([]pending, 0, len(w.rules))
+	for _, wr := range w.rules {
+		if len(wr.counts) == 0 {
+			continue
+		}
+		list = append(list, pending{wr: wr, counts: wr.counts})
+		wr.counts = make(map[windowKey]*windowCount)
+	}
+	w.mutex.Unlock()
+	if len(list) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	filters := make([]bson.M, 0)
+	updates := make([]bson.M, 0)
+	for _, p := range list {
+		for k, c := range p.counts {
+			filters = append(filters, bson.M{"rule_id": p.wr.id, "instance": w.instance, "bucket": k.bucket, "group": k.group})
+			updates = append(updates, bson.M{
+				"$inc": bson.M{"hit": c.hit, "total": c.total},
+				"$set": bson.M{"updated_at": now},
+			})
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.store.BulkUpsert(ctx, model.CollectionNameAlarmWindow, filters, updates); err != nil {
+		w.mutex.Lock()
+		for _, p := range list {
+			for k, c := range p.counts {
+				n := p.wr.count(k)
+				n.hit += c.hit
+				n.total += c.total
+			}
+		}
+		w.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Evaluate 检查到期的规则，所有实例都会检查，由抢占报警记录保证只发送一次
+func (w *Window) Evaluate(now time.Time) {
+	w.mutex.Lock()
+	due := make([]*windowRule, 0)
+	for _, wr := range w.rules {
+		if now.Before(wr.nextEval) || wr.method == nil {
+			continue
+		}
+		evalSec := wr.rule.EvalSec
+		if evalSec <= 0 {
+			evalSec = w.cfg.EvalSec
+		}
+		wr.nextEval = now.Add(time.Duration(evalSec) * time.Second)
+		due = append(due, wr)
+	}
+	w.mutex.Unlock()
+
+	for _, wr := range due {
+		if err := w.evaluate(wr, now); err != nil {
+			logs.Qezap.Error("AlarmWindowEvaluate", zap.String("rule", wr.id), zap.Error(err))
+		}
+	}
+}
+
+func (w *Window) evaluate(wr *windowRule, now time.Time) error {
+	if wr.rule.Type.Absence() {
+		return w.evaluateAbsence(wr, now)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pipeline := []bson.M{
+		{"$match": bson.M{"rule_id": wr.id, "bucket": bson.M{"$gt": now.Unix() - wr.rule.WindowSec}}},
+		{"$group": bson.M{"_id": "$group", "hit": bson.M{"$sum": "$hit"}, "total": bson.M{"$sum": "$total"}}},
+	}
+	groups := make([]windowGroup, 0)
+	if err := w.store.AggregateAlarmWindow(ctx, pipeline, &groups); err != nil {
+		return err
+	}
+	value, offenders, fire := exceeded(wr.rule, groups)
+	if !fire {
+		return nil
+	}
+
+	// 同一个窗口内不重复报警，设置了发送间隔时使用发送间隔
+	silence := wr.rule.RateSec
+	if silence <= 0 {
+		silence = wr.rule.WindowSec
+	}
+	firedAt := time.Unix(now.Unix(), 0)
+	ok, err := w.store.ClaimAlarmFire(ctx, wr.id, firedAt, firedAt.Add(-time.Duration(silence)*time.Second))
+	if err != nil || !ok {
+		return err
+	}
+	msg := &message{
+		state:    wr,
+		method:   wr.method,
+		content:  wr.parsingContent(value, offenders, now),
+		sendTime: firedAt.Unix(),
+	}
+	if !w.dispatch(msg) {
+		promSends.WithLabelValues(msg.method.Method(), "dropped").Inc()
+		wr.rollback(msg)
+	}
+	return nil
+}
+
+// exceeded 返回统计值与超过阈值的 IP
+func exceeded(rule *model.AlarmRule, groups []windowGroup) (float64, []windowGroup, bool) {
+	switch rule.Type {
+	case model.AlarmRuleTypeCount:
+		var hit int64
+		for _, g := range groups {
+			hit += g.Hit
+		}
+		return float64(hit), nil, float64(hit) > rule.Threshold
+	case model.AlarmRuleTypeRatio:
+		var hit, total int64
+		for _, g := range groups {
+			hit += g.Hit
+			total += g.Total
+		}
+		if total == 0 {
+			return 0, nil, false
+		}
+		ratio := float64(hit) * 100 / float64(total)
+		return ratio, nil, ratio > rule.Threshold
+	case model.AlarmRuleTypeIPCount:
+		offenders := make([]windowGroup, 0)
+		for _, g := range groups {
+			if float64(g.Hit) > rule.Threshold {
+				offenders = append(offenders, g)
+			}
+		}
+		sort.Slice(offenders, func(i, j int) bool {
+			if offenders[i].Hit != offenders[j].Hit {
+				return offenders[i].Hit > offenders[j].Hit
+			}
+			return offenders[i].Group < offenders[j].Group
+		})
+		if len(offenders) == 0 {
+			return 0, nil, false
+		}
+		return float64(offenders[0].Hit), offenders, true
+	}
+	return 0, nil, false
+}
+
+// rollback 发送失败时归还报警记录，下一次检查重新发送
+func (wr *windowRule) rollback(msg *message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := wr.window.store.ReleaseAlarmFire(ctx, wr.id, time.Unix(msg.sendTime, 0)); err != nil {
+		logs.Qezap.Error("AlarmWindowRollback", zap.String("rule", wr.id), zap.Error(err))
+	}
+}
+
+func (wr *windowRule) parsingContent(value float64, offenders []windowGroup, now time.Time) string {
+	rule := wr.rule
+	short := rule.Short
+	if short == "" {
+		short = "全部"
+	}
+	level := rule.Level.String()
+	if wr.matcher != nil && wr.matcher.levelGte {
+		level += " 及以上"
+	}
+	var cond, actual string
+	switch rule.Type {
+	case model.AlarmRuleTypeCount:
+		cond = fmt.Sprintf("%ds 内超过 %g 条", rule.WindowSec, rule.Threshold)
+		actual = fmt.Sprintf("%g 条", value)
+	case model.AlarmRuleTypeRatio:
+		cond = fmt.Sprintf("%ds 内占比超过 %g%%", rule.WindowSec, rule.Threshold)
+		actual = fmt.Sprintf("%.2f%%", value)
+	case model.AlarmRuleTypeIPCount:
+		cond = fmt.Sprintf("%ds 内单个 IP 超过 %g 条", rule.WindowSec, rule.Threshold)
+		list := make([]string, 0, maxOffenders)
+		for i, g := range offenders {
+			if i >= maxOffenders {
+				list = append(list, fmt.Sprintf("等 %d 个 IP", len(offenders)))
+				break
+			}
+			list = append(list, fmt.Sprintf("%s %d 条", g.Group, g.Hit))
+		}
+		actual = strings.Join(list, ", ")
+	}
+	str := fmt.Sprintf(`%s
+标签: %s
+模块: %s
+等级: %s
+短消息: %s
+条件: %s
+统计: %s
+时间: %s
+报警节点: %s`, wr.KeyWord(), rule.Tag, rule.ModuleName, level, short, cond, actual,
+		now.Format("2006-01-02 15:04:05"), machineIP)
+
+	if wr.hook != nil {
+		for _, hide := range wr.hook.HideText {
+			str = strings.ReplaceAll(str, hide, "****")
+		}
+	}
+	return str
+}
+
+func (wr *windowRule) KeyWord() string {
+	if wr.hook != nil && wr.hook.KeyWord != "" {
+		return wr.hook.KeyWord
+	}
+	return ContentPrefix
+}
+
+// absenceGroup 所有实例在窗口内与上一个窗口的计数
+type absenceGroup struct {
+	Group    string `bson:"_id"`
+	Recent   int64  `bson:"recent"`
+	Previous int64  `bson:"previous"`
+}
+
+// evaluateAbsence 分组开始没有日志时报警，报警中的分组有日志后发送恢复通知
+func (w *Window) evaluateAbsence(wr *windowRule, now time.Time) error {
+	window := time.Duration(wr.rule.WindowSec) * time.Second
+	if now.Sub(w.started) < window || now.Sub(wr.rule.UpdatedAt) < window {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	since := now.Unix() - wr.rule.WindowSec
+	pipeline := []bson.M{
+		{"$match": bson.M{"rule_id": wr.id, "bucket": bson.M{"$gt": since - wr.rule.WindowSec}}},
+		{"$group": bson.M{
+			"_id":      "$group",
+			"recent":   bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$bucket", since}}, "$hit", 0}}},
+			"previous": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$bucket", since}}, 0, "$hit"}}},
+		}},
+	}
+	groups := make([]absenceGroup, 0)
+	if err := w.store.AggregateAlarmWindow(ctx, pipeline, &groups); err != nil {
+		return err
+	}
+	absent, present := absentGroups(wr.rule.Type, groups)
+
+	firing := make(map[string]bool)
+	docs, err := w.store.FindAlarmFire(ctx, bson.M{
+		"_id":    primitive.Regex{Pattern: "^" + wr.id + "_"},
+		"firing": true,
+	})
+	if err != nil {
+		return err
+	}
+	for _, v := range docs {
+		firing[strings.TrimPrefix(v.ID, wr.id+"_")] = true
+	}
+
+	firedAt := time.Unix(now.Unix(), 0)
+	fired := make([]string, 0)
+	for _, g := range absent {
+		if firing[g] {
+			continue
+		}
+		if ok, err := w.store.SwitchAlarmFiring(ctx, wr.fireID(g), true, firedAt); err != nil {
+			return err
+		} else if ok {
+			fired = append(fired, g)
+		}
+	}
+	recovered := make([]string, 0)
+	for _, g := range present {
+		if !firing[g] {
+			continue
+		}
+		if ok, err := w.store.SwitchAlarmFiring(ctx, wr.fireID(g), false, firedAt); err != nil {
+			return err
+		} else if ok {
+			recovered = append(recovered, g)
+		}
+	}
+
+	if len(fired) > 0 {
+		w.dispatchAbsence(wr, fired, true, now)
+	}
+	if len(recovered) > 0 {
+		w.dispatchAbsence(wr, recovered, false, now)
+	}
+	return nil
+}
+
+// absentGroups 模块规则的分组为空字符串，IP 规则只判断上一个窗口有日志的 IP
+func absentGroups(t model.AlarmRuleType, groups []absenceGroup) (absent, present []string) {
+	if t == model.AlarmRuleTypeAbsence {
+		var recent int64
+		for _, g := range groups {
+			recent += g.Recent
+		}
+		if recent == 0 {
+			return []string{""}, nil
+		}
+		return nil, []string{""}
+	}
+	for _, g := range groups {
+		if g.Recent > 0 {
+			present = append(present, g.Group)
+		} else if g.Previous > 0 {
+			absent = append(absent, g.Group)
+		}
+	}
+	sort.Strings(absent)
+	sort.Strings(present)
+	return absent, present
+}
+
+func (wr *windowRule) fireID(group string) string {
+	return wr.id + "_" + group
+}
+
+func (w *Window) dispatchAbsence(wr *windowRule, groups []string, firing bool, now time.Time) {
+	state := &absenceState{wr: wr, groups: groups, firing: firing}
+	msg := &message{
+		state:    state,
+		method:   wr.method,
+		content:  wr.absenceContent(groups, firing, now),
+		sendTime: now.Unix(),
+	}
+	if !w.dispatch(msg) {
+		promSends.WithLabelValues(msg.method.Method(), "dropped").Inc()
+		state.rollback(msg)
+	}
+}
+
+// absenceState 发送失败时恢复分组的报警状态，下一次检查重新发送
+type absenceState struct {
+	wr     *windowRule
+	groups []string
+	firing bool
+}
+
+func (as *absenceState) rollback(msg *message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, g := range as.groups {
+		if _, err := as.wr.window.store.SwitchAlarmFiring(ctx, as.wr.fireID(g), !as.firing, time.Unix(msg.sendTime, 0)); err != nil {
+			logs.Qezap.Error("AlarmAbsenceRollback", zap.String("rule", as.wr.id), zap.Error(err))
+		}
+	}
+}
+
+func (wr *windowRule) absenceContent(groups []string, firing bool, now time.Time) string {
+	rule := wr.rule
+	short := rule.Short
+	if short == "" {
+		short = "全部"
+	}
+	level := rule.Level.String()
+	if wr.matcher != nil && wr.matcher.levelGte {
+		level += " 及以上"
+	}
+	status := fmt.Sprintf("%ds 内没有日志", rule.WindowSec)
+	if !firing {
+		status = "已恢复"
+	}
+	target := "全部"
+	if rule.Type == model.AlarmRuleTypeIPAbsence {
+		list := groups
+		if len(list) > maxOffenders {
+			list = append(list[:maxOffenders:maxOffenders], fmt.Sprintf("等 %d 个 IP", len(groups)))
+		}
+		target = strings.Join(list, ", ")
+	}
+	str := fmt.Sprintf(`%s
+标签: %s
+模块: %s
+IP: %s
+等级: %s
+短消息: %s
+状态: %s
+时间: %s
+报警节点: %s`, wr.KeyWord(), rule.Tag, rule.ModuleName, target, level, short, status,
+		now.Format("2006-01-02 15:04:05"), machineIP)
+
+	if wr.hook != nil {
+		for _, hide := range wr.hook.HideText {
+			str = strings.ReplaceAll(str, hide, "****")
+		}
+	}
+	return str
+}
@@ -0,0 +1,83 @@
+package alarm
+
+import (
+	"testing"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWindowCount(t *testing.T) {
+	w := NewWindow(nil, config.AlarmWindow{FlushSec: 10, EvalSec: 60, MaxGroups: 2})
+	ratio := &model.AlarmRule{ID: primitive.NewObjectID(), ModuleName: "order", Level: 2, Type: model.AlarmRuleTypeRatio}
+	ip := &model.AlarmRule{ID: primitive.NewObjectID(), ModuleName: "order", Short: "timeout", Level: -1, Type: model.AlarmRuleTypeIPCount}
+	w.SetRules([]*model.AlarmRule{ratio, ip}, nil)
+	w.Count([]*model.Logging{
+		{Module: "order", Short: "timeout", Level: 2, IP: "a"},
+		{Module: "order", Short: "timeout", Level: 0, IP: "b"},
+		{Module: "order", Short: "ok", Level: 0, IP: "a"},
+		{Module: "order", Short: "timeout", Level: 3, IP: "c"},
+		{Module: "pay", Short: "timeout", Level: 2, IP: "a"},
+	})
+
+	var hit, total int64
+	for _, c := range w.rules[ratio.ID.Hex()].counts {
+		hit += c.hit
+		total += c.total
+	}
+	if hit != 2 || total != 4 {
+		t.Fatal(hit, total)
+	}
+	// 超过 MaxGroups 的 IP 不记录
+	groups := map[string]int64{}
+	for k, c := range w.rules[ip.ID.Hex()].counts {
+		groups[k.group] = c.hit
+	}
+	if len(groups) != 2 || groups["a"] != 1 || groups["b"] != 1 {
+		t.Fatal(groups)
+	}
+}
+
+func TestExceeded(t *testing.T) {
+	groups := []windowGroup{{Group: "a", Hit: 5, Total: 100}, {Group: "b", Hit: 20, Total: 100}, {Group: "c", Hit: 11}}
+
+	// 等于阈值不报警
+	if v, _, ok := exceeded(&model.AlarmRule{Type: model.AlarmRuleTypeCount, Threshold: 36}, groups); ok || v != 36 {
+		t.Fatal(v, ok)
+	}
+	if v, _, ok := exceeded(&model.AlarmRule{Type: model.AlarmRuleTypeCount, Threshold: 30}, groups); !ok || v != 36 {
+		t.Fatal(v, ok)
+	}
+	if v, _, ok := exceeded(&model.AlarmRule{Type: model.AlarmRuleTypeRatio, Threshold: 15}, groups); !ok || v != 18 {
+		t.Fatal(v, ok)
+	}
+	if _, _, ok := exceeded(&model.AlarmRule{Type: model.AlarmRuleTypeRatio, Threshold: 15}, nil); ok {
+		t.Fatal("empty window")
+	}
+	_, offenders, ok := exceeded(&model.AlarmRule{Type: model.AlarmRuleTypeIPCount, Threshold: 10}, groups)
+	if !ok || len(offenders) != 2 || offenders[0].Group != "b" || offenders[1].Group != "c" {
+		t.Fatal(offenders, ok)
+	}
+}
+
+func TestAbsentGroups(t *testing.T) {
+	absent, present := absentGroups(model.AlarmRuleTypeAbsence, nil)
+	if len(absent) != 1 || absent[0] != "" || len(present) != 0 {
+		t.Fatal(absent, present)
+	}
+	absent, present = absentGroups(model.AlarmRuleTypeAbsence, []absenceGroup{{Group: "", Recent: 1}})
+	if len(absent) != 0 || len(present) != 1 {
+		t.Fatal(absent, present)
+	}
+
+	groups := []absenceGroup{
+		{Group: "b", Recent: 0, Previous: 3},
+		{Group: "a", Recent: 2, Previous: 0},
+		{Group: "c", Recent: 1, Previous: 5},
+	}
+	absent, present = absentGroups(model.AlarmRuleTypeIPAbsence, groups)
+	if len(absent) != 1 || absent[0] != "b" || len(present) != 2 || present[0] != "a" || present[1] != "c" {
+		t.Fatal(absent, present)
+	}
+}
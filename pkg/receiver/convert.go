@@ -0,0 +1,118 @@
+package receiver
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/decoder"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+// 其他协议接入时，转换成 model.Logging 的公共方法
+
+const (
+	// 短消息过长时截断，完整内容写入 full
+	shortMaxLen = 256
+)
+
+// shortMessage 取第一行作为短消息，超出长度按字符截断
+func shortMessage(msg string) string {
+	short := msg
+	if i := strings.IndexByte(short, '\n'); i >= 0 {
+		short = strings.TrimRight(short[:i], "\r")
+	}
+	if len(short) > shortMaxLen {
+		n := shortMaxLen
+		for n > 0 && !utf8.RuneStart(short[n]) {
+			n--
+		}
+		short = short[:n]
+	}
+	return short
+}
+
+// truncateLogging 单条日志超过最大字节时截断 full，max 为 0 不限制
+func truncateLogging(doc *model.Logging, max int) {
+	if max <= 0 || doc.Size <= max {
+		return
+	}
+	n := max - len(doc.Short)
+	if n < 0 {
+		n = 0
+	}
+	if len(doc.Full) > n {
+		for n > 0 && !utf8.RuneStart(doc.Full[n]) {
+			n--
+		}
+		doc.Full = doc.Full[:n]
+	}
+	doc.Size = len(doc.Short) + len(doc.Full)
+}
+
+// levelText 兼容其他日志系统常见的等级写法 warning critical 等，未知时为 INFO
+func levelText(v string) model.Level {
+	switch strings.ToLower(v) {
+	case "warning":
+		v = "WARN"
+	case "critical", "crit", "fatal", "emerg", "alert":
+		v = "FATAL"
+	case "err", "eror":
+		v = "ERROR"
+	case "trace", "dbug":
+		v = "DEBUG"
+	}
+	if lvl := types.LevelStr2Int(v); lvl >= -1 {
+		return lvl
+	}
+	return types.LevelStr2Int("INFO")
+}
+
+// entryToLogging 按行解析出来的日志，映射字段后剩余字段写入 full
+func entryToLogging(r *model.Logging, e *decoder.Entry, tagKeys []string) {
+	r.Short = shortMessage(e.Message)
+	if r.Short != e.Message {
+		e.Fields["msg"] = e.Message
+	}
+	r.Level = levelText(e.Level)
+	r.TraceID = e.TraceID
+	if !e.Time.IsZero() {
+		r.TimeMill = e.Time.UnixNano() / 1e6
+		r.TimeSec = r.TimeMill / 1e3
+	}
+	conditions := [3]*string{&r.Condition1, &r.Condition2, &r.Condition3}
+	for i, key := range tagKeys {
+		if i >= len(conditions) {
+			break
+		}
+		*conditions[i] = e.Fields[key]
+	}
+	r.Full, _ = types.MarshalToString(e.Fields)
+}
+
+// 按 module ip 分组，统计与报警保持与数据包一致
+type loggingGroups map[[2]string][]*model.Logging
+
+func (g loggingGroups) add(module, ip string, doc *model.Logging) {
+	key := [2]string{module, ip}
+	g[key] = append(g[key], doc)
+}
+
+// insertLoggingGroups 每组生成一个包ID，某一组写入失败不影响其他组，返回第一个错误
+func (srv *Service) insertLoggingGroups(ctx context.Context, groups loggingGroups) error {
+	var firstErr error
+	for key, docs := range groups {
+		id := primitive.NewObjectID().Hex()
+		for i, doc := range docs {
+			doc.MessageID = id + "_" + strconv.Itoa(i)
+		}
+		if err := srv.InsertLogging(ctx, key[0], key[1], docs); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
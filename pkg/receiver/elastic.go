@@ -0,0 +1,182 @@
+package receiver
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/receiver/elastic"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+// InsertElasticBulk 索引映射成模块，按组写入
+// 返回每个操作的结果，与 items 顺序一致，写入失败的组对应的操作返回错误
+func (srv *Service) InsertElasticBulk(ctx context.Context, peerIP string, items []*elastic.Item) []error {
+	cfg := config.Global.Elasticsearch
+	errs := make([]error, len(items))
+	groups := make(loggingGroups)
+	groupItems := make(map[[2]string][]int)
+	for i, item := range items {
+		switch item.Action {
+		case elastic.ActionIndex, elastic.ActionCreate:
+		default:
+			// 日志只追加，不支持更新删除
+			errs[i] = httputil.ErrArgsInvalid.MergeString(item.Action + " action unsupported")
+			continue
+		}
+		if item.Err != nil {
+			errs[i] = httputil.ErrArgsInvalid.MergeError(item.Err)
+			continue
+		}
+		module := elasticIndexModule(item.Index, cfg)
+		if module == "" {
+			errs[i] = httputil.ErrArgsInvalid.MergeString("index required")
+			continue
+		}
+		doc := elasticToLogging(module, peerIP, item, cfg)
+		key := [2]string{module, doc.IP}
+		groups.add(module, doc.IP, doc)
+		groupItems[key] = append(groupItems[key], i)
+	}
+
+	for key, docs := range groups {
+		err := srv.insertLoggingGroups(ctx, loggingGroups{key: docs})
+		if err == nil {
+			continue
+		}
+		for _, i := range groupItems[key] {
+			errs[i] = err
+		}
+	}
+	return errs
+}
+
+func elasticIndexModule(index string, cfg config.Elasticsearch) string {
+	for _, v := range cfg.Indices {
+		if v.Index != "" && matchPattern(v.Index, index) {
+			return v.Module
+		}
+	}
+	if cfg.DefaultModule != "" {
+		return cfg.DefaultModule
+	}
+	return elastic.TrimIndexDate(index)
+}
+
+// firstField 读取第一个存在的字段，并从文档中删除
+func firstField(source map[string]interface{}, fields []string) (interface{}, bool) {
+	for _, field := range fields {
+		if v, ok := elastic.Lookup(source, field); ok && v != nil {
+			elastic.Delete(source, field)
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func fieldString(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	case nil:
+		return ""
+	}
+	b, _ := types.Marshal(v)
+	return string(b)
+}
+
+// elasticTimeMill 支持 RFC3339 字符串与毫秒时间戳
+func elasticTimeMill(v interface{}) int64 {
+	switch val := v.(type) {
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, val); err == nil {
+				return t.UnixNano() / 1e6
+			}
+		}
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		if f, err := val.Float64(); err == nil {
+			return int64(f)
+		}
+	}
+	return 0
+}
+
+func elasticToLogging(module, peerIP string, item *elastic.Item, cfg config.Elasticsearch) *model.Logging {
+	source := item.Source
+	if source == nil {
+		source = make(map[string]interface{})
+	}
+
+	message := ""
+	if v, ok := firstField(source, cfg.MessageFields); ok {
+		message = fieldString(v)
+	}
+	level := types.LevelStr2Int("INFO")
+	if v, ok := firstField(source, cfg.LevelFields); ok {
+		level = levelText(fieldString(v))
+	}
+	var timeMill int64
+	if v, ok := firstField(source, cfg.TimeFields); ok {
+		timeMill = elasticTimeMill(v)
+	}
+	if timeMill <= 0 {
+		timeMill = time.Now().UnixNano() / 1e6
+	}
+	ip := peerIP
+	if v, ok := firstField(source, cfg.IPFields); ok {
+		// Beats 上报的 host.ip 为数组
+		if arr, ok := v.([]interface{}); ok && len(arr) > 0 {
+			v = arr[0]
+		}
+		if s := fieldString(v); s != "" {
+			ip = s
+		}
+	}
+	traceID := ""
+	if v, ok := firstField(source, cfg.TraceFields); ok {
+		traceID = fieldString(v)
+	}
+
+	conditions := [3]string{}
+	for i, field := range cfg.ConditionFields {
+		if i >= len(conditions) {
+			break
+		}
+		if v, ok := elastic.Lookup(source, field); ok {
+			conditions[i] = fieldString(v)
+		}
+	}
+
+	short := shortMessage(message)
+	if short != message {
+		source["message"] = message
+	}
+	fullStr, _ := types.MarshalToString(source)
+
+	return &model.Logging{
+		Module:     module,
+		IP:         ip,
+		Level:      level,
+		Short:      short,
+		Full:       fullStr,
+		Condition1: conditions[0],
+		Condition2: conditions[1],
+		Condition3: conditions[2],
+		TraceID:    traceID,
+		TimeMill:   timeMill,
+		TimeSec:    timeMill / 1e3,
+		Size:       item.Size,
+	}
+}
@@ -0,0 +1,147 @@
+package elastic
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Elasticsearch _bulk NDJSON 格式
+// 每个操作一行元数据，index create 紧接着一行文档，delete 没有文档，update 的文档忽略
+// https://www.elastic.co/guide/en/elasticsearch/reference/current/docs-bulk.html
+
+var ErrInvalidBulk = errors.New("elastic invalid bulk body")
+
+const (
+	ActionIndex  = "index"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+type Item struct {
+	Action string
+	Index  string
+	ID     string
+	// 只有 index create 才有文档
+	Source map[string]interface{}
+	Size   int
+	// 文档解析失败
+	Err error
+}
+
+type actionMeta struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// ParseBulk defaultIndex 为路径 /{index}/_bulk 中的索引名
+func ParseBulk(body []byte, defaultIndex string) ([]*Item, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+
+	items := make([]*Item, 0)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		action := map[string]actionMeta{}
+		if err := json.Unmarshal(line, &action); err != nil || len(action) != 1 {
+			return nil, ErrInvalidBulk
+		}
+		item := &Item{}
+		for k, v := range action {
+			item.Action = k
+			item.Index = v.Index
+			item.ID = v.ID
+		}
+		if item.Index == "" {
+			item.Index = defaultIndex
+		}
+		switch item.Action {
+		case ActionDelete:
+			items = append(items, item)
+			continue
+		case ActionIndex, ActionCreate, ActionUpdate:
+		default:
+			return nil, ErrInvalidBulk
+		}
+		if !scanner.Scan() {
+			return nil, ErrInvalidBulk
+		}
+		if item.Action == ActionUpdate {
+			items = append(items, item)
+			continue
+		}
+		source := scanner.Bytes()
+		item.Size = len(source)
+		dec := json.NewDecoder(bytes.NewReader(source))
+		dec.UseNumber()
+		if err := dec.Decode(&item.Source); err != nil {
+			item.Err = err
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Lookup 按路径读取字段，同时支持 {"log":{"level":"x"}} 与 {"log.level":"x"} 两种写法
+func Lookup(source map[string]interface{}, path string) (interface{}, bool) {
+	if v, ok := source[path]; ok {
+		return v, true
+	}
+	i := strings.IndexByte(path, '.')
+	for i > 0 {
+		if sub, ok := source[path[:i]].(map[string]interface{}); ok {
+			if v, ok := Lookup(sub, path[i+1:]); ok {
+				return v, true
+			}
+		}
+		next := strings.IndexByte(path[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, false
+}
+
+// Delete 删除已经提取出来的字段，节约存储，与 Lookup 按相同的顺序查找路径
+func Delete(source map[string]interface{}, path string) bool {
+	if _, ok := source[path]; ok {
+		delete(source, path)
+		return true
+	}
+	i := strings.IndexByte(path, '.')
+	for i > 0 {
+		if sub, ok := source[path[:i]].(map[string]interface{}); ok {
+			if Delete(sub, path[i+1:]) {
+				if len(sub) == 0 {
+					delete(source, path[:i])
+				}
+				return true
+			}
+		}
+		next := strings.IndexByte(path[i+1:], '.')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+// 按天或按月滚动的索引后缀 nginx-2021.02.21 nginx-2021-02
+var indexDateSuffix = regexp.MustCompile(`[-_.]\d{4}[-_.]\d{2}([-_.]\d{2})?$`)
+
+// TrimIndexDate 去掉索引的日期后缀
+func TrimIndexDate(index string) string {
+	return indexDateSuffix.ReplaceAllString(index, "")
+}
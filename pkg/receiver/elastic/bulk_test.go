@@ -0,0 +1,86 @@
+package elastic
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseBulk(t *testing.T) {
+	body := `{"index":{"_index":"nginx-2021.02.21"}}
+{"message":"GET /ping","log":{"level":"info"}}
+{"create":{}}
+{"message":"timeout"}
+{"delete":{"_index":"nginx","_id":"1"}}
+{"update":{"_id":"2"}}
+{"doc":{"a":1}}
+{"index":{}}
+not json
+`
+	items, err := ParseBulk([]byte(body), "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 5 {
+		t.Fatal(len(items))
+	}
+	if items[0].Action != ActionIndex || items[0].Index != "nginx-2021.02.21" || items[0].Source["message"] != "GET /ping" {
+		t.Fatal(items[0])
+	}
+	if items[1].Action != ActionCreate || items[1].Index != "app" {
+		t.Fatal(items[1])
+	}
+	if items[2].Action != ActionDelete || items[3].Action != ActionUpdate || items[4].Err == nil {
+		t.Fatal(items[2], items[3], items[4])
+	}
+	if v, ok := Lookup(items[0].Source, "log.level"); !ok || v != "info" {
+		t.Fatal(v)
+	}
+	Delete(items[0].Source, "log.level")
+	if _, ok := items[0].Source["log"]; ok {
+		t.Fatal(items[0].Source)
+	}
+
+	if _, err := ParseBulk([]byte(`{"index":{}}`), ""); err != ErrInvalidBulk {
+		t.Fatal(err)
+	}
+}
+
+// 嵌套与带点的字段名混用时，删除与读取到的是同一个字段
+func TestLookupDelete(t *testing.T) {
+	tests := []struct {
+		source map[string]interface{}
+		left   string
+	}{
+		{map[string]interface{}{"log": map[string]interface{}{"file": map[string]interface{}{"path": "a"}}}, `map[]`},
+		{map[string]interface{}{"log.file.path": "a"}, `map[]`},
+		{map[string]interface{}{"log.file": map[string]interface{}{"path": "a"}}, `map[]`},
+		{map[string]interface{}{"log": map[string]interface{}{"file.path": "a", "offset": 1}}, `map[log:map[offset:1]]`},
+		{map[string]interface{}{"log": map[string]interface{}{"level": "x"}, "log.file": map[string]interface{}{"path": "a"}}, `map[log:map[level:x]]`},
+	}
+	for i, tt := range tests {
+		if v, ok := Lookup(tt.source, "log.file.path"); !ok || v != "a" {
+			t.Fatal(i, v)
+		}
+		if !Delete(tt.source, "log.file.path") {
+			t.Fatal(i, tt.source)
+		}
+		if v := fmt.Sprint(tt.source); v != tt.left {
+			t.Errorf("%d: %s", i, v)
+		}
+	}
+	if Delete(map[string]interface{}{"log": "x"}, "log.file.path") {
+		t.Fatal("not found")
+	}
+}
+
+func TestTrimIndexDate(t *testing.T) {
+	for in, out := range map[string]string{
+		"nginx-2021.02.21": "nginx",
+		"nginx_2021-02":    "nginx",
+		"nginx":            "nginx",
+	} {
+		if v := TrimIndexDate(in); v != out {
+			t.Fatal(in, v)
+		}
+	}
+}
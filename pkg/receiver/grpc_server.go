@@ -3,24 +3,37 @@ package receiver
 import (
 	"context"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/huzhongqing/qelog/api/receiverpb"
 	"github.com/huzhongqing/qelog/infra/httputil"
 	"github.com/huzhongqing/qelog/infra/kit"
-	"github.com/huzhongqing/qelog/pkg/storage"
+	"github.com/huzhongqing/qelog/infra/prom"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/receiver/otlp"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 type GRPCService struct {
 	server   *grpc.Server
+	health   *health.Server
 	receiver *Service
+
+	mutex    sync.Mutex
+	shutdown bool
 }
 
-func NewGRPCService() *GRPCService {
+func NewGRPCService(receiver *Service) *GRPCService {
 	srv := &GRPCService{
 		server:   nil,
-		receiver: NewService(storage.ShardingDB),
+		health:   health.NewServer(),
+		receiver: receiver,
 	}
 
 	return srv
@@ -32,10 +45,19 @@ func (srv *GRPCService) Run(addr string) error {
 		return err
 	}
 
-	server := grpc.NewServer()
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(prom.UnaryServerInterceptor())}
+	if config.Global.OTLP.Enable {
+		opts = append(opts, grpc.CustomCodec(otlp.Codec{}))
+	}
+	server := grpc.NewServer(opts...)
 	srv.server = server
 
 	receiverpb.RegisterReceiverServer(srv.server, srv)
+	if config.Global.OTLP.Enable {
+		otlp.RegisterLogsServiceServer(srv.server, srv)
+	}
+	healthpb.RegisterHealthServer(srv.server, srv.health)
+	go srv.backgroundUpdateHealth()
 
 	if err := server.Serve(listen); err != nil {
 		return err
@@ -44,8 +66,59 @@ func (srv *GRPCService) Run(addr string) error {
 	return nil
 }
 
+// backgroundUpdateHealth 与 HTTP 就绪检查使用相同的结果，关闭后停止更新
+func (srv *GRPCService) backgroundUpdateHealth() {
+	services := []string{"", "receiverpb.Receiver"}
+	if config.Global.OTLP.Enable {
+		services = append(services, otlp.ServiceName)
+	}
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+	for range tick.C {
+		if srv.isShutdown() {
+			return
+		}
+		status := healthpb.HealthCheckResponse_SERVING
+		if _, ok := checkReady(); !ok {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		for _, name := range services {
+			srv.health.SetServingStatus(name, status)
+		}
+	}
+}
+
+func (srv *GRPCService) isShutdown() bool {
+	srv.mutex.Lock()
+	defer srv.mutex.Unlock()
+	return srv.shutdown
+}
+
+// Shutdown 健康检查返回 NOT_SERVING，等待处理中的请求完成，超时后强制关闭
+func (srv *GRPCService) Shutdown(ctx context.Context) error {
+	srv.mutex.Lock()
+	srv.shutdown = true
+	srv.mutex.Unlock()
+	srv.health.Shutdown()
+
+	var err error
+	if srv.server != nil {
+		done := make(chan struct{})
+		go func() {
+			srv.server.GracefulStop()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			srv.server.Stop()
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
 func (srv *GRPCService) Close() error {
-	srv.receiver.Sync()
 	if srv.server != nil {
 		srv.server.Stop()
 	}
@@ -54,13 +127,16 @@ func (srv *GRPCService) Close() error {
 
 func (srv *GRPCService) PushPacket(ctx context.Context, in *receiverpb.Packet) (*receiverpb.BaseResp, error) {
 	// 获取 clientIP
-	if err := srv.receiver.InsertPacket(ctx, srv.clientIP(ctx), in); err != nil {
+	err := srv.receiver.InsertPacket(ctx, srv.clientIP(ctx), in)
+	observePacket("grpc", err)
+	if err != nil {
 		e, ok := err.(httputil.Error)
 		if ok {
 			// 数据库操作错误
 			if e.Code == httputil.ErrCodeSystemException {
 				return nil, httputil.ErrSystemException
 			}
+			// 超出配额返回 ErrCodeThrottled，客户端稍后重试
 			return &receiverpb.BaseResp{
 				Code:    int32(e.Code),
 				Message: e.Message,
@@ -74,6 +150,27 @@ func (srv *GRPCService) PushPacket(ctx context.Context, in *receiverpb.Packet) (
 	}, nil
 }
 
+// Export OTLP/gRPC 日志写入
+func (srv *GRPCService) Export(ctx context.Context, in *otlp.ExportLogsServiceRequest) (*otlp.ExportLogsServiceResponse, error) {
+	if err := srv.receiver.InsertOTLPLogs(ctx, srv.clientIP(ctx), in); err != nil {
+		e, ok := err.(httputil.Error)
+		if !ok {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		switch e.Code {
+		case httputil.ErrCodeSystemException:
+			// 客户端会进行重试
+			return nil, status.Error(codes.Unavailable, e.Message)
+		case httputil.ErrCodeThrottled:
+			return nil, status.Error(codes.ResourceExhausted, e.Message)
+		case httputil.ErrCodeNotFound:
+			return nil, status.Error(codes.NotFound, e.Message)
+		}
+		return nil, status.Error(codes.InvalidArgument, e.Message)
+	}
+	return &otlp.ExportLogsServiceResponse{}, nil
+}
+
 func (srv *GRPCService) clientIP(ctx context.Context) string {
 	ctxPeer, ok := peer.FromContext(ctx)
 	if ok && ctxPeer.Addr != nil {
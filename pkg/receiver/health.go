@@ -0,0 +1,55 @@
+package receiver
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// 进程级别的健康状态，HTTP 与 gRPC 接入服务共享
+// 存活检查只表示进程可以响应，就绪检查需要主库与所有分片可用，且不在下线状态
+
+var (
+	draining int32
+
+	readyMutex   sync.Mutex
+	readyAt      time.Time
+	readyResults []storage.PingResult
+	readyOK      bool
+	// 就绪检查结果缓存时间，避免探针频繁访问 Mongodb
+	readyTTL = 2 * time.Second
+)
+
+// Drain 进入下线状态，就绪检查返回失败，负载均衡摘除后再关闭服务
+func Drain() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+func isDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// checkReady 下线状态时不再检查 Mongodb
+func checkReady() (results []storage.PingResult, ok bool) {
+	if isDraining() {
+		return nil, false
+	}
+	readyMutex.Lock()
+	defer readyMutex.Unlock()
+	if time.Since(readyAt) < readyTTL {
+		return readyResults, readyOK
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	results = storage.ShardingDB.Ping(ctx)
+	ok = true
+	for _, v := range results {
+		ok = ok && v.OK
+	}
+	readyAt, readyResults, readyOK = time.Now(), results, ok
+	return results, ok
+}
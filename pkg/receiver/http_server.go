@@ -1,25 +1,36 @@
 package receiver
 
 import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/huzhongqing/qelog/api"
+	"github.com/huzhongqing/qelog/pkg/receiver/elastic"
+	"github.com/huzhongqing/qelog/pkg/receiver/loki"
+	"github.com/huzhongqing/qelog/pkg/receiver/otlp"
+	"github.com/huzhongqing/qelog/pkg/receiver/worker"
 
 	"github.com/gin-gonic/gin"
 	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/infra/prom"
 	"github.com/huzhongqing/qelog/pkg/config"
-	"github.com/huzhongqing/qelog/pkg/storage"
 )
 
 type HTTPService struct {
-	server   *http.Server
-	receiver *Service
+	server      *http.Server
+	adminServer *http.Server
+	receiver    *Service
 }
 
-func NewHTTPService() *HTTPService {
+func NewHTTPService(receiver *Service) *HTTPService {
 	srv := &HTTPService{
-		receiver: NewService(storage.ShardingDB),
+		receiver: receiver,
 	}
 	return srv
 }
@@ -29,10 +40,31 @@ func (srv *HTTPService) Run(addr string) error {
 	if config.Global.Release() {
 		gin.SetMode(gin.ReleaseMode)
 	}
-	handler.Use(gin.Recovery())
+	handler.Use(gin.Recovery(), prom.GinMiddleware("receiver"))
 
 	handler.HEAD("/", func(c *gin.Context) { c.Status(200) })
+	handler.GET("/health/live", srv.Live)
+	handler.GET("/health/ready", srv.Ready)
 	handler.POST("/v1/receiver/packet", srv.ReceivePacket)
+	if config.Global.OTLP.Enable {
+		handler.POST("/v1/logs", srv.ReceiveOTLPLogs)
+	}
+	if config.Global.Loki.Enable {
+		handler.POST("/loki/api/v1/push", srv.ReceiveLokiPush)
+	}
+	if config.Global.Elasticsearch.Enable {
+		// 客户端启动时会请求版本信息
+		handler.GET("/", srv.ElasticInfo)
+		handler.POST("/_bulk", srv.ReceiveElasticBulk)
+		// /{index}/_bulk 与其他路由的通配冲突，在未匹配的路由中处理
+		handler.NoRoute(func(c *gin.Context) {
+			if c.Request.Method == http.MethodPost && strings.HasSuffix(c.Request.URL.Path, "/_bulk") {
+				srv.ReceiveElasticBulk(c)
+				return
+			}
+			c.Status(http.StatusNotFound)
+		})
+	}
 
 	srv.server = &http.Server{
 		Addr:         addr,
@@ -41,17 +73,75 @@ func (srv *HTTPService) Run(addr string) error {
 		WriteTimeout: 120 * time.Second,
 	}
 
-	return srv.server.ListenAndServe()
+	// Shutdown 与 Close 之后返回 ErrServerClosed，不是异常
+	if err := srv.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// RunAdmin 监控与内部状态没有鉴权，不在写入端口上暴露
+func (srv *HTTPService) RunAdmin(addr string) error {
+	handler := gin.New()
+	handler.Use(gin.Recovery())
+	handler.GET("/v1/receiver/status", srv.Status)
+	handler.GET("/metrics", prom.GinHandler())
+
+	srv.adminServer = &http.Server{
+		Addr:         addr,
+		Handler:      handler,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 30 * time.Second,
+	}
+	if err := srv.adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 func (srv *HTTPService) Close() error {
-	srv.receiver.Sync()
+	if srv.adminServer != nil {
+		_ = srv.adminServer.Close()
+	}
 	if srv.server != nil {
 		_ = srv.server.Close()
 	}
 	return nil
 }
 
+// Shutdown 等待处理中的请求写入完成，超时后强制关闭
+func (srv *HTTPService) Shutdown(ctx context.Context) error {
+	var err error
+	if srv.server != nil {
+		if err = srv.server.Shutdown(ctx); err != nil {
+			_ = srv.server.Close()
+		}
+	}
+	if srv.adminServer != nil {
+		_ = srv.adminServer.Close()
+	}
+	return err
+}
+
+func (srv *HTTPService) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready 下线状态或任一 Mongodb 实例不可用时返回 503
+func (srv *HTTPService) Ready(c *gin.Context) {
+	results, ok := checkReady()
+	httpCode, status := http.StatusOK, "ok"
+	if !ok {
+		httpCode, status = http.StatusServiceUnavailable, "unavailable"
+	}
+	c.JSON(httpCode, gin.H{"status": status, "draining": isDraining(), "checks": results})
+}
+
+// Status 内部状态，进程内所有接入服务的报警与统计队列
+func (srv *HTTPService) Status(c *gin.Context) {
+	httputil.RespData(c, http.StatusOK, gin.H{"queues": worker.AllStats()})
+}
+
 func (srv *HTTPService) ReceivePacket(c *gin.Context) {
 	in := &api.JSONPacket{}
 	if err := c.ShouldBind(in); err != nil {
@@ -59,9 +149,199 @@ func (srv *HTTPService) ReceivePacket(c *gin.Context) {
 		return
 	}
 
-	if err := srv.receiver.InsertJSONPacket(c.Request.Context(), c.ClientIP(), in); err != nil {
-		httputil.RespDataWithError(c, http.StatusBadRequest, nil, err)
+	err := srv.receiver.InsertJSONPacket(c.Request.Context(), c.ClientIP(), in)
+	observePacket("http", err)
+	if err != nil {
+		// 客户端只丢弃 400 的数据，其他状态稍后重试
+		httputil.RespDataWithError(c, retryableStatus(err), nil, err)
 		return
 	}
 	httputil.RespSuccess(c)
 }
+
+const (
+	contentTypeProtobuf = "application/x-protobuf"
+	// 单次请求体最大字节
+	maxRequestBodySize = 32 << 20
+)
+
+// errBodyTooLarge 压缩前或解压后的请求体超过 maxRequestBodySize，返回 413
+var errBodyTooLarge = errors.New("request body too large")
+
+// readBody 读取请求体，支持 gzip 压缩，多读一个字节判断是否超过限制，不截断
+func readBody(c *gin.Context) ([]byte, error) {
+	raw := &io.LimitedReader{R: c.Request.Body, N: maxRequestBodySize + 1}
+	var r io.Reader = raw
+	if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+		gr, err := gzip.NewReader(raw)
+		if err != nil {
+			if raw.N <= 0 {
+				return nil, errBodyTooLarge
+			}
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r, maxRequestBodySize+1))
+	if raw.N <= 0 || len(body) > maxRequestBodySize {
+		return nil, errBodyTooLarge
+	}
+	return body, err
+}
+
+// bodyStatus 读取请求体失败时的状态码
+func bodyStatus(err error) int {
+	if err == errBodyTooLarge {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// retryableStatus 数据库异常与超出配额可重试，其余错误重试也不会成功
+func retryableStatus(err error) int {
+	if e, ok := err.(httputil.Error); ok {
+		switch e.Code {
+		case httputil.ErrCodeSystemException:
+			return http.StatusServiceUnavailable
+		case httputil.ErrCodeThrottled:
+			return http.StatusTooManyRequests
+		}
+	}
+	return http.StatusBadRequest
+}
+
+// ReceiveOTLPLogs OTLP/HTTP 支持 protobuf 与 json 编码
+func (srv *HTTPService) ReceiveOTLPLogs(c *gin.Context) {
+	isProto := strings.HasPrefix(c.ContentType(), contentTypeProtobuf)
+	respStatus := func(httpCode int, err error) {
+		msg := err.Error()
+		if e, ok := err.(httputil.Error); ok {
+			msg = e.Message
+		}
+		if isProto {
+			c.Data(httpCode, contentTypeProtobuf, otlp.MarshalStatus(int32(httpCode), msg))
+			return
+		}
+		c.JSON(httpCode, gin.H{"code": httpCode, "message": msg})
+	}
+
+	body, err := readBody(c)
+	if err != nil {
+		respStatus(bodyStatus(err), err)
+		return
+	}
+	in := &otlp.ExportLogsServiceRequest{}
+	if isProto {
+		err = otlp.UnmarshalProto(body, in)
+	} else {
+		err = otlp.UnmarshalJSON(body, in)
+	}
+	if err != nil {
+		respStatus(http.StatusBadRequest, err)
+		return
+	}
+
+	if err := srv.receiver.InsertOTLPLogs(c.Request.Context(), c.ClientIP(), in); err != nil {
+		respStatus(retryableStatus(err), err)
+		return
+	}
+	if isProto {
+		c.Data(http.StatusOK, contentTypeProtobuf, []byte{})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ReceiveLokiPush 支持 json 与 snappy 压缩的 protobuf 编码
+func (srv *HTTPService) ReceiveLokiPush(c *gin.Context) {
+	body, err := readBody(c)
+	if err != nil {
+		c.String(bodyStatus(err), err.Error())
+		return
+	}
+	in := &loki.PushRequest{}
+	if strings.HasPrefix(c.ContentType(), contentTypeProtobuf) {
+		err = loki.UnmarshalSnappyProto(body, maxRequestBodySize, in)
+	} else {
+		err = loki.UnmarshalJSON(body, in)
+	}
+	if err == loki.ErrTooLarge {
+		c.String(http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := srv.receiver.InsertLokiPush(c.Request.Context(), c.ClientIP(), in); err != nil {
+		c.String(retryableStatus(err), err.Error())
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+const elasticVersion = "7.10.2"
+
+func (srv *HTTPService) ElasticInfo(c *gin.Context) {
+	c.Header("X-Elastic-Product", "Elasticsearch")
+	c.JSON(http.StatusOK, gin.H{
+		"name":         "qelog",
+		"cluster_name": "qelog",
+		"version": gin.H{
+			"number":         elasticVersion,
+			"build_flavor":   "default",
+			"lucene_version": "8.7.0",
+		},
+		"tagline": "You Know, for Search",
+	})
+}
+
+// ReceiveElasticBulk 按 Elasticsearch bulk 的格式返回每个操作的结果
+func (srv *HTTPService) ReceiveElasticBulk(c *gin.Context) {
+	c.Header("X-Elastic-Product", "Elasticsearch")
+	respError := func(httpCode int, err error) {
+		c.JSON(httpCode, gin.H{
+			"error":  gin.H{"type": "illegal_argument_exception", "reason": err.Error()},
+			"status": httpCode,
+		})
+	}
+
+	start := time.Now()
+	body, err := readBody(c)
+	if err != nil {
+		respError(bodyStatus(err), err)
+		return
+	}
+	index := strings.Trim(strings.TrimSuffix(c.Request.URL.Path, "/_bulk"), "/")
+	items, err := elastic.ParseBulk(body, index)
+	if err != nil {
+		respError(http.StatusBadRequest, err)
+		return
+	}
+
+	errs := srv.receiver.InsertElasticBulk(c.Request.Context(), c.ClientIP(), items)
+	hasErrors := false
+	respItems := make([]gin.H, 0, len(items))
+	for i, item := range items {
+		result := gin.H{"_index": item.Index, "_id": item.ID, "status": http.StatusCreated, "result": "created"}
+		if err := errs[i]; err != nil {
+			hasErrors = true
+			status := http.StatusBadRequest
+			if retryableStatus(err) != http.StatusBadRequest {
+				// 客户端会重试 429 的操作
+				status = http.StatusTooManyRequests
+			}
+			delete(result, "result")
+			result["status"] = status
+			result["error"] = gin.H{"type": "illegal_argument_exception", "reason": err.Error()}
+		}
+		respItems = append(respItems, gin.H{item.Action: result})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"took":   time.Since(start).Milliseconds(),
+		"errors": hasErrors,
+		"items":  respItems,
+	})
+}
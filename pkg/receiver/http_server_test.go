@@ -2,14 +2,17 @@ package receiver
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/huzhongqing/qelog/api"
 )
 
@@ -64,3 +67,39 @@ func TestHTTPService_ReceivePacket(t *testing.T) {
 	}
 	JSONOutput(resp, t)
 }
+
+// 超过限制时返回 413，不截断，gzip 按解压后的大小判断
+func TestReadBody(t *testing.T) {
+	gz := func(b []byte) []byte {
+		buf := &bytes.Buffer{}
+		w := gzip.NewWriter(buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	tests := []struct {
+		body     []byte
+		encoding string
+		want     error
+	}{
+		{make([]byte, maxRequestBodySize), "", nil},
+		{make([]byte, maxRequestBodySize+1), "", errBodyTooLarge},
+		{gz([]byte("hello")), "gzip", nil},
+		{gz(make([]byte, maxRequestBodySize+1)), "gzip", errBodyTooLarge},
+	}
+	for i, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+		c.Request.Header.Set("Content-Encoding", tt.encoding)
+		body, err := readBody(c)
+		if err != tt.want {
+			t.Fatal(i, err)
+		}
+		if err == nil && tt.encoding == "" && len(body) != len(tt.body) {
+			t.Fatal(i, len(body))
+		}
+	}
+	if bodyStatus(errBodyTooLarge) != http.StatusRequestEntityTooLarge {
+		t.Fatal("status")
+	}
+}
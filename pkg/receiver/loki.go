@@ -0,0 +1,105 @@
+package receiver
+
+import (
+	"context"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/decoder"
+	"github.com/huzhongqing/qelog/pkg/receiver/loki"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+// InsertLokiPush 流标签映射成模块与IP，按组写入
+func (srv *Service) InsertLokiPush(ctx context.Context, peerIP string, in *loki.PushRequest) error {
+	cfg := config.Global.Loki
+	groups := make(loggingGroups)
+	for _, stream := range in.Streams {
+		module := firstLabel(stream.Labels, cfg.ModuleLabels)
+		if module == "" {
+			module = cfg.DefaultModule
+		}
+		if module == "" {
+			return httputil.ErrArgsInvalid.MergeString("stream module label required")
+		}
+		ip := firstLabel(stream.Labels, cfg.IPLabels)
+		if ip == "" {
+			ip = peerIP
+		}
+		dec := srv.moduleDecoder(module)
+		for _, entry := range stream.Entries {
+			groups.add(module, ip, lokiToLogging(dec, module, ip, stream.Labels, entry, cfg))
+		}
+	}
+	return srv.insertLoggingGroups(ctx, groups)
+}
+
+func firstLabel(labels map[string]string, keys []string) string {
+	for _, key := range keys {
+		if v := labels[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func lokiToLogging(dec *decoder.Decoder, module, ip string, labels map[string]string, entry loki.Entry, cfg config.Loki) *model.Logging {
+	timeMill := entry.Timestamp.UnixNano() / 1e6
+
+	// qezap 编码或模块配置了解析方式的日志行，按数据包的方式解析
+	if r, ok := decodeLogging(dec, module, ip, []byte(entry.Line)); ok && r.Short != "" {
+		if r.TimeMill <= 0 {
+			r.TimeMill = timeMill
+			r.TimeSec = timeMill / 1e3
+		}
+		return r
+	}
+
+	full := make(map[string]interface{}, len(labels)+len(entry.Metadata)+1)
+	for k, v := range labels {
+		full[k] = v
+	}
+	for k, v := range entry.Metadata {
+		full[k] = v
+	}
+	short := shortMessage(entry.Line)
+	if short != entry.Line {
+		full["line"] = entry.Line
+	}
+	fullStr, _ := types.MarshalToString(full)
+
+	level := types.LevelStr2Int("INFO")
+	if v := firstLabel(entry.Metadata, cfg.LevelLabels); v != "" {
+		level = levelText(v)
+	} else if v := firstLabel(labels, cfg.LevelLabels); v != "" {
+		level = levelText(v)
+	}
+
+	conditions := [3]string{}
+	for i, key := range cfg.ConditionLabels {
+		if i >= len(conditions) {
+			break
+		}
+		if v, ok := entry.Metadata[key]; ok {
+			conditions[i] = v
+		} else {
+			conditions[i] = labels[key]
+		}
+	}
+
+	return &model.Logging{
+		Module:     module,
+		IP:         ip,
+		Level:      level,
+		Short:      short,
+		Full:       fullStr,
+		Condition1: conditions[0],
+		Condition2: conditions[1],
+		Condition3: conditions[2],
+		TraceID:    entry.Metadata["trace_id"],
+		TimeMill:   timeMill,
+		TimeSec:    timeMill / 1e3,
+		Size:       len(entry.Line) + len(fullStr),
+	}
+}
@@ -0,0 +1,274 @@
+package loki
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Loki push API /loki/api/v1/push
+// 支持 JSON 与 snappy 压缩的 protobuf 两种编码
+// https://grafana.com/docs/loki/latest/reference/loki-http-api/#ingest-logs
+
+var (
+	ErrInvalidProto  = errors.New("loki invalid protobuf")
+	ErrInvalidLabels = errors.New("loki invalid labels")
+	// 解压后超过调用方的限制
+	ErrTooLarge = errors.New("loki decoded body too large")
+)
+
+type PushRequest struct {
+	Streams []Stream
+}
+
+type Stream struct {
+	Labels  map[string]string
+	Entries []Entry
+}
+
+type Entry struct {
+	Timestamp time.Time
+	Line      string
+	// 结构化元数据，Loki 2.9 以后支持
+	Metadata map[string]string
+}
+
+type jsonPushRequest struct {
+	Streams []struct {
+		Stream map[string]string   `json:"stream"`
+		Values [][]json.RawMessage `json:"values"`
+	} `json:"streams"`
+}
+
+func UnmarshalJSON(b []byte, req *PushRequest) error {
+	in := jsonPushRequest{}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	for _, js := range in.Streams {
+		stream := Stream{Labels: js.Stream, Entries: make([]Entry, 0, len(js.Values))}
+		for _, v := range js.Values {
+			if len(v) < 2 {
+				continue
+			}
+			var tsStr, line string
+			if err := json.Unmarshal(v[0], &tsStr); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(v[1], &line); err != nil {
+				return err
+			}
+			ns, err := strconv.ParseInt(tsStr, 10, 64)
+			if err != nil {
+				return err
+			}
+			entry := Entry{Timestamp: time.Unix(0, ns), Line: line}
+			if len(v) >= 3 {
+				_ = json.Unmarshal(v[2], &entry.Metadata)
+			}
+			stream.Entries = append(stream.Entries, entry)
+		}
+		req.Streams = append(req.Streams, stream)
+	}
+	return nil
+}
+
+// UnmarshalSnappyProto 请求体为 snappy block 压缩的 logproto.PushRequest，解压前按头部的长度检查 maxSize
+func UnmarshalSnappyProto(b []byte, maxSize int, req *PushRequest) error {
+	n, err := snappy.DecodedLen(b)
+	if err != nil {
+		return err
+	}
+	if n > maxSize {
+		return ErrTooLarge
+	}
+	data, err := snappy.Decode(nil, b)
+	if err != nil {
+		return err
+	}
+	return UnmarshalProto(data, req)
+}
+
+// PushRequest { repeated StreamAdapter streams = 1; }
+// StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+// EntryAdapter { Timestamp timestamp = 1; string line = 2; repeated LabelPairAdapter structuredMetadata = 3; }
+func UnmarshalProto(b []byte, req *PushRequest) error {
+	return consumeMessage(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		stream := Stream{}
+		err := consumeMessage(v, func(num protowire.Number, v []byte) error {
+			switch num {
+			case 1:
+				labels, err := ParseLabels(string(v))
+				if err != nil {
+					return err
+				}
+				stream.Labels = labels
+			case 2:
+				entry, err := unmarshalEntry(v)
+				if err != nil {
+					return err
+				}
+				stream.Entries = append(stream.Entries, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		req.Streams = append(req.Streams, stream)
+		return nil
+	})
+}
+
+func unmarshalEntry(b []byte) (Entry, error) {
+	entry := Entry{}
+	err := consumeMessage(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			var sec, nsec int64
+			err := consumeVarints(v, func(num protowire.Number, n uint64) {
+				switch num {
+				case 1:
+					sec = int64(n)
+				case 2:
+					nsec = int64(int32(n))
+				}
+			})
+			if err != nil {
+				return err
+			}
+			entry.Timestamp = time.Unix(sec, nsec)
+		case 2:
+			entry.Line = string(v)
+		case 3:
+			var name, value string
+			err := consumeMessage(v, func(num protowire.Number, v []byte) error {
+				switch num {
+				case 1:
+					name = string(v)
+				case 2:
+					value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if entry.Metadata == nil {
+				entry.Metadata = make(map[string]string)
+			}
+			entry.Metadata[name] = value
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// consumeMessage 只回调 bytes 类型的字段，其他类型跳过
+func consumeMessage(b []byte, fn func(num protowire.Number, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		b = b[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return ErrInvalidProto
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		if err := fn(num, v); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func consumeVarints(b []byte, fn func(num protowire.Number, v uint64)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		b = b[n:]
+		if typ != protowire.VarintType {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return ErrInvalidProto
+			}
+			b = b[n:]
+			continue
+		}
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		fn(num, v)
+		b = b[n:]
+	}
+	return nil
+}
+
+// ParseLabels 解析 Prometheus 格式的标签 {app="nginx", env="prod"}
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, ErrInvalidLabels
+	}
+	s = s[1 : len(s)-1]
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if s == "" {
+			return labels, nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return nil, ErrInvalidLabels
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+2:]
+
+		var sb strings.Builder
+		closed := false
+		i := 0
+		for ; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				default:
+					sb.WriteByte(s[i])
+				}
+				continue
+			}
+			if s[i] == '"' {
+				closed = true
+				break
+			}
+			sb.WriteByte(s[i])
+		}
+		if !closed {
+			return nil, ErrInvalidLabels
+		}
+		labels[name] = sb.String()
+		s = s[i+1:]
+	}
+}
@@ -0,0 +1,75 @@
+package loki
+
+import (
+	"testing"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels(`{app="nginx", env="prod",msg="a \"b\""}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labels["app"] != "nginx" || labels["env"] != "prod" || labels["msg"] != `a "b"` {
+		t.Fatal(labels)
+	}
+	if _, err := ParseLabels(`{app=nginx}`); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	str := `{"streams":[{"stream":{"app":"nginx"},"values":[["1607961003768000000","GET /ping"],
+["1607961003769000000","timeout",{"trace_id":"abc"}]]}]}`
+	req := &PushRequest{}
+	if err := UnmarshalJSON([]byte(str), req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Streams) != 1 || len(req.Streams[0].Entries) != 2 {
+		t.Fatal(req)
+	}
+	entry := req.Streams[0].Entries[1]
+	if entry.Line != "timeout" || entry.Metadata["trace_id"] != "abc" || entry.Timestamp.UnixNano() != 1607961003769000000 {
+		t.Fatal(entry)
+	}
+}
+
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func TestUnmarshalSnappyProto(t *testing.T) {
+	ts := protowire.AppendTag(nil, 1, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, 1607961003)
+	ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+	ts = protowire.AppendVarint(ts, 768000000)
+
+	entry := appendMessage(nil, 1, ts)
+	entry = appendMessage(entry, 2, []byte("GET /ping"))
+	label := appendMessage(nil, 1, []byte("trace_id"))
+	label = appendMessage(label, 2, []byte("abc"))
+	entry = appendMessage(entry, 3, label)
+
+	stream := appendMessage(nil, 1, []byte(`{app="nginx"}`))
+	stream = appendMessage(stream, 2, entry)
+	data := appendMessage(nil, 1, stream)
+
+	req := &PushRequest{}
+	if err := UnmarshalSnappyProto(snappy.Encode(nil, data), len(data), req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Streams) != 1 || req.Streams[0].Labels["app"] != "nginx" || len(req.Streams[0].Entries) != 1 {
+		t.Fatal(req)
+	}
+	e := req.Streams[0].Entries[0]
+	if e.Line != "GET /ping" || e.Metadata["trace_id"] != "abc" || e.Timestamp.UnixNano()/1e6 != 1607961003768 {
+		t.Fatal(e)
+	}
+	// 解压后超过限制
+	if err := UnmarshalSnappyProto(snappy.Encode(nil, data), len(data)-1, &PushRequest{}); err != ErrTooLarge {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,132 @@
+package receiver
+
+import (
+	"context"
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/receiver/otlp"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+// InsertOTLPLogs 资源属性映射成模块与IP，按组写入
+func (srv *Service) InsertOTLPLogs(ctx context.Context, peerIP string, in *otlp.ExportLogsServiceRequest) error {
+	cfg := config.Global.OTLP
+	groups := make(loggingGroups)
+	for _, rl := range in.ResourceLogs {
+		module := firstAttribute(rl.Resource.Attributes, cfg.ModuleAttributes)
+		if module == "" {
+			module = cfg.DefaultModule
+		}
+		if module == "" {
+			return httputil.ErrArgsInvalid.MergeString("resource module attribute required")
+		}
+		ip := firstAttribute(rl.Resource.Attributes, cfg.IPAttributes)
+		if ip == "" {
+			ip = peerIP
+		}
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				groups.add(module, ip, otlpToLogging(module, ip, sl.Scope, lr, cfg.ConditionAttributes))
+			}
+		}
+	}
+	return srv.insertLoggingGroups(ctx, groups)
+}
+
+func firstAttribute(attrs otlp.Attributes, keys []string) string {
+	for _, key := range keys {
+		if v, ok := attrs.Get(key); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// SeverityNumber 1-4 TRACE 5-8 DEBUG 9-12 INFO 13-16 WARN 17-20 ERROR 21-24 FATAL
+func otlpSeverityToLevel(number int32, text string) model.Level {
+	switch {
+	case number >= 1 && number <= 8:
+		return types.LevelStr2Int("DEBUG")
+	case number >= 9 && number <= 12:
+		return types.LevelStr2Int("INFO")
+	case number >= 13 && number <= 16:
+		return types.LevelStr2Int("WARN")
+	case number >= 17 && number <= 20:
+		return types.LevelStr2Int("ERROR")
+	case number >= 21:
+		return types.LevelStr2Int("FATAL")
+	}
+	// 未设置等级编号时，尝试使用等级文本
+	if lvl := types.LevelStr2Int(text); lvl >= -1 {
+		return lvl
+	}
+	return types.LevelStr2Int("INFO")
+}
+
+// otlpBody 返回作为短消息的文本，结构化的内容原样返回保存在详情中
+func otlpBody(body interface{}) (string, interface{}) {
+	switch v := body.(type) {
+	case map[string]interface{}:
+		// 结构化的内容，尝试读取常用的消息字段
+		for _, key := range []string{"message", "msg"} {
+			if msg, ok := v[key].(string); ok {
+				return msg, v
+			}
+		}
+		return "", v
+	case []interface{}:
+		// 数组没有消息字段，整体作为消息
+		msg, _ := types.MarshalToString(v)
+		return msg, v
+	}
+	return otlp.ValueString(body), nil
+}
+
+func otlpToLogging(module, ip string, scope otlp.Scope, lr otlp.LogRecord, conditionAttributes []string) *model.Logging {
+	full := lr.Attributes.Map()
+
+	message, structured := otlpBody(lr.Body)
+	short := shortMessage(message)
+	if structured != nil {
+		full["body"] = structured
+	} else if short != message {
+		full["body"] = message
+	}
+	if v := lr.SpanIDHex(); v != "" {
+		full["span_id"] = v
+	}
+	if scope.Name != "" {
+		full["scope"] = scope.Name
+	}
+	fullStr, _ := types.MarshalToString(full)
+
+	conditions := [3]string{}
+	for i, key := range conditionAttributes {
+		if i >= len(conditions) {
+			break
+		}
+		conditions[i], _ = lr.Attributes.Get(key)
+	}
+
+	timeMill := lr.TimeMill()
+	if timeMill <= 0 {
+		timeMill = time.Now().UnixNano() / 1e6
+	}
+	return &model.Logging{
+		Module:     module,
+		IP:         ip,
+		Level:      otlpSeverityToLevel(lr.SeverityNumber, lr.SeverityText),
+		Short:      short,
+		Full:       fullStr,
+		Condition1: conditions[0],
+		Condition2: conditions[1],
+		Condition3: conditions[2],
+		TraceID:    lr.TraceIDHex(),
+		TimeMill:   timeMill,
+		TimeSec:    timeMill / 1e3,
+		Size:       len(message) + len(fullStr),
+	}
+}
@@ -0,0 +1,87 @@
+package otlp
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	// 注册默认的 proto 编码
+	_ "google.golang.org/grpc/encoding/proto"
+)
+
+// OTLP/gRPC 日志服务
+// 请求体由 Codec 直接解析成 ExportLogsServiceRequest，其余服务仍然使用默认的 proto 编码
+
+const ServiceName = "opentelemetry.proto.collector.logs.v1.LogsService"
+
+type LogsServiceServer interface {
+	Export(ctx context.Context, in *ExportLogsServiceRequest) (*ExportLogsServiceResponse, error)
+}
+
+func RegisterLogsServiceServer(s *grpc.Server, srv LogsServiceServer) {
+	s.RegisterService(&logsServiceDesc, srv)
+}
+
+var logsServiceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*LogsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Export",
+			Handler:    exportHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "opentelemetry/proto/collector/logs/v1/logs_service.proto",
+}
+
+func exportHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportLogsServiceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogsServiceServer).Export(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + ServiceName + "/Export",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogsServiceServer).Export(ctx, req.(*ExportLogsServiceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Codec 通过 grpc.CustomCodec 设置到服务端
+type Codec struct{}
+
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case *ExportLogsServiceResponse:
+		// 空消息
+		return []byte{}, nil
+	}
+	return protoCodec().Marshal(v)
+}
+
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	switch val := v.(type) {
+	case *ExportLogsServiceRequest:
+		return UnmarshalProto(data, val)
+	}
+	return protoCodec().Unmarshal(data, v)
+}
+
+func (Codec) String() string {
+	return "proto"
+}
+
+func protoCodec() encoding.Codec {
+	codec := encoding.GetCodec("proto")
+	if codec == nil {
+		panic(fmt.Sprintf("grpc codec %s unregistered", "proto"))
+	}
+	return codec
+}
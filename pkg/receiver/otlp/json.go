@@ -0,0 +1,151 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+)
+
+// OTLP/JSON 编码规则
+// 字段为小驼峰，64位整数可能为字符串，traceId spanId 为十六进制字符串
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+type jsonRequest struct {
+	ResourceLogs []jsonResourceLogs `json:"resourceLogs"`
+}
+
+type jsonResourceLogs struct {
+	Resource struct {
+		Attributes []jsonKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []jsonScopeLogs `json:"scopeLogs"`
+	// 已废弃的字段名，兼容旧版本 SDK
+	InstrumentationLibraryLogs []jsonScopeLogs `json:"instrumentationLibraryLogs"`
+}
+
+type jsonScopeLogs struct {
+	Scope                  jsonScope       `json:"scope"`
+	InstrumentationLibrary jsonScope       `json:"instrumentationLibrary"`
+	LogRecords             []jsonLogRecord `json:"logRecords"`
+}
+
+type jsonScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type jsonLogRecord struct {
+	TimeUnixNano         json.Number    `json:"timeUnixNano"`
+	ObservedTimeUnixNano json.Number    `json:"observedTimeUnixNano"`
+	SeverityNumber       int32          `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 *jsonAnyValue  `json:"body"`
+	Attributes           []jsonKeyValue `json:"attributes"`
+	TraceID              string         `json:"traceId"`
+	SpanID               string         `json:"spanId"`
+}
+
+type jsonKeyValue struct {
+	Key   string        `json:"key"`
+	Value *jsonAnyValue `json:"value"`
+}
+
+type jsonAnyValue struct {
+	StringValue *string      `json:"stringValue"`
+	BoolValue   *bool        `json:"boolValue"`
+	IntValue    *json.Number `json:"intValue"`
+	DoubleValue *float64     `json:"doubleValue"`
+	ArrayValue  *struct {
+		Values []*jsonAnyValue `json:"values"`
+	} `json:"arrayValue"`
+	KvlistValue *struct {
+		Values []jsonKeyValue `json:"values"`
+	} `json:"kvlistValue"`
+	BytesValue []byte `json:"bytesValue"`
+}
+
+func UnmarshalJSON(b []byte, req *ExportLogsServiceRequest) error {
+	in := jsonRequest{}
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	for _, jrl := range in.ResourceLogs {
+		rl := ResourceLogs{
+			Resource: Resource{Attributes: jsonAttributes(jrl.Resource.Attributes)},
+		}
+		for _, jsl := range append(jrl.ScopeLogs, jrl.InstrumentationLibraryLogs...) {
+			sl := ScopeLogs{Scope: Scope{Name: jsl.Scope.Name, Version: jsl.Scope.Version}}
+			if sl.Scope.Name == "" {
+				sl.Scope = Scope{Name: jsl.InstrumentationLibrary.Name, Version: jsl.InstrumentationLibrary.Version}
+			}
+			for _, jlr := range jsl.LogRecords {
+				lr := LogRecord{
+					TimeUnixNano:         jsonUint64(jlr.TimeUnixNano),
+					ObservedTimeUnixNano: jsonUint64(jlr.ObservedTimeUnixNano),
+					SeverityNumber:       jlr.SeverityNumber,
+					SeverityText:         jlr.SeverityText,
+					Body:                 jlr.Body.value(),
+					Attributes:           jsonAttributes(jlr.Attributes),
+				}
+				lr.TraceID, _ = hex.DecodeString(jlr.TraceID)
+				lr.SpanID, _ = hex.DecodeString(jlr.SpanID)
+				sl.LogRecords = append(sl.LogRecords, lr)
+			}
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		}
+		req.ResourceLogs = append(req.ResourceLogs, rl)
+	}
+	return nil
+}
+
+func (v *jsonAnyValue) value() interface{} {
+	if v == nil {
+		return nil
+	}
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return *v.BoolValue
+	case v.IntValue != nil:
+		i, _ := v.IntValue.Int64()
+		return i
+	case v.DoubleValue != nil:
+		return *v.DoubleValue
+	case v.ArrayValue != nil:
+		values := make([]interface{}, 0, len(v.ArrayValue.Values))
+		for _, item := range v.ArrayValue.Values {
+			values = append(values, item.value())
+		}
+		return values
+	case v.KvlistValue != nil:
+		values := make(map[string]interface{}, len(v.KvlistValue.Values))
+		for _, kv := range v.KvlistValue.Values {
+			values[kv.Key] = kv.Value.value()
+		}
+		return values
+	case v.BytesValue != nil:
+		return v.BytesValue
+	}
+	return nil
+}
+
+func jsonAttributes(kvs []jsonKeyValue) Attributes {
+	attrs := make(Attributes, 0, len(kvs))
+	for _, kv := range kvs {
+		attrs = append(attrs, KeyValue{Key: kv.Key, Value: kv.Value.value()})
+	}
+	return attrs
+}
+
+func jsonUint64(n json.Number) uint64 {
+	if n == "" {
+		return 0
+	}
+	v, err := strconv.ParseUint(string(n), 10, 64)
+	if err != nil {
+		f, _ := n.Float64()
+		return uint64(f)
+	}
+	return v
+}
@@ -0,0 +1,124 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"strconv"
+)
+
+// OpenTelemetry OTLP logs v1 数据结构
+// 只保留了入库需要的字段，未使用官方生成代码，避免引入额外的依赖
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/logs/v1/logs.proto
+
+type ExportLogsServiceRequest struct {
+	ResourceLogs []ResourceLogs
+}
+
+type ExportLogsServiceResponse struct{}
+
+type ResourceLogs struct {
+	Resource  Resource
+	ScopeLogs []ScopeLogs
+}
+
+type Resource struct {
+	Attributes Attributes
+}
+
+type ScopeLogs struct {
+	Scope      Scope
+	LogRecords []LogRecord
+}
+
+type Scope struct {
+	Name    string
+	Version string
+}
+
+type LogRecord struct {
+	TimeUnixNano         uint64
+	ObservedTimeUnixNano uint64
+	SeverityNumber       int32
+	SeverityText         string
+	// string bool int64 float64 []byte []interface{} map[string]interface{}
+	Body       interface{}
+	Attributes Attributes
+	TraceID    []byte
+	SpanID     []byte
+}
+
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+type Attributes []KeyValue
+
+// Get 取出属性的字符串形式
+func (attrs Attributes) Get(key string) (string, bool) {
+	for _, v := range attrs {
+		if v.Key == key {
+			return ValueString(v.Value), true
+		}
+	}
+	return "", false
+}
+
+func (attrs Attributes) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(attrs))
+	for _, v := range attrs {
+		m[v.Key] = v.Value
+	}
+	return m
+}
+
+func (lr LogRecord) TraceIDHex() string {
+	if isZero(lr.TraceID) {
+		return ""
+	}
+	return hex.EncodeToString(lr.TraceID)
+}
+
+func (lr LogRecord) SpanIDHex() string {
+	if isZero(lr.SpanID) {
+		return ""
+	}
+	return hex.EncodeToString(lr.SpanID)
+}
+
+// TimeMill 优先使用事件时间，缺失时使用采集时间
+func (lr LogRecord) TimeMill() int64 {
+	if lr.TimeUnixNano > 0 {
+		return int64(lr.TimeUnixNano / 1e6)
+	}
+	if lr.ObservedTimeUnixNano > 0 {
+		return int64(lr.ObservedTimeUnixNano / 1e6)
+	}
+	return 0
+}
+
+func ValueString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case []byte:
+		return hex.EncodeToString(val)
+	}
+	return ""
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package otlp
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func stringKeyValue(key, val string) []byte {
+	anyValue := appendMessage(nil, 1, []byte(val))
+	kv := appendMessage(nil, 1, []byte(key))
+	return appendMessage(kv, 2, anyValue)
+}
+
+func TestUnmarshalProto(t *testing.T) {
+	resource := appendMessage(nil, 1, stringKeyValue("service.name", "example"))
+
+	record := protowire.AppendTag(nil, 1, protowire.Fixed64Type)
+	record = protowire.AppendFixed64(record, 1607961003768000000)
+	record = protowire.AppendTag(record, 2, protowire.VarintType)
+	record = protowire.AppendVarint(record, 17)
+	record = appendMessage(record, 3, []byte("ERROR"))
+	record = appendMessage(record, 5, appendMessage(nil, 1, []byte("db timeout")))
+	record = appendMessage(record, 6, stringKeyValue("user.id", "123"))
+	record = appendMessage(record, 9, []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c})
+
+	scope := appendMessage(nil, 1, appendMessage(nil, 1, []byte("qelog")))
+	scope = appendMessage(scope, 2, record)
+
+	rl := appendMessage(nil, 1, resource)
+	rl = appendMessage(rl, 2, scope)
+	data := appendMessage(nil, 1, rl)
+
+	req := &ExportLogsServiceRequest{}
+	if err := UnmarshalProto(data, req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceLogs) != 1 || len(req.ResourceLogs[0].ScopeLogs) != 1 {
+		t.Fatal(req)
+	}
+	if v, _ := req.ResourceLogs[0].Resource.Attributes.Get("service.name"); v != "example" {
+		t.Fatal(v)
+	}
+	sl := req.ResourceLogs[0].ScopeLogs[0]
+	if sl.Scope.Name != "qelog" || len(sl.LogRecords) != 1 {
+		t.Fatal(sl)
+	}
+	lr := sl.LogRecords[0]
+	if lr.TimeMill() != 1607961003768 || lr.SeverityNumber != 17 || lr.SeverityText != "ERROR" {
+		t.Fatal(lr.TimeMill(), lr.SeverityNumber, lr.SeverityText)
+	}
+	if lr.Body != "db timeout" {
+		t.Fatal(lr.Body)
+	}
+	if v, _ := lr.Attributes.Get("user.id"); v != "123" {
+		t.Fatal(v)
+	}
+	if lr.TraceIDHex() != "5b8efff798038103d269b633813fc60c" {
+		t.Fatal(lr.TraceIDHex())
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	str := `{"resourceLogs":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"example"}}]},
+"scopeLogs":[{"scope":{"name":"qelog"},"logRecords":[{"timeUnixNano":"1607961003768000000","severityNumber":13,
+"body":{"kvlistValue":{"values":[{"key":"message","value":{"stringValue":"slow"}},{"key":"cost","value":{"intValue":"35"}}]}},
+"traceId":"5b8efff798038103d269b633813fc60c","spanId":"eee19b7ec3c1b174"}]}]}]}`
+
+	req := &ExportLogsServiceRequest{}
+	if err := UnmarshalJSON([]byte(str), req); err != nil {
+		t.Fatal(err)
+	}
+	lr := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	body, ok := lr.Body.(map[string]interface{})
+	if !ok || body["message"] != "slow" || body["cost"] != int64(35) {
+		t.Fatal(lr.Body)
+	}
+	if lr.TimeMill() != 1607961003768 || lr.SpanIDHex() != "eee19b7ec3c1b174" {
+		t.Fatal(lr.TimeMill(), lr.SpanIDHex())
+	}
+}
+
+func TestUnmarshalJSONArrayBody(t *testing.T) {
+	str := `{"resourceLogs":[{"scopeLogs":[{"logRecords":[{"severityNumber":17,
+"body":{"arrayValue":{"values":[{"stringValue":"db timeout"},{"intValue":"3"}]}}}]}]}]}`
+
+	req := &ExportLogsServiceRequest{}
+	if err := UnmarshalJSON([]byte(str), req); err != nil {
+		t.Fatal(err)
+	}
+	lr := req.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	body, ok := lr.Body.([]interface{})
+	if !ok || len(body) != 2 || body[0] != "db timeout" || body[1] != int64(3) {
+		t.Fatal(lr.Body)
+	}
+}
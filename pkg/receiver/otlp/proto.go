@@ -0,0 +1,259 @@
+package otlp
+
+import (
+	"errors"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var ErrInvalidProto = errors.New("otlp invalid protobuf")
+
+// UnmarshalProto 按 OTLP protobuf 字段编号逐层解析，未知字段直接跳过
+func UnmarshalProto(b []byte, req *ExportLogsServiceRequest) error {
+	return consumeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num == 1 && typ == protowire.BytesType {
+			rl := ResourceLogs{}
+			if err := unmarshalResourceLogs(v, &rl); err != nil {
+				return err
+			}
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+		}
+		return nil
+	})
+}
+
+func unmarshalResourceLogs(b []byte, rl *ResourceLogs) error {
+	return consumeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			return consumeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num == 1 && typ == protowire.BytesType {
+					kv, err := unmarshalKeyValue(v)
+					if err != nil {
+						return err
+					}
+					rl.Resource.Attributes = append(rl.Resource.Attributes, kv)
+				}
+				return nil
+			})
+		// 1000 为已废弃的 instrumentation_library_logs，结构一致
+		case 2, 1000:
+			sl := ScopeLogs{}
+			if err := unmarshalScopeLogs(v, &sl); err != nil {
+				return err
+			}
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		}
+		return nil
+	})
+}
+
+func unmarshalScopeLogs(b []byte, sl *ScopeLogs) error {
+	return consumeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			return consumeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ != protowire.BytesType {
+					return nil
+				}
+				switch num {
+				case 1:
+					sl.Scope.Name = string(v)
+				case 2:
+					sl.Scope.Version = string(v)
+				}
+				return nil
+			})
+		case 2:
+			lr := LogRecord{}
+			if err := unmarshalLogRecord(v, &lr); err != nil {
+				return err
+			}
+			sl.LogRecords = append(sl.LogRecords, lr)
+		}
+		return nil
+	})
+}
+
+func unmarshalLogRecord(b []byte, lr *LogRecord) error {
+	return consumeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		var err error
+		switch num {
+		case 1:
+			lr.TimeUnixNano, err = fixed64(typ, v)
+		case 11:
+			lr.ObservedTimeUnixNano, err = fixed64(typ, v)
+		case 2:
+			var n uint64
+			n, err = varint(typ, v)
+			lr.SeverityNumber = int32(n)
+		case 3:
+			lr.SeverityText = string(v)
+		case 5:
+			lr.Body, err = unmarshalAnyValue(v)
+		case 6:
+			var kv KeyValue
+			kv, err = unmarshalKeyValue(v)
+			lr.Attributes = append(lr.Attributes, kv)
+		case 9:
+			lr.TraceID = append([]byte(nil), v...)
+		case 10:
+			lr.SpanID = append([]byte(nil), v...)
+		}
+		return err
+	})
+}
+
+func unmarshalKeyValue(b []byte) (KeyValue, error) {
+	kv := KeyValue{}
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		var err error
+		switch num {
+		case 1:
+			kv.Key = string(v)
+		case 2:
+			kv.Value, err = unmarshalAnyValue(v)
+		}
+		return err
+	})
+	return kv, err
+}
+
+func unmarshalAnyValue(b []byte) (interface{}, error) {
+	var val interface{}
+	err := consumeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		switch num {
+		case 1:
+			val = string(v)
+		case 2:
+			n, err := varint(typ, v)
+			if err != nil {
+				return err
+			}
+			val = protowire.DecodeBool(n)
+		case 3:
+			n, err := varint(typ, v)
+			if err != nil {
+				return err
+			}
+			val = int64(n)
+		case 4:
+			n, err := fixed64(typ, v)
+			if err != nil {
+				return err
+			}
+			val = math.Float64frombits(n)
+		case 5:
+			values := make([]interface{}, 0)
+			err := consumeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num == 1 {
+					item, err := unmarshalAnyValue(v)
+					if err != nil {
+						return err
+					}
+					values = append(values, item)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			val = values
+		case 6:
+			values := make(map[string]interface{})
+			err := consumeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if num == 1 {
+					kv, err := unmarshalKeyValue(v)
+					if err != nil {
+						return err
+					}
+					values[kv.Key] = kv.Value
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			val = values
+		case 7:
+			val = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return val, err
+}
+
+// consumeMessage 遍历消息的所有字段
+// 对于 varint 与 fixed 类型，回调中的 v 为原始编码，需要再次解析
+func consumeMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ErrInvalidProto
+		}
+		b = b[n:]
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			val, m := protowire.ConsumeBytes(b)
+			if m < 0 {
+				return ErrInvalidProto
+			}
+			v, n = val, m
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return ErrInvalidProto
+			}
+			v = b[:n]
+		}
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func varint(typ protowire.Type, b []byte) (uint64, error) {
+	if typ != protowire.VarintType {
+		return 0, ErrInvalidProto
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, ErrInvalidProto
+	}
+	return v, nil
+}
+
+func fixed64(typ protowire.Type, b []byte) (uint64, error) {
+	if typ != protowire.Fixed64Type {
+		return 0, ErrInvalidProto
+	}
+	v, n := protowire.ConsumeFixed64(b)
+	if n < 0 {
+		return 0, ErrInvalidProto
+	}
+	return v, nil
+}
+
+// MarshalStatus google.rpc.Status，用于 OTLP/HTTP protobuf 的错误响应
+func MarshalStatus(code int32, message string) []byte {
+	b := make([]byte, 0, len(message)+8)
+	if code != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(code))
+	}
+	if message != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, message)
+	}
+	return b
+}
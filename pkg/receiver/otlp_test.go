@@ -0,0 +1,28 @@
+package receiver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOTLPBody(t *testing.T) {
+	kv := map[string]interface{}{"msg": "slow", "cost": int64(35)}
+	arr := []interface{}{"db timeout", int64(3)}
+	tests := []struct {
+		body       interface{}
+		message    string
+		structured interface{}
+	}{
+		{"db timeout", "db timeout", nil},
+		{int64(3), "3", nil},
+		{kv, "slow", kv},
+		// 数组整体作为消息，同时保留在详情中
+		{arr, `["db timeout",3]`, arr},
+	}
+	for i, tt := range tests {
+		message, structured := otlpBody(tt.body)
+		if message != tt.message || !reflect.DeepEqual(structured, tt.structured) {
+			t.Errorf("%d: %s %v", i, message, structured)
+		}
+	}
+}
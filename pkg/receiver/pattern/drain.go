@@ -0,0 +1,189 @@
+package pattern
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// Drain 固定深度的解析树提取日志模板
+// 第一层按分词数量分组，之后按前 depth-2 个分词分支，叶子中按相似度匹配模板
+// 匹配后不同的分词替换为通配符，模板只会变得更宽泛，ID 在创建时确定不再变化
+
+const (
+	Wildcard = "<*>"
+	// 超出的分词合并到最后一个
+	maxTokens = 64
+	// 每个节点最多的分支，超出后使用通配符分支
+	maxChildren = 100
+)
+
+type Cluster struct {
+	ID     string
+	Tokens []string
+}
+
+func (c *Cluster) Template() string {
+	return strings.Join(c.Tokens, " ")
+}
+
+type node struct {
+	children map[string]*node
+	clusters []*Cluster
+}
+
+func newNode() *node {
+	return &node{children: make(map[string]*node)}
+}
+
+type Drain struct {
+	module string
+	depth  int
+	sim    float64
+	max    int
+	root   map[int]*node
+	ids    map[string]*Cluster
+}
+
+// NewDrain depth 至少为 3，max 为最多的模板数，超出后不再新增
+func NewDrain(module string, depth int, sim float64, max int) *Drain {
+	if depth < 3 {
+		depth = 3
+	}
+	return &Drain{
+		module: module,
+		depth:  depth,
+		sim:    sim,
+		max:    max,
+		root:   make(map[int]*node),
+		ids:    make(map[string]*Cluster),
+	}
+}
+
+func (d *Drain) Len() int {
+	return len(d.ids)
+}
+
+// Tokens 按空白分词，包含数字的分词替换为通配符
+func Tokens(short string) []string {
+	fields := strings.Fields(short)
+	if len(fields) > maxTokens {
+		fields[maxTokens-1] = strings.Join(fields[maxTokens-1:], " ")
+		fields = fields[:maxTokens]
+	}
+	for i, v := range fields {
+		if hasDigit(v) {
+			fields[i] = Wildcard
+		}
+	}
+	return fields
+}
+
+func hasDigit(s string) bool {
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClusterID 由模块与创建时的模板生成，多个实例遇到相同的日志生成相同的 ID
+func ClusterID(module string, tokens []string) string {
+	sum := sha1.Sum([]byte(module + "\x00" + strings.Join(tokens, " ")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Add 返回匹配或新建的模板，超出模板数量时返回 nil
+func (d *Drain) Add(short string) *Cluster {
+	tokens := Tokens(short)
+	if len(tokens) == 0 {
+		return nil
+	}
+	leaf := d.leaf(tokens)
+	if c := d.match(leaf, tokens); c != nil {
+		for i, v := range tokens {
+			if c.Tokens[i] != v {
+				c.Tokens[i] = Wildcard
+			}
+		}
+		return c
+	}
+	if d.max > 0 && len(d.ids) >= d.max {
+		return nil
+	}
+	c := &Cluster{ID: ClusterID(d.module, tokens), Tokens: tokens}
+	if exist, ok := d.ids[c.ID]; ok {
+		return exist
+	}
+	d.ids[c.ID] = c
+	leaf.clusters = append(leaf.clusters, c)
+	return c
+}
+
+// Load 加载已存储的模板，ID 已存在时忽略
+func (d *Drain) Load(id, template string) {
+	if _, ok := d.ids[id]; ok {
+		return
+	}
+	tokens := strings.Split(template, " ")
+	if template == "" || len(tokens) > maxTokens {
+		return
+	}
+	c := &Cluster{ID: id, Tokens: tokens}
+	leaf := d.leaf(tokens)
+	d.ids[id] = c
+	leaf.clusters = append(leaf.clusters, c)
+}
+
+func (d *Drain) leaf(tokens []string) *node {
+	n, ok := d.root[len(tokens)]
+	if !ok {
+		n = newNode()
+		d.root[len(tokens)] = n
+	}
+	for i := 0; i < d.depth-2 && i < len(tokens); i++ {
+		key := tokens[i]
+		child, ok := n.children[key]
+		if !ok {
+			if len(n.children) >= maxChildren {
+				key = Wildcard
+				child = n.children[key]
+			}
+			if child == nil {
+				child = newNode()
+				n.children[key] = child
+			}
+		}
+		n = child
+	}
+	return n
+}
+
+// match 相同位置相同分词的比例最高且不低于阈值的模板，通配符不计入相同
+func (d *Drain) match(leaf *node, tokens []string) *Cluster {
+	var (
+		best    *Cluster
+		bestSim = -1.0
+		bestWc  = -1
+	)
+	for _, c := range leaf.clusters {
+		same, wc := 0, 0
+		for i, v := range c.Tokens {
+			if v == Wildcard {
+				wc++
+			} else if v == tokens[i] {
+				same++
+			}
+		}
+		sim := float64(same) / float64(len(tokens))
+		if sim > bestSim || (sim == bestSim && wc > bestWc) {
+			best, bestSim, bestWc = c, sim, wc
+		}
+	}
+	if best == nil || bestSim < d.sim {
+		return nil
+	}
+	return best
+}
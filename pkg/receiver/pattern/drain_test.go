@@ -0,0 +1,48 @@
+package pattern
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	got := Tokens("user 1024 login from 10.0.0.1 ok")
+	want := []string{"user", Wildcard, "login", "from", Wildcard, "ok"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	d := NewDrain("order", 4, 0.5, 0)
+	a := d.Add("connect db timeout after 3s")
+	b := d.Add("connect db timeout after 10s")
+	if a != b || a.Template() != "connect db timeout after <*>" {
+		t.Fatal(a.Template(), b.Template())
+	}
+	// 不同的分词替换为通配符，ID 不变
+	c := d.Add("connect db refused after 5s")
+	if c != a || c.Template() != "connect db <*> after <*>" {
+		t.Fatal(c.Template())
+	}
+	if d.Add("create order failed") == a || d.Len() != 2 {
+		t.Fatal(d.Len())
+	}
+	// 相同的日志在不同实例生成相同的 ID
+	other := NewDrain("order", 4, 0.5, 0)
+	if id := other.Add("create order failed").ID; id != d.Add("create order failed").ID {
+		t.Fatal(id)
+	}
+}
+
+func TestDrainLoadAndMax(t *testing.T) {
+	d := NewDrain("order", 4, 0.5, 1)
+	d.Load("abc", "pay <*> failed code <*>")
+	if c := d.Add("pay 12 failed code 500"); c == nil || c.ID != "abc" {
+		t.Fatal(c)
+	}
+	// 加载的模板不受数量限制，新增的模板受限制
+	if d.Add("completely different message") != nil {
+		t.Fatal("expected nil over max")
+	}
+}
@@ -0,0 +1,263 @@
+package pattern
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// 按模块提取短消息模板，写入时为日志设置模板 ID
+// 模板的数量与每小时统计在本地累加，周期性的同步到主库
+// 同步时加载其他实例新建的模板，多个实例对相同的日志尽量使用相同的模板
+var syncInterval = 10 * time.Second
+
+type Miner struct {
+	mutex   sync.Mutex
+	store   *storage.Store
+	cfg     config.Pattern
+	modules map[string]*module
+}
+
+type module struct {
+	drain *Drain
+	// 未同步的统计
+	stats map[string]*stat
+	// 最近一次加载模板的时间
+	loaded time.Time
+}
+
+type stat struct {
+	count   int64
+	first   time.Time
+	last    time.Time
+	samples []string
+	hours   map[int64]int64
+}
+
+func New(store *storage.Store, cfg config.Pattern) *Miner {
+	return &Miner{
+		store:   store,
+		cfg:     cfg,
+		modules: make(map[string]*module),
+	}
+}
+
+// SetModules 模块配置同步后更新，新开启的模块加载已存储的模板
+func (m *Miner) SetModules(modules []*model.Module) {
+	m.mutex.Lock()
+	exists := make(map[string]struct{}, len(modules))
+	added := make([]string, 0)
+	for _, v := range modules {
+		if !v.PatternMining {
+			continue
+		}
+		exists[v.Name] = struct{}{}
+		if _, ok := m.modules[v.Name]; !ok {
+			m.modules[v.Name] = &module{
+				drain: NewDrain(v.Name, m.cfg.Depth, m.cfg.SimThreshold, m.cfg.MaxPatterns),
+				stats: make(map[string]*stat),
+			}
+			added = append(added, v.Name)
+		}
+	}
+	for name := range m.modules {
+		if _, ok := exists[name]; !ok {
+			delete(m.modules, name)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, name := range added {
+		if err := m.load(name); err != nil {
+			logs.Qezap.Error("PatternLoad", zap.String("module", name), zap.Error(err))
+		}
+	}
+}
+
+// Match 设置日志的模板 ID，模块没有开启或模板数量超出时不设置
+func (m *Miner) Match(moduleName string, docs []*model.Logging) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	mod, ok := m.modules[moduleName]
+	if !ok {
+		return
+	}
+	for _, v := range docs {
+		c := mod.drain.Add(v.Short)
+		if c == nil {
+			continue
+		}
+		v.PatternID = c.ID
+		// 提前生成 ID 作为样例
+		if v.ID.IsZero() {
+			v.ID = primitive.NewObjectID()
+		}
+		s, ok := mod.stats[c.ID]
+		if !ok {
+			s = &stat{hours: make(map[int64]int64)}
+			mod.stats[c.ID] = s
+		}
+		ts := time.Unix(v.TimeSec, 0)
+		if s.count == 0 || ts.Before(s.first) {
+			s.first = ts
+		}
+		if ts.After(s.last) {
+			s.last = ts
+		}
+		s.count++
+		s.hours[v.TimeSec-v.TimeSec%3600]++
+		s.samples = append(s.samples, v.ID.Hex())
+		if n := m.cfg.MaxSamples; len(s.samples) > n {
+			s.samples = s.samples[len(s.samples)-n:]
+		}
+	}
+}
+
+func (m *Miner) BackgroundSync() {
+	tick := time.NewTicker(syncInterval)
+	for range tick.C {
+		m.Sync()
+	}
+}
+
+// Sync 同步所有模块的统计，并加载其他实例新建的模板
+func (m *Miner) Sync() {
+	m.mutex.Lock()
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
+	}
+	m.mutex.Unlock()
+
+	for _, name := range names {
+		if err := m.flush(name); err != nil {
+			logs.Qezap.Error("PatternSync", zap.String("module", name), zap.Error(err))
+		}
+		if err := m.load(name); err != nil {
+			logs.Qezap.Error("PatternLoad", zap.String("module", name), zap.Error(err))
+		}
+	}
+}
+
+func (m *Miner) flush(name string) error {
+	m.mutex.Lock()
+	mod, ok := m.modules[name]
+	if !ok || len(mod.stats) == 0 {
+		m.mutex.Unlock()
+		return nil
+	}
+	stats := mod.stats
+	mod.stats = make(map[string]*stat)
+	templates := make(map[string]string, len(stats))
+	for id := range stats {
+		if c, ok := mod.drain.ids[id]; ok {
+			templates[id] = c.Template()
+		}
+	}
+	m.mutex.Unlock()
+
+	now := time.Now()
+	filters := make([]bson.M, 0, len(stats))
+	updates := make([]bson.M, 0, len(stats))
+	hourFilters := make([]bson.M, 0, len(stats))
+	hourUpdates := make([]bson.M, 0, len(stats))
+	for id, s := range stats {
+		filters = append(filters, bson.M{"module_name": name, "pattern_id": id})
+		updates = append(updates, bson.M{
+			"$set": bson.M{"template": templates[id], "updated_at": now},
+			"$inc": bson.M{"count": s.count},
+			"$min": bson.M{"first_seen": s.first},
+			"$max": bson.M{"last_seen": s.last},
+			"$push": bson.M{"sample_ids": bson.M{
+				"$each":  s.samples,
+				"$slice": -m.cfg.MaxSamples,
+			}},
+		})
+		for hour, count := range s.hours {
+			hourFilters = append(hourFilters, bson.M{"module_name": name, "pattern_id": id, "hour": time.Unix(hour, 0)})
+			hourUpdates = append(hourUpdates, bson.M{"$inc": bson.M{"count": count}})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := m.store.BulkUpsert(ctx, model.CollectionNameLoggingPattern, filters, updates)
+	if err == nil {
+		err = m.store.BulkUpsert(ctx, model.CollectionNameLoggingPatternStats, hourFilters, hourUpdates)
+	}
+	if err != nil {
+		// 同步失败，统计留到下一次，可能重复累加已写入的部分
+		m.mutex.Lock()
+		if mod, ok := m.modules[name]; ok {
+			for id, s := range stats {
+				mod.merge(id, s)
+			}
+		}
+		m.mutex.Unlock()
+	}
+	return err
+}
+
+func (mod *module) merge(id string, s *stat) {
+	exist, ok := mod.stats[id]
+	if !ok {
+		mod.stats[id] = s
+		return
+	}
+	exist.count += s.count
+	if s.first.Before(exist.first) {
+		exist.first = s.first
+	}
+	if s.last.After(exist.last) {
+		exist.last = s.last
+	}
+	for hour, count := range s.hours {
+		exist.hours[hour] += count
+	}
+	exist.samples = append(s.samples, exist.samples...)
+}
+
+// load 加载上次加载之后更新的模板，首次加载所有模板
+func (m *Miner) load(name string) error {
+	m.mutex.Lock()
+	mod, ok := m.modules[name]
+	if !ok {
+		m.mutex.Unlock()
+		return nil
+	}
+	since := mod.loaded
+	m.mutex.Unlock()
+
+	now := time.Now()
+	filter := bson.M{"module_name": name}
+	if !since.IsZero() {
+		// 与其他实例的同步时间重叠，避免遗漏
+		filter["updated_at"] = bson.M{"$gte": since.Add(-syncInterval)}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	docs, err := m.store.FindLoggingPattern(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if mod, ok = m.modules[name]; !ok {
+		return nil
+	}
+	for _, v := range docs {
+		mod.drain.Load(v.PatternID, v.Template)
+	}
+	mod.loaded = now
+	return nil
+}
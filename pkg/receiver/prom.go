@@ -0,0 +1,65 @@
+package receiver
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/infra/prom"
+	"github.com/huzhongqing/qelog/pkg/receiver/worker"
+)
+
+// receiver 自身的运行指标，/metrics 暴露
+var (
+	promPackets = prom.NewCounterVec("qelog_receiver_packets_total",
+		"Packets received by service and result code.", "service", "code")
+	promIngestLines = prom.NewCounterVec("qelog_receiver_ingest_lines_total",
+		"Log lines accepted for writing by module.", "module")
+	promIngestBytes = prom.NewCounterVec("qelog_receiver_ingest_bytes_total",
+		"Log bytes accepted for writing by module.", "module")
+	promDroppedLines = prom.NewCounterVec("qelog_receiver_dropped_lines_total",
+		"Log lines dropped before writing by module and reason.", "module", "reason")
+	promDecodeFailures = prom.NewCounterVec("qelog_receiver_decode_failures_total",
+		"Log lines not matching qezap or the module decoder.", "module")
+	promInsertDuration = prom.NewHistogramVec("qelog_receiver_insert_duration_seconds",
+		"Mongo insert latency by sharding index and result.", nil, "shard", "result")
+
+	_ = prom.NewGaugeFunc("qelog_receiver_queue_depth",
+		"Pending tasks in alarm and metrics queues.", []string{"queue"}, func(emit func(float64, ...string)) {
+			for _, v := range worker.AllStats() {
+				emit(float64(v.Depth), v.Name)
+			}
+		})
+	_ = prom.NewCounterFunc("qelog_receiver_queue_dropped_total",
+		"Tasks dropped because the queue was full.", []string{"queue"}, func(emit func(float64, ...string)) {
+			for _, v := range worker.AllStats() {
+				emit(float64(v.Dropped), v.Name)
+			}
+		})
+)
+
+const (
+	dropReasonPipeline = "pipeline"
+	dropReasonQuota    = "quota"
+	dropReasonPending  = "pending"
+)
+
+// observePacket 按错误码统计数据包，成功为 0
+func observePacket(service string, err error) {
+	code := 0
+	if err != nil {
+		code = httputil.ErrCodeSystemException
+		if e, ok := err.(httputil.Error); ok {
+			code = e.Code
+		}
+	}
+	promPackets.WithLabelValues(service, strconv.Itoa(code)).Inc()
+}
+
+func observeInsert(index int, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	promInsertDuration.WithLabelValues(strconv.Itoa(index), result).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,232 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// 模块写入配额，多个 receiver 实例共享
+// 每个实例在本地用令牌桶限速，周期性的将写入量同步到主库，并读取其他实例的写入量
+// 每秒条数：其他实例最近的速率从总配额中扣除，剩余的作为本实例的速率，至少保留平均值
+// 每天字节：所有实例当天写入量之和，加上本实例未同步的写入量
+var (
+	reconcileInterval = 10 * time.Second
+	// 超过此时间没有同步的实例，认为已经下线
+	instanceTimeout = 3 * reconcileInterval
+)
+
+type Quota struct {
+	mutex    sync.Mutex
+	store    *storage.Store
+	instance string
+	states   map[string]*state
+}
+
+type state struct {
+	quota  model.ModuleQuota
+	bucket *tokenBucket
+	date   time.Time
+	// 最近一次同步时所有实例当天的字节数
+	daySize int64
+	// 未同步的写入量
+	number int64
+	size   int64
+	last   time.Time
+}
+
+func New(store *storage.Store) *Quota {
+	host, _ := os.Hostname()
+	return &Quota{
+		store:    store,
+		instance: fmt.Sprintf("%s_%d_%s", host, os.Getpid(), primitive.NewObjectID().Hex()[18:]),
+		states:   make(map[string]*state),
+	}
+}
+
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// SetModules 模块配置同步后更新配额，没有限制的模块不做统计
+func (q *Quota) SetModules(modules []*model.Module) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	exists := make(map[string]struct{}, len(modules))
+	for _, m := range modules {
+		if !m.Quota.Limited() {
+			continue
+		}
+		exists[m.Name] = struct{}{}
+		s, ok := q.states[m.Name]
+		if !ok {
+			s = &state{date: today(), last: time.Now()}
+			q.states[m.Name] = s
+		}
+		if s.bucket == nil || s.quota.LinesPerSec != m.Quota.LinesPerSec {
+			s.bucket = newTokenBucket(float64(m.Quota.LinesPerSec))
+		}
+		s.quota = m.Quota
+	}
+	for name := range q.states {
+		if _, ok := exists[name]; !ok {
+			delete(q.states, name)
+		}
+	}
+}
+
+// Allow 超出配额返回 false，不计入写入量
+func (q *Quota) Allow(moduleName string, number, size int) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	s, ok := q.states[moduleName]
+	if !ok {
+		return true
+	}
+	if d := today(); !d.Equal(s.date) {
+		s.date = d
+		s.daySize = 0
+		s.size = 0
+	}
+	if s.quota.BytesPerDay > 0 && s.daySize+s.size+int64(size) > s.quota.BytesPerDay {
+		return false
+	}
+	if s.quota.LinesPerSec > 0 && !s.bucket.take(float64(number)) {
+		return false
+	}
+	s.number += int64(number)
+	s.size += int64(size)
+	return true
+}
+
+func (q *Quota) BackgroundReconcile() {
+	tick := time.NewTicker(reconcileInterval)
+	for range tick.C {
+		q.Sync()
+	}
+}
+
+// Sync 同步本实例的写入量，并根据其他实例的写入情况调整本实例的配额
+func (q *Quota) Sync() {
+	q.mutex.Lock()
+	names := make([]string, 0, len(q.states))
+	for name := range q.states {
+		names = append(names, name)
+	}
+	q.mutex.Unlock()
+
+	for _, name := range names {
+		if err := q.reconcile(name); err != nil {
+			logs.Qezap.Error("QuotaReconcile", zap.String("module", name), zap.Error(err))
+		}
+	}
+}
+
+func (q *Quota) reconcile(name string) error {
+	q.mutex.Lock()
+	s, ok := q.states[name]
+	if !ok {
+		q.mutex.Unlock()
+		return nil
+	}
+	now := time.Now()
+	date, number, size := s.date, s.number, s.size
+	rate := float64(number) / now.Sub(s.last).Seconds()
+	s.number, s.size, s.last = 0, 0, now
+	q.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{"module_name": name, "instance": q.instance, "created_date": date}
+	update := bson.M{
+		"$inc": bson.M{"number": number, "size": size},
+		"$set": bson.M{"rate": rate, "updated_at": now},
+	}
+	if err := q.store.UpsertQuotaUsage(ctx, filter, update); err != nil {
+		// 同步失败，写入量留到下一次
+		q.mutex.Lock()
+		s.number += number
+		s.size += size
+		q.mutex.Unlock()
+		return err
+	}
+	docs, err := q.store.FindQuotaUsage(ctx, bson.M{"module_name": name, "created_date": date})
+	if err != nil {
+		return err
+	}
+
+	var daySize int64
+	var othersRate float64
+	active := 1
+	for _, v := range docs {
+		daySize += v.Size
+		if v.Instance == q.instance || now.Sub(v.UpdatedAt) > instanceTimeout {
+			continue
+		}
+		active++
+		othersRate += v.Rate
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if !s.date.Equal(date) {
+		return nil
+	}
+	s.daySize = daySize
+	if limit := float64(s.quota.LinesPerSec); limit > 0 {
+		local := limit - othersRate
+		if avg := limit / float64(active); local < avg {
+			local = avg
+		}
+		s.bucket.setRate(local)
+	}
+	return nil
+}
+
+// tokenBucket 容量为一秒的速率，单次请求超过容量时，桶满即可通过并预支
+type tokenBucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+}
+
+func (b *tokenBucket) take(n float64) bool {
+	b.refill()
+	if b.tokens >= n || (n > b.rate && b.tokens >= b.rate) {
+		b.tokens -= n
+		return true
+	}
+	return false
+}
+
+func (b *tokenBucket) setRate(rate float64) {
+	b.refill()
+	b.rate = rate
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+}
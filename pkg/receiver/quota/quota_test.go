@@ -0,0 +1,48 @@
+package quota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(10)
+	if !b.take(6) || b.take(6) {
+		t.Fatal("expected second take throttled")
+	}
+	// 超过容量的请求，桶满时预支
+	b = newTokenBucket(10)
+	if !b.take(25) || b.take(1) {
+		t.Fatal("expected debt")
+	}
+	b.last = b.last.Add(-2 * time.Second)
+	b.setRate(5)
+	if b.tokens > 5 {
+		t.Fatal(b.tokens)
+	}
+}
+
+func TestQuota_Allow(t *testing.T) {
+	q := New(nil)
+	q.SetModules([]*model.Module{
+		{Name: "a", Quota: model.ModuleQuota{BytesPerDay: 100}},
+		{Name: "b", Quota: model.ModuleQuota{LinesPerSec: 10}},
+		{Name: "c"},
+	})
+	if !q.Allow("a", 1, 60) || q.Allow("a", 1, 60) || !q.Allow("a", 1, 40) {
+		t.Fatal("bytes per day")
+	}
+	if !q.Allow("b", 10, 1) || q.Allow("b", 1, 1) {
+		t.Fatal("lines per sec")
+	}
+	if !q.Allow("c", 1e6, 1e9) {
+		t.Fatal("unlimited")
+	}
+
+	q.SetModules([]*model.Module{{Name: "a"}})
+	if len(q.states) != 0 {
+		t.Fatal(q.states)
+	}
+}
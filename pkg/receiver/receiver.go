@@ -3,6 +3,7 @@ package receiver
 import (
 	"bytes"
 	"context"
+	"regexp"
 	"strconv"
 	"sync"
 	"time"
@@ -15,26 +16,54 @@ import (
 	"github.com/huzhongqing/qelog/infra/logs"
 	"github.com/huzhongqing/qelog/pkg/common/model"
 	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/decoder"
+	"github.com/huzhongqing/qelog/pkg/fieldquery"
+	"github.com/huzhongqing/qelog/pkg/fulltext"
+	"github.com/huzhongqing/qelog/pkg/pipeline"
 	"github.com/huzhongqing/qelog/pkg/receiver/alarm"
 	"github.com/huzhongqing/qelog/pkg/receiver/metrics"
+	"github.com/huzhongqing/qelog/pkg/receiver/pattern"
+	"github.com/huzhongqing/qelog/pkg/receiver/quota"
+	"github.com/huzhongqing/qelog/pkg/receiver/worker"
 	"github.com/huzhongqing/qelog/pkg/storage"
 	"github.com/huzhongqing/qelog/pkg/types"
 	"go.uber.org/zap"
 )
 
+// Service 进程内所有接入服务共用，配置监听、配额、报警与统计只有一份
 type Service struct {
 	store    *storage.Store
 	sharding *storage.Sharding
 
 	mutex       sync.RWMutex
 	modules     map[string]*model.Module
+	decoders    map[string]*decoder.Decoder
 	collections map[string]struct{}
 	lcn         types.LoggingCollectionName
 
-	alarm   *alarm.Alarm
-	metrics *metrics.Metrics
+	alarm    *alarm.Alarm
+	metrics  *metrics.Metrics
+	quota    *quota.Quota
+	pipeline *pipeline.Pipeline
+	patterns *pattern.Miner
+
+	alarmQueue   *worker.Queue
+	metricsQueue *worker.Queue
+
+	// 自动注册模块名规则与待审批模块的缓存
+	namePatterns []*regexp.Regexp
+	pending      *pendingBuffer
+
+	// 配置变更通知，缓冲为 1，连续的变更合并成一次更新
+	moduleChanged    chan struct{}
+	alarmChanged     chan struct{}
+	processorChanged chan struct{}
+	cancelWatch      context.CancelFunc
 }
 
+// 监听出错后重新监听的间隔，期间依靠定时同步
+var watchRetryInterval = time.Minute
+
 func NewService(sharding *storage.Sharding) *Service {
 	mainDB, err := sharding.MainStore()
 	if err != nil {
@@ -44,27 +73,62 @@ func NewService(sharding *storage.Sharding) *Service {
 		store:       mainDB,
 		sharding:    sharding,
 		modules:     make(map[string]*model.Module, 0),
+		decoders:    make(map[string]*decoder.Decoder, 0),
 		collections: make(map[string]struct{}, 0),
 		lcn:         types.NewLoggingCollectionName(config.Global.DaySpan),
+		quota:       quota.New(mainDB),
+		pipeline:    pipeline.NewPipeline(),
+		patterns:    pattern.New(mainDB, config.Global.Pattern),
+
+		namePatterns: compileNamePatterns(config.Global.AutoRegister.NamePatterns),
+		pending:      newPendingBuffer(),
+
+		moduleChanged:    make(chan struct{}, 1),
+		alarmChanged:     make(chan struct{}, 1),
+		processorChanged: make(chan struct{}, 1),
 	}
 
+	// 配置监听与同步在 Close 时停止
+	ctx, cancel := context.WithCancel(context.Background())
+	srv.cancelWatch = cancel
+
 	if err := srv.updateModuleSetting(); err != nil {
 		panic(err)
 	}
 
-	go srv.backgroundSyncModuleSetting()
+	go syncSetting(ctx, "syncModuleSetting", 30*time.Second, srv.moduleChanged, srv.updateModuleSetting)
+	go srv.quota.BackgroundReconcile()
+	go srv.patterns.BackgroundSync()
 
+	if err := srv.updateProcessorSetting(); err != nil {
+		logs.Qezap.Error("updateProcessorSetting", zap.Error(err))
+	}
+	go syncSetting(ctx, "syncProcessorSetting", time.Minute, srv.processorChanged, srv.updateProcessorSetting)
+
+	go srv.watchSetting(ctx)
+
+	wc := config.Global.Worker
 	if config.Global.AlarmEnable {
-		srv.alarm = alarm.NewAlarm()
+		srv.alarm = alarm.NewAlarm("alarm_dispatch", wc.DispatchQueueSize, wc.DispatchWorkers, wc.DispatchRetry)
+		window := alarm.NewWindow(mainDB, config.Global.AlarmWindow)
+		srv.alarm.SetWindow(window)
+		go window.BackgroundEvaluate()
+		srv.alarmQueue = worker.NewQueue("alarm_match", wc.AlarmQueueSize, wc.AlarmWorkers, func(v interface{}) {
+			srv.alarm.AlarmIfHitRule(v.([]*model.Logging))
+		})
 		if err := srv.updateAlarmRuleSetting(); err != nil {
 			panic(err)
 		}
-		go srv.backgroundSyncAlarmRuleSetting()
+		go syncSetting(ctx, "syncAlarmRuleSetting", time.Minute, srv.alarmChanged, srv.updateAlarmRuleSetting)
 	}
 
 	if config.Global.MetricsEnable {
 		srv.metrics = metrics.NewMetrics(srv.store)
 		metrics.SetIncIntervalSec(30)
+		srv.metricsQueue = worker.NewQueue("metrics", wc.MetricsQueueSize, wc.MetricsWorkers, func(v interface{}) {
+			job := v.(*statisticsJob)
+			srv.metrics.Statistics(job.module, job.ip, job.docs)
+		})
 	}
 
 	return srv
@@ -74,49 +138,87 @@ func (srv *Service) InsertJSONPacket(ctx context.Context, ip string, in *api.JSO
 	if len(in.Data) <= 0 {
 		return nil
 	}
-	// 判断 module 是否有效，如果无效，则不接受写入
-	srv.mutex.RLock()
-	module, ok := srv.modules[in.Module]
-	srv.mutex.RUnlock()
-	if !ok {
-		return httputil.NewError(httputil.ErrCodeNotFound, in.Module+"module unregistered")
+	module, err := srv.findModule(in.Module, ip)
+	if err != nil {
+		return err
 	}
 
 	docs := srv.decodeJSONPacket(ip, in)
 
-	if config.Global.AlarmEnable && srv.alarm.ModuleIsEnable(in.Module) {
-		// 异步执行报警逻辑
-		go srv.alarm.AlarmIfHitRule(docs)
-	}
-
-	if config.Global.MetricsEnable {
-		go srv.metrics.Statistics(in.Module, ip, docs)
-	}
-
-	return srv.insertLogging(ctx, module.ShardingIndex, docs)
+	return srv.handleLogging(ctx, module, ip, docs)
 }
 
 func (srv *Service) InsertPacket(ctx context.Context, ip string, in *receiverpb.Packet) error {
 	if len(in.Data) <= 0 {
 		return nil
 	}
-	// 判断 module 是否有效，如果无效，则不接受写入
-	srv.mutex.RLock()
-	module, ok := srv.modules[in.Module]
-	srv.mutex.RUnlock()
-	if !ok {
-		return httputil.NewError(httputil.ErrCodeNotFound, "module unregistered")
+	module, err := srv.findModule(in.Module, ip)
+	if err != nil {
+		return err
 	}
 
 	docs := srv.decodePacket(ip, in)
 
-	if config.Global.AlarmEnable && srv.alarm.ModuleIsEnable(in.Module) {
-		// 异步执行报警逻辑
-		go srv.alarm.AlarmIfHitRule(docs)
+	return srv.handleLogging(ctx, module, ip, docs)
+}
+
+// InsertLogging 其他协议接入时，已经解析好的日志，与数据包走相同的报警、统计及写入流程
+func (srv *Service) InsertLogging(ctx context.Context, moduleName, ip string, docs []*model.Logging) error {
+	if len(docs) <= 0 {
+		return nil
+	}
+	module, err := srv.findModule(moduleName, ip)
+	if err != nil {
+		return err
+	}
+
+	return srv.handleLogging(ctx, module, ip, docs)
+}
+
+func (srv *Service) handleLogging(ctx context.Context, module *model.Module, ip string, docs []*model.Logging) error {
+	if module.Pending {
+		return srv.holdPending(module, ip, docs)
+	}
+	number := len(docs)
+	docs = srv.pipeline.Process(module.Name, docs)
+	if dropped := number - len(docs); dropped > 0 {
+		promDroppedLines.WithLabelValues(module.Name, dropReasonPipeline).Add(float64(dropped))
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	size := 0
+	for _, v := range docs {
+		truncateLogging(v, module.Quota.MaxLineSize)
+		if module.FullText {
+			v.Tokens = fulltext.Tokenize(v.Short, v.Full)
+		}
+		if module.StructuredFull {
+			if fields, ok := fieldquery.Structure(v.Full, types.Unmarshal); ok {
+				v.Fields, v.Full = fields, ""
+			}
+		}
+		size += v.Size
+	}
+	// 超出配额，客户端稍后重试
+	if !srv.quota.Allow(module.Name, len(docs), size) {
+		promDroppedLines.WithLabelValues(module.Name, dropReasonQuota).Add(float64(len(docs)))
+		return httputil.ErrThrottled.MergeString(module.Name)
+	}
+	if module.PatternMining {
+		srv.patterns.Match(module.Name, docs)
+	}
+	promIngestLines.WithLabelValues(module.Name).Add(float64(len(docs)))
+	promIngestBytes.WithLabelValues(module.Name).Add(float64(size))
+
+	// 报警与统计放入队列异步执行，队列满时丢弃，不影响写入
+	if config.Global.AlarmEnable && srv.alarm.ModuleIsEnable(module.Name) {
+		srv.alarmQueue.Push(docs)
 	}
 
 	if config.Global.MetricsEnable {
-		go srv.metrics.Statistics(in.Module, ip, docs)
+		srv.metricsQueue.Push(&statisticsJob{module: module.Name, ip: ip, docs: docs})
 	}
 
 	return srv.insertLogging(ctx, module.ShardingIndex, docs)
@@ -148,7 +250,10 @@ func (srv *Service) insertLogging(ctx context.Context, index int, docs []*model.
 			}
 		}
 
-		if err := shardingStore.InsertManyLogging(ctx, v.CollectionName, v.Docs); err != nil {
+		start := time.Now()
+		err = shardingStore.InsertManyLogging(ctx, v.CollectionName, v.Docs)
+		observeInsert(v.Index, start, err)
+		if err != nil {
 			return httputil.ErrSystemException.MergeError(err)
 		}
 		return nil
@@ -169,71 +274,93 @@ func (srv *Service) insertLogging(ctx context.Context, index int, docs []*model.
 
 func (srv *Service) decodePacket(ip string, in *receiverpb.Packet) []*model.Logging {
 	byteItems := bytes.Split(in.Data, []byte{'\n'})
+	dec := srv.moduleDecoder(in.Module)
+	if dec != nil && dec.Multiline() {
+		byteItems = dec.Join(byteItems)
+	}
 	records := make([]*model.Logging, 0, len(byteItems))
 
 	for i, v := range byteItems {
 		if v == nil || bytes.Equal(v, []byte{}) || bytes.Equal(v, []byte{'\n'}) {
 			continue
 		}
-		r := &model.Logging{
-			Module:    in.Module,
-			IP:        ip,
-			Full:      string(v),
-			MessageID: in.Id + "_" + strconv.Itoa(i),
-			TimeSec:   time.Now().Unix(),
-			Size:      len(v),
-		}
-		dec := types.Decoder{}
-		if err := types.Unmarshal(v, &dec); err == nil {
-			r.Short = dec.Short()
-			r.Level = dec.Level()
-			r.Condition1 = dec.Condition(1)
-			r.Condition2 = dec.Condition(2)
-			r.Condition3 = dec.Condition(3)
-			r.TraceID = dec.TraceIDHex()
-			r.TimeMill = dec.TimeMill()
-			r.TimeSec = r.TimeMill / 1e3
-			// full 去掉已经提取出来的字段
-			r.Full = dec.Full()
+		r, ok := decodeLogging(dec, in.Module, ip, v)
+		if !ok {
+			promDecodeFailures.WithLabelValues(in.Module).Inc()
 		}
+		r.MessageID = in.Id + "_" + strconv.Itoa(i)
 		records = append(records, r)
 	}
 	return records
 }
 
 func (srv *Service) decodeJSONPacket(ip string, in *api.JSONPacket) []*model.Logging {
-	records := make([]*model.Logging, 0, len(in.Data))
+	byteItems := make([][]byte, 0, len(in.Data))
+	for _, v := range in.Data {
+		byteItems = append(byteItems, []byte(v))
+	}
+	dec := srv.moduleDecoder(in.Module)
+	if dec != nil && dec.Multiline() {
+		byteItems = dec.Join(byteItems)
+	}
+	records := make([]*model.Logging, 0, len(byteItems))
 
-	for i, v := range in.Data {
-		if v == "" {
+	for i, v := range byteItems {
+		if len(v) == 0 {
 			continue
 		}
-		r := &model.Logging{
-			Module:    in.Module,
-			IP:        ip,
-			Full:      v,
-			MessageID: in.Id + "_" + strconv.Itoa(i),
-			TimeSec:   time.Now().Unix(),
-			Size:      len(v),
-		}
-		dec := types.Decoder{}
-		if err := types.Unmarshal([]byte(v), &dec); err == nil {
-			r.Short = dec.Short()
-			r.Level = dec.Level()
-			r.Condition1 = dec.Condition(1)
-			r.Condition2 = dec.Condition(2)
-			r.Condition3 = dec.Condition(3)
-			r.TraceID = dec.TraceIDHex()
-			r.TimeMill = dec.TimeMill()
-			r.TimeSec = r.TimeMill / 1e3
-			// full 去掉已经提取出来的字段
-			r.Full = dec.Full()
+		r, ok := decodeLogging(dec, in.Module, ip, v)
+		if !ok {
+			promDecodeFailures.WithLabelValues(in.Module).Inc()
 		}
+		r.MessageID = in.Id + "_" + strconv.Itoa(i)
 		records = append(records, r)
 	}
 	return records
 }
 
+func (srv *Service) moduleDecoder(name string) *decoder.Decoder {
+	srv.mutex.RLock()
+	dec := srv.decoders[name]
+	srv.mutex.RUnlock()
+	return dec
+}
+
+// decodeLogging 优先解析 qezap 编码，再使用模块配置的解析方式
+// 都解析失败时原文写入 full，ok 返回 false
+func decodeLogging(lineDec *decoder.Decoder, module, ip string, v []byte) (r *model.Logging, ok bool) {
+	r = &model.Logging{
+		Module:  module,
+		IP:      ip,
+		Full:    string(v),
+		TimeSec: time.Now().Unix(),
+		Size:    len(v),
+	}
+	dec := types.Decoder{}
+	if err := types.Unmarshal(v, &dec); err != nil {
+		if lineDec == nil {
+			return r, false
+		}
+		e, ok := lineDec.Decode(string(v))
+		if !ok {
+			return r, false
+		}
+		entryToLogging(r, e, lineDec.TagKeys())
+		return r, true
+	}
+	r.Short = dec.Short()
+	r.Level = dec.Level()
+	r.Condition1 = dec.Condition(1)
+	r.Condition2 = dec.Condition(2)
+	r.Condition3 = dec.Condition(3)
+	r.TraceID = dec.TraceIDHex()
+	r.TimeMill = dec.TimeMill()
+	r.TimeSec = r.TimeMill / 1e3
+	// full 去掉已经提取出来的字段
+	r.Full = dec.Full()
+	return r, true
+}
+
 // 判断集合是否存在，如果不存在需要创建索引
 // 因为有序号绑定，每一个集合名都是唯一的
 func (srv *Service) collectionExists(store *storage.Store, collectionName string) (bool, error) {
@@ -316,21 +443,38 @@ func (srv *Service) updateModuleSetting() error {
 	if err != nil {
 		return err
 	}
-	srv.mutex.Lock()
+	modules := make(map[string]*model.Module, len(docs))
+	decoders := make(map[string]*decoder.Decoder, len(docs))
 	for _, v := range docs {
-		srv.modules[v.Name] = v
-	}
-	srv.mutex.Unlock()
-	return nil
-}
-func (srv *Service) backgroundSyncModuleSetting() {
-	tick := time.NewTicker(30 * time.Second)
-	for range tick.C {
-		err := srv.updateModuleSetting()
+		modules[v.Name] = v
+		srv.mutex.RLock()
+		old, ok := srv.modules[v.Name]
+		dec := srv.decoders[v.Name]
+		srv.mutex.RUnlock()
+		// 配置没有变化时不需要重新编译
+		if ok && old.UpdatedAt.Equal(v.UpdatedAt) {
+			decoders[v.Name] = dec
+			continue
+		}
+		dec, err := decoder.New(v.Decoder)
 		if err != nil {
-			logs.Qezap.Error("backgroundSyncModuleSetting", zap.Error(err))
+			logs.Qezap.Error("updateModuleSetting", zap.String("module", v.Name), zap.Error(err))
+			continue
 		}
+		decoders[v.Name] = dec
+	}
+	approved := srv.pending.take(modules)
+	// 整体替换，已删除的模块不再接收写入
+	srv.mutex.Lock()
+	srv.modules = modules
+	srv.decoders = decoders
+	srv.mutex.Unlock()
+	srv.quota.SetModules(docs)
+	srv.patterns.SetModules(docs)
+	if len(approved) > 0 {
+		go srv.flushPending(approved)
 	}
+	return nil
 }
 
 func (srv *Service) updateAlarmRuleSetting() error {
@@ -347,17 +491,119 @@ func (srv *Service) updateAlarmRuleSetting() error {
 	return nil
 }
 
-func (srv *Service) backgroundSyncAlarmRuleSetting() {
-	tick := time.NewTicker(time.Minute)
-	for range tick.C {
-		err := srv.updateAlarmRuleSetting()
+// updateProcessorSetting 编译失败的规则跳过，其余规则照常生效
+func (srv *Service) updateProcessorSetting() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	docs, err := srv.store.FindAllEnableProcessor(ctx)
+	if err != nil {
+		return err
+	}
+	return srv.pipeline.InitRules(docs)
+}
+
+// syncSetting 定时同步，收到变更通知时立即同步，监听不可用时只依靠定时同步
+func syncSetting(ctx context.Context, name string, interval time.Duration, changed <-chan struct{}, update func() error) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		case <-changed:
+		}
+		if err := update(); err != nil {
+			logs.Qezap.Error(name, zap.Error(err))
+		}
+	}
+}
+
+// watchSetting 主库配置变更时立即通知更新，定时同步保留作为兜底
+// 单机部署的 Mongodb 不支持 change stream，只依靠定时同步
+func (srv *Service) watchSetting(ctx context.Context) {
+	names := []string{
+		model.CollectionNameModule,
+		model.CollectionNameAlarmRule,
+		model.CollectionNameHookURL,
+		model.CollectionNameProcessor,
+	}
+	watchSettingLoop(ctx, names, watchRetryInterval, func(ctx context.Context, resumeAfter bson.Raw, fn func(string)) (bson.Raw, error) {
+		return srv.store.WatchCollections(ctx, names, resumeAfter, fn)
+	}, srv.notifySettingChanged)
+}
+
+type watchFunc func(ctx context.Context, resumeAfter bson.Raw, fn func(collectionName string)) (bson.Raw, error)
+
+// watchSettingLoop 出错后间隔重新监听，从上次的 resume token 继续，断开期间的变更不会丢失
+// 不能继续时全部重新加载一次，再从最新的位置监听
+func watchSettingLoop(ctx context.Context, names []string, retry time.Duration, watch watchFunc, notify func(collectionName string)) {
+	var token bson.Raw
+	for {
+		var err error
+		token, err = watch(ctx, token, notify)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == storage.ErrResumeTokenLost {
+			logs.Qezap.Warn("watchSetting", zap.Error(err))
+			for _, name := range names {
+				notify(name)
+			}
+			continue
+		}
 		if err != nil {
-			logs.Qezap.Error("backgroundSyncAlarmRuleSetting", zap.String("error", err.Error()))
+			logs.Qezap.Warn("watchSetting", zap.Error(err))
 		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+func (srv *Service) notifySettingChanged(collectionName string) {
+	var ch chan struct{}
+	switch collectionName {
+	case model.CollectionNameModule:
+		ch = srv.moduleChanged
+	case model.CollectionNameAlarmRule, model.CollectionNameHookURL:
+		ch = srv.alarmChanged
+	case model.CollectionNameProcessor:
+		ch = srv.processorChanged
+	default:
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+type statisticsJob struct {
+	module string
+	ip     string
+	docs   []*model.Logging
+}
+
+// Close 等待队列中剩余的报警与统计处理完，再同步统计与配额，需要在所有接入服务停止后调用
+func (srv *Service) Close() {
+	srv.cancelWatch()
+	timeout := 5 * time.Second
+	if srv.alarmQueue != nil {
+		srv.alarmQueue.Close(timeout)
+		srv.alarm.Close(timeout)
+	}
+	if srv.metricsQueue != nil {
+		srv.metricsQueue.Close(timeout)
 	}
+	srv.Sync()
 }
 
 func (srv *Service) Sync() {
+	srv.quota.Sync()
+	srv.patterns.Sync()
 	if srv.metrics != nil {
 		srv.metrics.Sync()
 	}
@@ -0,0 +1,220 @@
+package receiver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+
+	"github.com/huzhongqing/qelog/infra/alert"
+	"github.com/huzhongqing/qelog/infra/httputil"
+	"github.com/huzhongqing/qelog/infra/kit"
+	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/receiver/alarm"
+)
+
+// 未注册的模块首次写入时自动创建
+// 开启审批时新模块为待审批状态，期间的日志按配置丢弃或缓存在本实例内存中，审批通过后写入
+
+type pendingBatch struct {
+	ip   string
+	docs []*model.Logging
+}
+
+type pendingBuffer struct {
+	mutex   sync.Mutex
+	batches map[string][]pendingBatch
+	number  map[string]int
+}
+
+func newPendingBuffer() *pendingBuffer {
+	return &pendingBuffer{
+		batches: make(map[string][]pendingBatch),
+		number:  make(map[string]int),
+	}
+}
+
+// add 超出缓存条数时丢弃整批
+func (b *pendingBuffer) add(name, ip string, docs []*model.Logging, max int) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.number[name]+len(docs) > max {
+		return false
+	}
+	b.batches[name] = append(b.batches[name], pendingBatch{ip: ip, docs: docs})
+	b.number[name] += len(docs)
+	return true
+}
+
+// take 模块配置更新时，取出已审批的模块缓存，删除的模块直接丢弃缓存
+func (b *pendingBuffer) take(modules map[string]*model.Module) map[*model.Module][]pendingBatch {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	out := make(map[*model.Module][]pendingBatch)
+	for name, batches := range b.batches {
+		module, ok := modules[name]
+		if ok && module.Pending {
+			continue
+		}
+		if ok {
+			out[module] = batches
+		}
+		delete(b.batches, name)
+		delete(b.number, name)
+	}
+	return out
+}
+
+func compileNamePatterns(patterns []string) []*regexp.Regexp {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, v := range patterns {
+		// 配置加载时已经校验
+		out = append(out, regexp.MustCompile(v))
+	}
+	return out
+}
+
+// allowRegister 模块名规则与管理后台创建模块相同
+func (srv *Service) allowRegister(name string) bool {
+	if !config.Global.AutoRegister.Enable {
+		return false
+	}
+	if len(name) < 2 || len(name) > 24 || name != strings.ToLower(name) || strings.ContainsAny(name, " \t\r\n") {
+		return false
+	}
+	if len(srv.namePatterns) == 0 {
+		return true
+	}
+	for _, re := range srv.namePatterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// findModule 判断 module 是否有效，未注册时按策略自动注册，否则不接受写入
+func (srv *Service) findModule(name, ip string) (*model.Module, error) {
+	srv.mutex.RLock()
+	module, ok := srv.modules[name]
+	srv.mutex.RUnlock()
+	if ok {
+		return module, nil
+	}
+	if !srv.allowRegister(name) {
+		return nil, httputil.NewError(httputil.ErrCodeNotFound, name+" module unregistered")
+	}
+	return srv.registerModule(name, ip)
+}
+
+func (srv *Service) registerModule(name, ip string) (*model.Module, error) {
+	cfg := config.Global.AutoRegister
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	index := cfg.ShardingIndex
+	if index <= 0 {
+		docs, err := srv.store.FindAllModule(ctx)
+		if err != nil {
+			return nil, httputil.ErrSystemException.MergeError(err)
+		}
+		index = model.SuggestShardingIndex(docs)
+	}
+	doc := &model.Module{
+		Name:                 name,
+		Desc:                 "auto registered from " + ip,
+		ShardingIndex:        index,
+		HistoryShardingIndex: make([]int, 0),
+		Pending:              cfg.Approval,
+		UpdatedAt:            time.Now().Local(),
+	}
+	if err := srv.store.InsertModule(ctx, doc); err != nil {
+		// 模块名唯一索引，可能已被其他实例创建
+		exist := &model.Module{}
+		ok, findErr := srv.store.FindOneModule(ctx, bson.M{"name": name}, exist)
+		if findErr != nil || !ok {
+			return nil, httputil.ErrSystemException.MergeError(err)
+		}
+		doc = exist
+	} else {
+		logs.Qezap.Info("RegisterModule", zap.String("module", name), zap.String("ip", ip),
+			zap.Int("shardingIndex", index), zap.Bool("pending", doc.Pending))
+		go srv.notifyModuleRegistered(doc, ip)
+	}
+
+	srv.mutex.Lock()
+	if v, ok := srv.modules[name]; ok {
+		doc = v
+	} else {
+		srv.modules[name] = doc
+	}
+	srv.mutex.Unlock()
+	return doc, nil
+}
+
+// holdPending 待审批模块的日志，丢弃时不返回错误，避免客户端重试
+func (srv *Service) holdPending(module *model.Module, ip string, docs []*model.Logging) error {
+	cfg := config.Global.AutoRegister
+	if cfg.PendingAction == config.PendingActionBuffer && srv.pending.add(module.Name, ip, docs, cfg.PendingBufferSize) {
+		return nil
+	}
+	promDroppedLines.WithLabelValues(module.Name, dropReasonPending).Add(float64(len(docs)))
+	return nil
+}
+
+// flushPending 写入审批通过的模块缓存的日志
+func (srv *Service) flushPending(approved map[*model.Module][]pendingBatch) {
+	for module, batches := range approved {
+		for _, v := range batches {
+			if err := srv.handleLogging(context.Background(), module, v.ip, v.docs); err != nil {
+				logs.Qezap.Error("flushPending", zap.String("module", module.Name), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (srv *Service) notifyModuleRegistered(doc *model.Module, ip string) {
+	id, err := primitive.ObjectIDFromHex(config.Global.AutoRegister.NotifyHookID)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	hook := &model.HookURL{}
+	if ok, err := srv.store.FindOneHookURL(ctx, bson.M{"_id": id}, hook); err != nil || !ok {
+		logs.Qezap.Error("notifyModuleRegistered", zap.String("hookId", id.Hex()), zap.Bool("found", ok), zap.Error(err))
+		return
+	}
+
+	keyWord := alarm.ContentPrefix
+	if hook.KeyWord != "" {
+		keyWord = hook.KeyWord
+	}
+	status := "已启用"
+	if doc.Pending {
+		status = "待审批"
+	}
+	machineIP, _ := kit.GetLocalIPV4()
+	content := fmt.Sprintf(`%s
+新模块自动注册: %s
+分片索引: %d
+状态: %s
+来源IP: %s
+时间: %s
+接收节点: %s`, keyWord, doc.Name, doc.ShardingIndex, status, ip, doc.UpdatedAt.Format("2006-01-02 15:04:05"), machineIP)
+
+	// 目前只支持钉钉
+	method := alert.NewDingDing()
+	method.SetHookURL(hook.URL)
+	if err := method.Send(ctx, content); err != nil {
+		logs.Qezap.Error("notifyModuleRegistered", zap.String(method.Method(), err.Error()))
+	}
+}
@@ -0,0 +1,71 @@
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// RFC6587 TCP 传输分帧
+// octet-counting: "MSG-LEN SP SYSLOG-MSG"
+// non-transparent-framing: 以 LF 作为结束符
+// 每一帧单独判断，兼容同一连接混用的情况
+
+var ErrFrameTooLarge = errors.New("syslog frame too large")
+
+func NewScanner(r *bufio.Reader, maxSize int) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxSize+8)
+	scanner.Split(ScanFrames(maxSize))
+	return scanner
+}
+
+func ScanFrames(maxSize int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		// 跳过帧之间多余的换行
+		start := 0
+		for start < len(data) && (data[start] == '\n' || data[start] == '\r') {
+			start++
+		}
+		if start == len(data) {
+			if atEOF {
+				return len(data), nil, nil
+			}
+			return start, nil, nil
+		}
+		data = data[start:]
+
+		if data[0] >= '1' && data[0] <= '9' {
+			sp := bytes.IndexByte(data, ' ')
+			if sp > 0 && sp <= 8 {
+				if n, err := strconv.Atoi(string(data[:sp])); err == nil {
+					if n > maxSize {
+						return 0, nil, ErrFrameTooLarge
+					}
+					if len(data) < sp+1+n {
+						if atEOF {
+							return start + len(data), data[sp+1:], nil
+						}
+						return start, nil, nil
+					}
+					return start + sp + 1 + n, data[sp+1 : sp+1+n], nil
+				}
+			} else if sp < 0 && len(data) <= 8 && !atEOF {
+				// 长度还未读取完整
+				return start, nil, nil
+			}
+		}
+
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			return start + i + 1, bytes.TrimRight(data[:i], "\r"), nil
+		}
+		if atEOF {
+			return start + len(data), data, nil
+		}
+		if len(data) > maxSize {
+			return 0, nil, ErrFrameTooLarge
+		}
+		return start, nil, nil
+	}
+}
@@ -0,0 +1,244 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持 RFC5424 与 RFC3164(BSD) 两种格式
+// 解析尽量宽松，网络设备实现的格式往往不够标准
+
+var (
+	ErrEmptyMessage = errors.New("syslog empty message")
+	ErrInvalidPRI   = errors.New("syslog invalid pri")
+)
+
+const (
+	nilValue = "-"
+	// 未携带 PRI 时 RFC3164 建议的默认值 user.notice
+	defaultPRI = 13
+)
+
+type Message struct {
+	Facility  int
+	Severity  int
+	Version   int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	// SD-ID -> PARAM-NAME -> PARAM-VALUE
+	StructuredData map[string]map[string]string
+	Message        string
+}
+
+func Parse(b []byte) (*Message, error) {
+	b = bytes.TrimRight(b, "\r\n\x00")
+	if len(b) == 0 {
+		return nil, ErrEmptyMessage
+	}
+	m := &Message{}
+	pri, rest, err := parsePRI(b)
+	if err != nil {
+		return nil, err
+	}
+	m.Facility = pri / 8
+	m.Severity = pri % 8
+
+	// RFC5424 PRI 后紧跟版本号
+	if len(rest) >= 2 && rest[0] >= '1' && rest[0] <= '9' {
+		if i := bytes.IndexByte(rest, ' '); i > 0 && i <= 3 {
+			if v, err := strconv.Atoi(string(rest[:i])); err == nil {
+				m.Version = v
+				parse5424(m, rest[i+1:])
+				return m, nil
+			}
+		}
+	}
+	parse3164(m, rest)
+	return m, nil
+}
+
+func parsePRI(b []byte) (int, []byte, error) {
+	if b[0] != '<' {
+		return defaultPRI, b, nil
+	}
+	end := bytes.IndexByte(b, '>')
+	if end < 2 || end > 4 {
+		return 0, nil, ErrInvalidPRI
+	}
+	pri, err := strconv.Atoi(string(b[1:end]))
+	if err != nil || pri < 0 || pri > 191 {
+		return 0, nil, ErrInvalidPRI
+	}
+	return pri, b[end+1:], nil
+}
+
+// TIMESTAMP SP HOSTNAME SP APP-NAME SP PROCID SP MSGID SP STRUCTURED-DATA [SP MSG]
+func parse5424(m *Message, b []byte) {
+	var field string
+	field, b = nextField(b)
+	if field != nilValue {
+		if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+			m.Timestamp = t
+		}
+	}
+	field, b = nextField(b)
+	m.Hostname = nilToEmpty(field)
+	field, b = nextField(b)
+	m.AppName = nilToEmpty(field)
+	field, b = nextField(b)
+	m.ProcID = nilToEmpty(field)
+	field, b = nextField(b)
+	m.MsgID = nilToEmpty(field)
+
+	if len(b) > 0 && b[0] == '[' {
+		m.StructuredData, b = parseStructuredData(b)
+	} else {
+		_, b = nextField(b)
+	}
+	// 去掉 UTF-8 BOM
+	b = bytes.TrimPrefix(b, []byte("\xEF\xBB\xBF"))
+	m.Message = string(b)
+}
+
+func parseStructuredData(b []byte) (map[string]map[string]string, []byte) {
+	sd := make(map[string]map[string]string)
+	for len(b) > 0 && b[0] == '[' {
+		b = b[1:]
+		var id string
+		id, b = nextToken(b, " ]")
+		params := make(map[string]string)
+		for len(b) > 0 && b[0] != ']' {
+			b = bytes.TrimLeft(b, " ")
+			var name string
+			name, b = nextToken(b, "=]")
+			if len(b) < 2 || b[0] != '=' || b[1] != '"' {
+				break
+			}
+			var val string
+			val, b = quotedValue(b[2:])
+			params[name] = val
+		}
+		if len(b) > 0 && b[0] == ']' {
+			b = b[1:]
+		}
+		if id != "" {
+			sd[id] = params
+		}
+	}
+	if len(b) > 0 && b[0] == ' ' {
+		b = b[1:]
+	}
+	return sd, b
+}
+
+// 处理转义 \" \\ \]
+func quotedValue(b []byte) (string, []byte) {
+	var sb strings.Builder
+	for i := 0; i < len(b); i++ {
+		switch b[i] {
+		case '\\':
+			if i+1 < len(b) && (b[i+1] == '"' || b[i+1] == '\\' || b[i+1] == ']') {
+				sb.WriteByte(b[i+1])
+				i++
+				continue
+			}
+			sb.WriteByte(b[i])
+		case '"':
+			return sb.String(), b[i+1:]
+		default:
+			sb.WriteByte(b[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// 长的格式优先匹配
+var bsdTimestampLayouts = []string{"Jan _2 2006 15:04:05", time.StampMilli, time.Stamp}
+
+// TIMESTAMP SP HOSTNAME SP TAG[PID]: MSG
+func parse3164(m *Message, b []byte) {
+	now := time.Now()
+	for _, layout := range bsdTimestampLayouts {
+		if len(b) < len(layout) {
+			continue
+		}
+		t, err := time.ParseInLocation(layout, string(b[:len(layout)]), time.Local)
+		if err != nil {
+			continue
+		}
+		if t.Year() == 0 {
+			// BSD 格式不带年份，跨年时不能出现未来时间
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		m.Timestamp = t
+		b = bytes.TrimLeft(b[len(layout):], " ")
+		break
+	}
+	// 也有设备直接使用 RFC3339 时间
+	if m.Timestamp.IsZero() {
+		field, rest := nextField(b)
+		if t, err := time.Parse(time.RFC3339Nano, field); err == nil {
+			m.Timestamp = t
+			b = rest
+		}
+	}
+
+	if !m.Timestamp.IsZero() {
+		// 有时间戳时，紧接着的是主机名
+		if field, rest := nextField(b); field != "" && !isTag(field) {
+			m.Hostname = field
+			b = rest
+		}
+	}
+
+	if i := bytes.IndexByte(b, ':'); i > 0 && i <= 48 && isTag(string(b[:i+1])) {
+		tag := string(b[:i])
+		if l := strings.IndexByte(tag, '['); l > 0 && strings.HasSuffix(tag, "]") {
+			m.ProcID = tag[l+1 : len(tag)-1]
+			tag = tag[:l]
+		}
+		m.AppName = tag
+		b = bytes.TrimLeft(b[i+1:], " ")
+	}
+	m.Message = string(b)
+}
+
+// TAG 以 ':' 结尾，且不包含空格
+func isTag(s string) bool {
+	if !strings.HasSuffix(s, ":") || len(s) < 2 {
+		return false
+	}
+	return !strings.ContainsAny(s, " \t")
+}
+
+func nextField(b []byte) (string, []byte) {
+	i := bytes.IndexByte(b, ' ')
+	if i < 0 {
+		return string(b), nil
+	}
+	return string(b[:i]), b[i+1:]
+}
+
+func nextToken(b []byte, stops string) (string, []byte) {
+	i := bytes.IndexAny(b, stops)
+	if i < 0 {
+		return string(b), nil
+	}
+	return string(b[:i]), b[i:]
+}
+
+func nilToEmpty(s string) string {
+	if s == nilValue {
+		return ""
+	}
+	return s
+}
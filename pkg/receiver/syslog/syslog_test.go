@@ -0,0 +1,69 @@
+package syslog
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestParse5424(t *testing.T) {
+	str := `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry...`
+	m, err := Parse([]byte(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Facility != 20 || m.Severity != 5 || m.Version != 1 {
+		t.Fatal(m.Facility, m.Severity, m.Version)
+	}
+	if m.Hostname != "mymachine.example.com" || m.AppName != "evntslog" || m.ProcID != "" || m.MsgID != "ID47" {
+		t.Fatal(m.Hostname, m.AppName, m.ProcID, m.MsgID)
+	}
+	if m.StructuredData["exampleSDID@32473"]["eventSource"] != "Application" {
+		t.Fatal(m.StructuredData)
+	}
+	if m.Message != "An application event log entry..." {
+		t.Fatal(m.Message)
+	}
+	if m.Timestamp.UnixNano()/1e6 != 1065910455003 {
+		t.Fatal(m.Timestamp)
+	}
+}
+
+func TestParse3164(t *testing.T) {
+	str := `<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8`
+	m, err := Parse([]byte(str))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Facility != 4 || m.Severity != 2 {
+		t.Fatal(m.Facility, m.Severity)
+	}
+	if m.Hostname != "mymachine" || m.AppName != "su" || m.ProcID != "230" {
+		t.Fatal(m.Hostname, m.AppName, m.ProcID)
+	}
+	if m.Message != "'su root' failed for lonvick on /dev/pts/8" {
+		t.Fatal(m.Message)
+	}
+	if m.Timestamp.Month() != 10 || m.Timestamp.Day() != 11 || m.Timestamp.Year() == 0 {
+		t.Fatal(m.Timestamp)
+	}
+}
+
+func TestScanFrames(t *testing.T) {
+	msg1 := `<34>1 - host app - - - hello`
+	msg2 := `<34>Oct 11 22:14:15 host app: world`
+	msg3 := "<13>1 - host app - - - multi\nline"
+	data := "28 " + msg1 + msg2 + "\n" + "33 " + msg3
+
+	scanner := NewScanner(bufio.NewReader(strings.NewReader(data)), 1024)
+	frames := make([]string, 0)
+	for scanner.Scan() {
+		frames = append(frames, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 || frames[0] != msg1 || frames[1] != msg2 || frames[2] != msg3 {
+		t.Fatalf("%q", frames)
+	}
+}
@@ -0,0 +1,308 @@
+package receiver
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/huzhongqing/qelog/infra/kit"
+	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"github.com/huzhongqing/qelog/pkg/config"
+	"github.com/huzhongqing/qelog/pkg/receiver/syslog"
+	"github.com/huzhongqing/qelog/pkg/types"
+)
+
+const (
+	// 合并写入，减少数据库请求
+	syslogBatchSize     = 500
+	syslogFlushInterval = time.Second
+)
+
+type SyslogService struct {
+	cfg      config.Syslog
+	receiver *Service
+
+	mutex     sync.Mutex
+	udpConn   net.PacketConn
+	tcpListen net.Listener
+	conns     map[net.Conn]struct{}
+
+	entries chan *syslogEntry
+	closed  chan struct{}
+	done    chan struct{}
+}
+
+type syslogEntry struct {
+	module string
+	ip     string
+	doc    *model.Logging
+}
+
+func NewSyslogService(receiver *Service) *SyslogService {
+	srv := &SyslogService{
+		cfg:      config.Global.Syslog,
+		receiver: receiver,
+		conns:    make(map[net.Conn]struct{}),
+		entries:  make(chan *syslogEntry, syslogBatchSize*4),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go srv.backgroundFlush()
+	return srv
+}
+
+func (srv *SyslogService) RunUDP(addr string) error {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	srv.mutex.Lock()
+	srv.udpConn = conn
+	srv.mutex.Unlock()
+
+	buf := make([]byte, srv.cfg.MaxMessageSize)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if srv.isClosed() {
+				return nil
+			}
+			return err
+		}
+		srv.handleMessage(buf[:n], kit.AddrStringToIP(remote))
+	}
+}
+
+func (srv *SyslogService) RunTCP(addr string) error {
+	listen, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv.mutex.Lock()
+	srv.tcpListen = listen
+	srv.mutex.Unlock()
+
+	for {
+		conn, err := listen.Accept()
+		if err != nil {
+			if srv.isClosed() {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+func (srv *SyslogService) serveConn(conn net.Conn) {
+	srv.mutex.Lock()
+	srv.conns[conn] = struct{}{}
+	srv.mutex.Unlock()
+	defer func() {
+		srv.mutex.Lock()
+		delete(srv.conns, conn)
+		srv.mutex.Unlock()
+		_ = conn.Close()
+	}()
+
+	ip := kit.AddrStringToIP(conn.RemoteAddr())
+	scanner := syslog.NewScanner(bufio.NewReader(conn), srv.cfg.MaxMessageSize)
+	for scanner.Scan() {
+		srv.handleMessage(scanner.Bytes(), ip)
+	}
+	if err := scanner.Err(); err != nil && !srv.isClosed() {
+		logs.Qezap.Warn("SyslogConn", zap.String("remote", ip), zap.Error(err))
+	}
+}
+
+func (srv *SyslogService) handleMessage(b []byte, remoteIP string) {
+	msg, err := syslog.Parse(b)
+	if err != nil {
+		logs.Qezap.Debug("SyslogParse", zap.String("remote", remoteIP), zap.Error(err))
+		return
+	}
+	module, hostnameAsIP := srv.route(msg)
+	if module == "" {
+		return
+	}
+	ip := remoteIP
+	if hostnameAsIP && msg.Hostname != "" {
+		ip = msg.Hostname
+	}
+	entry := &syslogEntry{
+		module: module,
+		ip:     ip,
+		doc:    syslogToLogging(module, ip, msg, len(b)),
+	}
+	select {
+	case srv.entries <- entry:
+	case <-srv.closed:
+	}
+}
+
+func (srv *SyslogService) route(msg *syslog.Message) (module string, hostnameAsIP bool) {
+	for _, r := range srv.cfg.Routes {
+		if matchPattern(r.AppName, msg.AppName) && matchPattern(r.Hostname, msg.Hostname) {
+			return r.Module, r.HostnameAsIP
+		}
+	}
+	if srv.cfg.DefaultModule != "" {
+		return srv.cfg.DefaultModule, srv.cfg.HostnameAsIP
+	}
+	return strings.ToLower(msg.AppName), srv.cfg.HostnameAsIP
+}
+
+func matchPattern(pattern, val string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(val, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == val
+}
+
+func (srv *SyslogService) backgroundFlush() {
+	defer close(srv.done)
+	tick := time.NewTicker(syslogFlushInterval)
+	defer tick.Stop()
+
+	pending := make([]*syslogEntry, 0, syslogBatchSize)
+	for {
+		select {
+		case v := <-srv.entries:
+			pending = append(pending, v)
+			if len(pending) >= syslogBatchSize {
+				srv.flush(pending)
+				pending = pending[:0]
+			}
+		case <-tick.C:
+			if len(pending) > 0 {
+				srv.flush(pending)
+				pending = pending[:0]
+			}
+		case <-srv.closed:
+			for {
+				select {
+				case v := <-srv.entries:
+					pending = append(pending, v)
+				default:
+					srv.flush(pending)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (srv *SyslogService) flush(entries []*syslogEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	groups := make(loggingGroups)
+	for _, v := range entries {
+		groups.add(v.module, v.ip, v.doc)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.receiver.insertLoggingGroups(ctx, groups); err != nil {
+		logs.Qezap.Error("SyslogInsert", zap.Error(err))
+	}
+}
+
+func (srv *SyslogService) isClosed() bool {
+	select {
+	case <-srv.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (srv *SyslogService) Close() error {
+	srv.mutex.Lock()
+	if srv.isClosed() {
+		srv.mutex.Unlock()
+		return nil
+	}
+	close(srv.closed)
+	if srv.udpConn != nil {
+		_ = srv.udpConn.Close()
+	}
+	if srv.tcpListen != nil {
+		_ = srv.tcpListen.Close()
+	}
+	for conn := range srv.conns {
+		_ = conn.Close()
+	}
+	srv.mutex.Unlock()
+
+	<-srv.done
+	return nil
+}
+
+// syslog 严重等级 0-7 转换成日志等级
+func syslogSeverityToLevel(severity int) model.Level {
+	switch severity {
+	case 0:
+		return types.LevelStr2Int("FATAL")
+	case 1:
+		return types.LevelStr2Int("PANIC")
+	case 2:
+		return types.LevelStr2Int("DPANIC")
+	case 3:
+		return types.LevelStr2Int("ERROR")
+	case 4:
+		return types.LevelStr2Int("WARN")
+	case 7:
+		return types.LevelStr2Int("DEBUG")
+	}
+	return types.LevelStr2Int("INFO")
+}
+
+func syslogToLogging(module, ip string, msg *syslog.Message, size int) *model.Logging {
+	ts := msg.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	short := shortMessage(msg.Message)
+
+	full := map[string]interface{}{
+		"facility": msg.Facility,
+	}
+	if short != msg.Message {
+		full["msg"] = msg.Message
+	}
+	if msg.ProcID != "" {
+		full["proc_id"] = msg.ProcID
+	}
+	if len(msg.StructuredData) > 0 {
+		full["sd"] = msg.StructuredData
+	}
+	fullStr, _ := types.MarshalToString(full)
+
+	timeMill := ts.UnixNano() / 1e6
+	return &model.Logging{
+		Module:     module,
+		IP:         ip,
+		Level:      syslogSeverityToLevel(msg.Severity),
+		Short:      short,
+		Full:       fullStr,
+		Condition1: msg.AppName,
+		Condition2: msg.Hostname,
+		Condition3: msg.MsgID,
+		TimeMill:   timeMill,
+		TimeSec:    timeMill / 1e3,
+		Size:       size,
+	}
+}
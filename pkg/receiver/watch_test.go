@@ -0,0 +1,84 @@
+package receiver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/huzhongqing/qelog/pkg/storage"
+)
+
+// 断开后从上次的 resume token 继续，token 失效时全部重新加载，再从最新的位置监听
+func TestWatchSettingLoopResume(t *testing.T) {
+	names := []string{"module", "alarm_rule"}
+	token, err := bson.Marshal(bson.M{"_data": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := make([]bson.Raw, 0)
+	notified := make([]string, 0)
+	watch := func(ctx context.Context, resumeAfter bson.Raw, fn func(string)) (bson.Raw, error) {
+		calls = append(calls, resumeAfter)
+		switch len(calls) {
+		case 1:
+			fn("module")
+			return bson.Raw(token), errors.New("connection reset")
+		case 2:
+			return nil, storage.ErrResumeTokenLost
+		}
+		cancel()
+		return nil, nil
+	}
+	watchSettingLoop(ctx, names, time.Millisecond, watch, func(name string) { notified = append(notified, name) })
+
+	if len(calls) != 3 || calls[0] != nil || !reflect.DeepEqual(calls[1], bson.Raw(token)) || calls[2] != nil {
+		t.Fatal(calls)
+	}
+	if !reflect.DeepEqual(notified, []string{"module", "module", "alarm_rule"}) {
+		t.Fatal(notified)
+	}
+}
+
+// 单机部署不支持 change stream，监听一直失败时定时同步仍然生效
+func TestSyncSettingFallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	notify := func(string) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	watches := int32(0)
+	go watchSettingLoop(ctx, []string{"module"}, time.Millisecond, func(ctx context.Context, resumeAfter bson.Raw, fn func(string)) (bson.Raw, error) {
+		atomic.AddInt32(&watches, 1)
+		return nil, errors.New("The $changeStream stage is only supported on replica sets")
+	}, notify)
+
+	updates := make(chan struct{}, 10)
+	go syncSetting(ctx, "syncModuleSetting", 10*time.Millisecond, changed, func() error {
+		select {
+		case updates <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-updates:
+		case <-time.After(time.Second):
+			t.Fatal("polling not running")
+		}
+	}
+	if atomic.LoadInt32(&watches) < 2 {
+		t.Fatal("watch not retried", watches)
+	}
+}
@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 固定数量协程消费的有界队列，队列满时直接丢弃并计数
+// 避免突发流量下每个数据包创建协程，导致协程数量无限增长
+
+var (
+	registryMutex sync.Mutex
+	registry      = make(map[string]*Queue)
+)
+
+type Queue struct {
+	// 64 位原子操作需要对齐，放在结构体开头
+	pushed  uint64
+	dropped uint64
+
+	name    string
+	workers int
+	handle  func(v interface{})
+	ch      chan interface{}
+
+	mutex  sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type Stats struct {
+	Name     string `json:"name"`
+	Depth    int    `json:"depth"`
+	Capacity int    `json:"capacity"`
+	Workers  int    `json:"workers"`
+	Pushed   uint64 `json:"pushed"`
+	Dropped  uint64 `json:"dropped"`
+}
+
+// NewQueue 同名队列会覆盖状态统计中的旧队列
+func NewQueue(name string, size, workers int, handle func(v interface{})) *Queue {
+	if size <= 0 {
+		size = 1
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+	q := &Queue{
+		name:    name,
+		workers: workers,
+		handle:  handle,
+		ch:      make(chan interface{}, size),
+	}
+	q.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go q.run()
+	}
+
+	registryMutex.Lock()
+	registry[name] = q
+	registryMutex.Unlock()
+	return q
+}
+
+func (q *Queue) run() {
+	defer q.wg.Done()
+	for v := range q.ch {
+		q.handle(v)
+	}
+}
+
+// Push 不阻塞，队列已满或已关闭时返回 false
+func (q *Queue) Push(v interface{}) bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.closed {
+		atomic.AddUint64(&q.dropped, 1)
+		return false
+	}
+	select {
+	case q.ch <- v:
+		atomic.AddUint64(&q.pushed, 1)
+		return true
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+		return false
+	}
+}
+
+func (q *Queue) Stats() Stats {
+	return Stats{
+		Name:     q.name,
+		Depth:    len(q.ch),
+		Capacity: cap(q.ch),
+		Workers:  q.workers,
+		Pushed:   atomic.LoadUint64(&q.pushed),
+		Dropped:  atomic.LoadUint64(&q.dropped),
+	}
+}
+
+// Close 不再接收新任务，等待队列中剩余的任务处理完，超时返回 false
+func (q *Queue) Close(timeout time.Duration) bool {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.ch)
+	}
+	q.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// AllStats 进程内所有队列的状态，按名称排序
+func AllStats() []Stats {
+	registryMutex.Lock()
+	out := make([]Stats, 0, len(registry))
+	for _, q := range registry {
+		out = append(out, q.Stats())
+	}
+	registryMutex.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
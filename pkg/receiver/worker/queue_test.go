@@ -0,0 +1,52 @@
+package worker
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueue_Drop(t *testing.T) {
+	block := make(chan struct{})
+	var handled int32
+	q := NewQueue("test_drop", 2, 1, func(v interface{}) {
+		<-block
+		atomic.AddInt32(&handled, 1)
+	})
+
+	// 第一个任务被协程取走阻塞，队列再容纳两个
+	if !q.Push(1) {
+		t.Fatal("push 1")
+	}
+	time.Sleep(50 * time.Millisecond)
+	q.Push(2)
+	q.Push(3)
+	if q.Push(4) {
+		t.Fatal("queue full but pushed")
+	}
+	s := q.Stats()
+	if s.Depth != 2 || s.Pushed != 3 || s.Dropped != 1 {
+		t.Fatal(s)
+	}
+
+	close(block)
+	if !q.Close(time.Second) {
+		t.Fatal("close timeout")
+	}
+	if atomic.LoadInt32(&handled) != 3 {
+		t.Fatal(handled)
+	}
+	if q.Push(5) {
+		t.Fatal("pushed after close")
+	}
+
+	found := false
+	for _, v := range AllStats() {
+		if v.Name == "test_drop" {
+			found = v.Dropped == 2
+		}
+	}
+	if !found {
+		t.Fatal(AllStats())
+	}
+}
@@ -2,10 +2,13 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/huzhongqing/qelog/pkg/common/model"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -90,3 +93,70 @@ func (store *Store) DelHookURL(ctx context.Context, id primitive.ObjectID) error
 	_, err := store.database.Collection(model.CollectionNameHookURL).DeleteOne(ctx, filter)
 	return handlerError(err)
 }
+
+func (store *Store) AggregateAlarmWindow(ctx context.Context, pipeline interface{}, result interface{}) error {
+	cursor, err := store.database.Collection(model.CollectionNameAlarmWindow).Aggregate(ctx, pipeline)
+	if err != nil {
+		return handlerError(err)
+	}
+	defer cursor.Close(ctx)
+	return handlerError(cursor.All(ctx, result))
+}
+
+// ClaimAlarmFire 上一次报警在 before 之前时抢占本次报警，多个实例同时抢占只有一个成功
+func (store *Store) ClaimAlarmFire(ctx context.Context, id string, now, before time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "fired_at": bson.M{"$lte": before}}
+	update := bson.M{"$set": bson.M{"fired_at": now}}
+	_, err := store.database.Collection(model.CollectionNameAlarmFire).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		// 记录存在但不满足时间条件，upsert 插入相同的 _id
+		if isDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, handlerError(err)
+	}
+	return true, nil
+}
+
+// ReleaseAlarmFire 报警发送失败时归还，下一次检查重新发送
+func (store *Store) ReleaseAlarmFire(ctx context.Context, id string, firedAt time.Time) error {
+	filter := bson.M{"_id": id, "fired_at": firedAt}
+	update := bson.M{"$set": bson.M{"fired_at": time.Time{}}}
+	_, err := store.database.Collection(model.CollectionNameAlarmFire).UpdateOne(ctx, filter, update)
+	return handlerError(err)
+}
+
+// SwitchAlarmFiring 切换报警中的状态，多个实例同时切换只有一个成功
+func (store *Store) SwitchAlarmFiring(ctx context.Context, id string, firing bool, now time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "firing": bson.M{"$ne": firing}}
+	update := bson.M{"$set": bson.M{"firing": firing, "fired_at": now}}
+	// 只有开始报警时需要创建记录
+	ret, err := store.database.Collection(model.CollectionNameAlarmFire).UpdateOne(ctx, filter, update, options.Update().SetUpsert(firing))
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, handlerError(err)
+	}
+	return ret.ModifiedCount+ret.UpsertedCount > 0, nil
+}
+
+func isDuplicateKeyError(err error) bool {
+	var we mongo.WriteException
+	if errors.As(err, &we) {
+		for _, v := range we.WriteErrors {
+			if v.Code == 11000 {
+				return true
+			}
+		}
+	}
+	var ce mongo.CommandError
+	return errors.As(err, &ce) && ce.Code == 11000
+}
+
+func (store *Store) FindAlarmFire(ctx context.Context, filter bson.M) ([]*model.AlarmFire, error) {
+	docs := make([]*model.AlarmFire, 0)
+	coll := store.database.Collection(model.CollectionNameAlarmFire)
+	err := store.database.Find(ctx, coll, filter, &docs)
+	return docs, handlerError(err)
+}
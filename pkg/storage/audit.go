@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (store *Store) InsertAuditLog(ctx context.Context, doc *model.AuditLog) error {
+	_, err := store.database.Collection(doc.CollectionName()).InsertOne(ctx, doc)
+	return handlerError(err)
+}
+
+func (store *Store) FindAuditLogList(ctx context.Context, filter bson.M, result interface{}, opt *options.FindOptions) (int64, error) {
+	c, err := store.database.FindAndCount(ctx, store.database.Collection(model.CollectionNameAuditLog), filter, result, opt)
+	return c, handlerError(err)
+}
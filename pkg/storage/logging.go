@@ -4,7 +4,9 @@ import (
 	"context"
 
 	"github.com/huzhongqing/qelog/infra/logs"
+	"github.com/huzhongqing/qelog/pkg/common/model"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.uber.org/zap"
 )
@@ -41,3 +43,61 @@ func (store *Store) FindLoggingList(ctx context.Context, collectionName string,
 		return c, nil
 	}
 }
+
+// FindLogging 不统计数量
+func (store *Store) FindLogging(ctx context.Context, collectionName string, filter bson.M, result interface{}, opt *options.FindOptions) error {
+	err := store.database.Find(ctx, store.database.Collection(collectionName), filter, result, opt)
+	return handlerError(err)
+}
+
+func (store *Store) FindOneLogging(ctx context.Context, collectionName string, filter bson.M, doc *model.Logging) (bool, error) {
+	ok, err := store.database.FindOne(ctx, store.database.Collection(collectionName), filter, doc)
+	return ok, handlerError(err)
+}
+
+// CountLogging 最多统计到 limit 条，为 0 时不限制
+func (store *Store) CountLogging(ctx context.Context, collectionName string, filter bson.M, limit int64) (int64, error) {
+	opt := options.Count()
+	opt.SetLimit(limit)
+	c, err := store.database.Collection(collectionName).CountDocuments(ctx, filter, opt)
+	return c, handlerError(err)
+}
+
+// AggregateLogging 聚合结果写入 result
+func (store *Store) AggregateLogging(ctx context.Context, collectionName string, pipeline interface{}, result interface{}) error {
+	cursor, err := store.database.Collection(collectionName).Aggregate(ctx, pipeline)
+	if err != nil {
+		return handlerError(err)
+	}
+	defer cursor.Close(ctx)
+	return handlerError(cursor.All(ctx, result))
+}
+
+// LoggingIter 逐条读取日志，不在内存中缓存所有结果
+type LoggingIter struct {
+	cursor *mongo.Cursor
+}
+
+func (store *Store) IterLogging(ctx context.Context, collectionName string, filter bson.M, opt *options.FindOptions) (*LoggingIter, error) {
+	cursor, err := store.database.Collection(collectionName).Find(ctx, filter, opt)
+	if err != nil {
+		return nil, handlerError(err)
+	}
+	return &LoggingIter{cursor: cursor}, nil
+}
+
+// Next 读取结束时返回 nil
+func (it *LoggingIter) Next(ctx context.Context) (*model.Logging, error) {
+	if !it.cursor.Next(ctx) {
+		return nil, handlerError(it.cursor.Err())
+	}
+	doc := &model.Logging{}
+	if err := it.cursor.Decode(doc); err != nil {
+		return nil, handlerError(err)
+	}
+	return doc, nil
+}
+
+func (it *LoggingIter) Close(ctx context.Context) {
+	_ = it.cursor.Close(ctx)
+}
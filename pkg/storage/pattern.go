@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkUpsert filters 与 updates 一一对应，无序执行
+func (store *Store) BulkUpsert(ctx context.Context, collectionName string, filters, updates []bson.M) error {
+	if len(filters) == 0 {
+		return nil
+	}
+	models := make([]mongo.WriteModel, 0, len(filters))
+	for i := range filters {
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(filters[i]).SetUpdate(updates[i]).SetUpsert(true))
+	}
+	_, err := store.database.Collection(collectionName).BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return handlerError(err)
+}
+
+func (store *Store) FindLoggingPattern(ctx context.Context, filter bson.M, opt ...*options.FindOptions) ([]*model.LoggingPattern, error) {
+	docs := make([]*model.LoggingPattern, 0)
+	coll := store.database.Collection(model.CollectionNameLoggingPattern)
+	err := store.database.Find(ctx, coll, filter, &docs, opt...)
+	return docs, handlerError(err)
+}
+
+func (store *Store) AggregateLoggingPatternStats(ctx context.Context, pipeline interface{}, result interface{}) error {
+	cursor, err := store.database.Collection(model.CollectionNameLoggingPatternStats).Aggregate(ctx, pipeline)
+	if err != nil {
+		return handlerError(err)
+	}
+	defer cursor.Close(ctx)
+	return handlerError(cursor.All(ctx, result))
+}
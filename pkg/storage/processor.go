@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (store *Store) FindAllEnableProcessor(ctx context.Context) ([]*model.Processor, error) {
+	docs := make([]*model.Processor, 0)
+	coll := store.database.Collection(model.CollectionNameProcessor)
+	opt := options.Find().SetSort(bson.D{{Key: "module_name", Value: 1}, {Key: "sort", Value: 1}})
+	err := store.database.Find(ctx, coll, bson.M{"enable": true}, &docs, opt)
+	return docs, handlerError(err)
+}
+
+func (store *Store) FindProcessorList(ctx context.Context, filter bson.M, result interface{}, opt *options.FindOptions) (int64, error) {
+	c, err := store.database.FindAndCount(ctx, store.database.Collection(model.CollectionNameProcessor), filter, result, opt)
+	return c, handlerError(err)
+}
+
+func (store *Store) InsertProcessor(ctx context.Context, doc *model.Processor) error {
+	_, err := store.database.Collection(doc.CollectionName()).InsertOne(ctx, doc)
+	return handlerError(err)
+}
+
+func (store *Store) FindOneProcessor(ctx context.Context, filter bson.M, doc *model.Processor) (bool, error) {
+	return store.database.FindOne(ctx, store.database.Collection(doc.CollectionName()), filter, doc)
+}
+
+func (store *Store) UpdateProcessor(ctx context.Context, filter, update bson.M) error {
+	uRet, err := store.database.Collection(model.CollectionNameProcessor).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return handlerError(err)
+	}
+	if uRet.MatchedCount <= 0 {
+		return ErrNotMatched
+	}
+	return nil
+}
+
+func (store *Store) DeleteProcessor(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{
+		"_id": id,
+	}
+	_, err := store.database.Collection(model.CollectionNameProcessor).DeleteOne(ctx, filter)
+	return handlerError(err)
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (store *Store) UpsertQuotaUsage(ctx context.Context, filter, update bson.M) error {
+	opt := options.Update().SetUpsert(true)
+	_, err := store.database.Collection(model.CollectionNameQuotaUsage).UpdateOne(ctx, filter, update, opt)
+	return handlerError(err)
+}
+
+func (store *Store) FindQuotaUsage(ctx context.Context, filter bson.M) ([]*model.QuotaUsage, error) {
+	docs := make([]*model.QuotaUsage, 0)
+	coll := store.database.Collection(model.CollectionNameQuotaUsage)
+	err := store.database.Find(ctx, coll, filter, &docs)
+	return docs, handlerError(err)
+}
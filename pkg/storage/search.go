@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (store *Store) FindSavedSearchList(ctx context.Context, filter bson.M, result interface{}, opt *options.FindOptions) (int64, error) {
+	c, err := store.database.FindAndCount(ctx, store.database.Collection(model.CollectionNameSavedSearch), filter, result, opt)
+	return c, handlerError(err)
+}
+
+func (store *Store) FindOneSavedSearch(ctx context.Context, filter bson.M, doc *model.SavedSearch) (bool, error) {
+	return store.database.FindOne(ctx, store.database.Collection(doc.CollectionName()), filter, doc)
+}
+
+func (store *Store) InsertSavedSearch(ctx context.Context, doc *model.SavedSearch) error {
+	_, err := store.database.Collection(doc.CollectionName()).InsertOne(ctx, doc)
+	return handlerError(err)
+}
+
+func (store *Store) UpdateSavedSearch(ctx context.Context, filter, update bson.M) error {
+	uRet, err := store.database.Collection(model.CollectionNameSavedSearch).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return handlerError(err)
+	}
+	if uRet.MatchedCount <= 0 {
+		return ErrNotMatched
+	}
+	return nil
+}
+
+func (store *Store) DeleteSavedSearch(ctx context.Context, filter bson.M) error {
+	_, err := store.database.Collection(model.CollectionNameSavedSearch).DeleteOne(ctx, filter)
+	return handlerError(err)
+}
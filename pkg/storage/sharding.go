@@ -86,6 +86,34 @@ func (s *Sharding) Disconnect() {
 	}
 }
 
+type PingResult struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	Err  string `json:"error,omitempty"`
+}
+
+// Ping 检查主库与每个分片实例，同一实例只检查一次
+func (s *Sharding) Ping(ctx context.Context) []PingResult {
+	out := make([]PingResult, 0, len(s.shardingCfg)+1)
+	check := func(name string, store *Store) {
+		r := PingResult{Name: name, OK: true}
+		if store == nil {
+			r.OK, r.Err = false, ErrShardingDBNotFound.Error()
+		} else if err := store.Ping(ctx); err != nil {
+			r.OK, r.Err = false, err.Error()
+		}
+		out = append(out, r)
+	}
+	check("main", s.mainStore)
+	for _, v := range s.shardingCfg {
+		if len(v.Index) == 0 {
+			continue
+		}
+		check(fmt.Sprintf("sharding_%s_%v", v.DataBase, v.Index), s.shardingStore[v.Index[0]])
+	}
+	return out
+}
+
 func (s *Sharding) MainCfg() config.MongoMainDB {
 	return s.mainCfg
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/huzhongqing/qelog/infra/logs"
 	"github.com/huzhongqing/qelog/infra/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 	"go.uber.org/zap"
 )
 
@@ -30,6 +31,11 @@ func (store *Store) Database() *mongo.Database {
 	return store.database
 }
 
+// Ping 连接主节点，确认实例可写
+func (store *Store) Ping(ctx context.Context) error {
+	return store.database.Client().Ping(ctx, readpref.Primary())
+}
+
 // ListCollectionNames
 func (store *Store) ListCollectionNames(ctx context.Context, prefix ...string) ([]string, error) {
 	names, err := store.database.ListCollectionNames(ctx, prefix...)
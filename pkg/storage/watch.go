@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+// ErrResumeTokenLost 断开期间的变更已经不在 oplog 中，不能从上次的位置继续
+var ErrResumeTokenLost = errors.New("change stream resume token lost")
+
+// WatchCollections 监听主库中集合的变更，阻塞直到 ctx 结束或监听出错
+// resumeAfter 不为空时从上次断开的位置继续，返回最后的 resume token，重新监听时传入
+// change stream 需要副本集或分片集群，单机部署直接返回错误
+func (store *Store) WatchCollections(ctx context.Context, names []string, resumeAfter bson.Raw, fn func(collectionName string)) (bson.Raw, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"ns.coll": bson.M{"$in": names}}},
+		{"$project": bson.M{"ns": 1}},
+	}
+	opt := options.ChangeStream()
+	if resumeAfter != nil {
+		opt.SetResumeAfter(resumeAfter)
+	}
+	stream, err := store.database.Watch(ctx, pipeline, opt)
+	if err != nil {
+		if resumeAfter != nil && isResumeTokenLost(err) {
+			return nil, ErrResumeTokenLost
+		}
+		return resumeAfter, handlerError(err)
+	}
+	defer stream.Close(context.Background())
+
+	// 服务端支持时，没有事件也会返回最新的位置
+	token := resumeAfter
+	if t := stream.ResumeToken(); t != nil {
+		token = t
+	}
+	for stream.Next(ctx) {
+		event := struct {
+			NS struct {
+				Coll string `bson:"coll"`
+			} `bson:"ns"`
+		}{}
+		if err := stream.Decode(&event); err == nil {
+			fn(event.NS.Coll)
+		}
+		token = stream.ResumeToken()
+	}
+	if ctx.Err() != nil {
+		return token, nil
+	}
+	if isResumeTokenLost(stream.Err()) {
+		return nil, ErrResumeTokenLost
+	}
+	return token, handlerError(stream.Err())
+}
+
+// isResumeTokenLost ChangeStreamHistoryLost、ChangeStreamFatalError 与 InvalidResumeToken
+func isResumeTokenLost(err error) bool {
+	var ce mongo.CommandError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	switch ce.Code {
+	case 260, 280, 286:
+		return true
+	}
+	return false
+}
+
+// WatchLogging 监听分片库中日志集合的写入，阻塞直到 ctx 结束或监听出错
+func (store *Store) WatchLogging(ctx context.Context, fn func(doc *model.Logging)) error {
+	pipeline := []bson.M{
+		{"$match": bson.M{
+			"operationType": "insert",
+			"ns.coll":       primitive.Regex{Pattern: "^logging_"},
+		}},
+		{"$project": bson.M{"fullDocument": 1}},
+	}
+	stream, err := store.database.Watch(ctx, pipeline)
+	if err != nil {
+		return handlerError(err)
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		event := struct {
+			FullDocument *model.Logging `bson:"fullDocument"`
+		}{}
+		if err := stream.Decode(&event); err != nil || event.FullDocument == nil {
+			continue
+		}
+		fn(event.FullDocument)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return handlerError(stream.Err())
+}
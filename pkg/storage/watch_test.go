@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsResumeTokenLost(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{mongo.CommandError{Code: 286, Name: "ChangeStreamHistoryLost"}, true},
+		{fmt.Errorf("watch: %w", mongo.CommandError{Code: 280, Name: "ChangeStreamFatalError"}), true},
+		{mongo.CommandError{Code: 260, Name: "InvalidResumeToken"}, true},
+		// 单机部署不支持 change stream，不是 token 失效
+		{mongo.CommandError{Code: 40573, Name: "Location40573"}, false},
+		{errors.New("connection reset"), false},
+		{nil, false},
+	}
+	for i, tt := range tests {
+		if got := isResumeTokenLost(tt.err); got != tt.want {
+			t.Errorf("%d: got %v want %v", i, got, tt.want)
+		}
+	}
+}
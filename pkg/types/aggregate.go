@@ -0,0 +1,76 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AggregateRow 单个集合按 (时间分桶, 分组) 统计的数量，没有分桶时 TsSec 为 0
+type AggregateRow struct {
+	TsSec int64
+	Key   []interface{}
+	Count int64
+}
+
+// AggregateGroup Series 与分桶一一对应
+type AggregateGroup struct {
+	Key    []interface{}
+	Count  int64
+	Series []int64
+}
+
+// AggregateBuckets [begin, end) 内每个分桶的开始时间，按 interval 对齐
+func AggregateBuckets(begin, end, interval int64) []int64 {
+	if interval <= 0 || end <= begin {
+		return nil
+	}
+	out := make([]int64, 0, (end-begin)/interval+1)
+	for ts := begin - begin%interval; ts < end; ts += interval {
+		out = append(out, ts)
+	}
+	return out
+}
+
+// MergeAggregate 合并多个集合的结果，按数量倒序保留前 topN 个分组
+// buckets 为空时不生成 Series，不在分桶内的数量只计入总数
+func MergeAggregate(rows []AggregateRow, buckets []int64, topN int) []*AggregateGroup {
+	index := make(map[int64]int, len(buckets))
+	for i, ts := range buckets {
+		index[ts] = i
+	}
+	merged := make(map[string]*AggregateGroup)
+	groups := make([]*AggregateGroup, 0)
+	for _, row := range rows {
+		id := aggregateKey(row.Key)
+		g, ok := merged[id]
+		if !ok {
+			g = &AggregateGroup{Key: row.Key}
+			if len(buckets) > 0 {
+				g.Series = make([]int64, len(buckets))
+			}
+			merged[id] = g
+			groups = append(groups, g)
+		}
+		g.Count += row.Count
+		if i, ok := index[row.TsSec]; ok && g.Series != nil {
+			g.Series[i] += row.Count
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Count > groups[j].Count
+	})
+	if topN > 0 && len(groups) > topN {
+		groups = groups[:topN]
+	}
+	return groups
+}
+
+// aggregateKey 带上类型，避免数字与字符串的分组合并
+func aggregateKey(key []interface{}) string {
+	var sb strings.Builder
+	for _, v := range key {
+		fmt.Fprintf(&sb, "%T:%q|", v, fmt.Sprint(v))
+	}
+	return sb.String()
+}
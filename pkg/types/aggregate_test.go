@@ -0,0 +1,43 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregateBuckets(t *testing.T) {
+	got := AggregateBuckets(3610, 3900, 60)
+	want := []int64{3600, 3660, 3720, 3780, 3840}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal(got)
+	}
+	if got := AggregateBuckets(10, 10, 60); len(got) != 0 {
+		t.Fatal(got)
+	}
+}
+
+func TestMergeAggregate(t *testing.T) {
+	buckets := []int64{0, 60, 120}
+	rows := []AggregateRow{
+		{TsSec: 0, Key: []interface{}{"a"}, Count: 1},
+		{TsSec: 60, Key: []interface{}{"b"}, Count: 5},
+		{TsSec: 120, Key: []interface{}{"a"}, Count: 2},
+		// 另一个集合
+		{TsSec: 60, Key: []interface{}{"a"}, Count: 4},
+		{TsSec: 60, Key: []interface{}{int32(1)}, Count: 1},
+		{TsSec: 60, Key: []interface{}{"1"}, Count: 1},
+	}
+	got := MergeAggregate(rows, buckets, 2)
+	if len(got) != 2 {
+		t.Fatal(len(got))
+	}
+	if !reflect.DeepEqual(*got[0], AggregateGroup{Key: []interface{}{"a"}, Count: 7, Series: []int64{1, 4, 2}}) {
+		t.Fatal(got[0])
+	}
+	if !reflect.DeepEqual(*got[1], AggregateGroup{Key: []interface{}{"b"}, Count: 5, Series: []int64{0, 5, 0}}) {
+		t.Fatal(got[1])
+	}
+	if got := MergeAggregate(rows, nil, 0); len(got) != 4 || got[0].Series != nil {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,90 @@
+package types
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// LoggingCursor 日志按 (ts, _id) 倒序分页，游标为上一页最后一条
+type LoggingCursor struct {
+	TimeSec int64
+	ID      primitive.ObjectID
+}
+
+func NewLoggingCursor(doc *model.Logging) LoggingCursor {
+	return LoggingCursor{TimeSec: doc.TimeSec, ID: doc.ID}
+}
+
+// Encode 客户端不需要解析游标
+func (c LoggingCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.TimeSec, 10) + "_" + c.ID.Hex()))
+}
+
+func DecodeLoggingCursor(s string) (LoggingCursor, error) {
+	c := LoggingCursor{}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	items := strings.Split(string(b), "_")
+	if len(items) != 2 {
+		return c, ErrInvalidCursor
+	}
+	if c.TimeSec, err = strconv.ParseInt(items[0], 10, 64); err != nil {
+		return c, ErrInvalidCursor
+	}
+	if c.ID, err = primitive.ObjectIDFromHex(items[1]); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Filter 游标之后的日志
+func (c LoggingCursor) Filter() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"ts": bson.M{"$lt": c.TimeSec}},
+		{"ts": c.TimeSec, "_id": bson.M{"$lt": c.ID}},
+	}}
+}
+
+// NewerFilter 游标之前的日志，即时间更新的日志
+func (c LoggingCursor) NewerFilter() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"ts": bson.M{"$gt": c.TimeSec}},
+		{"ts": c.TimeSec, "_id": bson.M{"$gt": c.ID}},
+	}}
+}
+
+// LoggingBefore a 是否排在 b 前面
+func LoggingBefore(a, b *model.Logging) bool {
+	if a.TimeSec != b.TimeSec {
+		return a.TimeSec > b.TimeSec
+	}
+	return bytes.Compare(a.ID[:], b.ID[:]) > 0
+}
+
+// MergeLogging 多个集合的查询结果合并排序，最多返回 limit 条
+func MergeLogging(lists [][]*model.Logging, limit int) []*model.Logging {
+	out := make([]*model.Logging, 0)
+	for _, v := range lists {
+		out = append(out, v...)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return LoggingBefore(out[i], out[j])
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
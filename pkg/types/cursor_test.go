@@ -0,0 +1,42 @@
+package types
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+func TestLoggingCursor(t *testing.T) {
+	c := LoggingCursor{TimeSec: 1613898000, ID: primitive.NewObjectID()}
+	got, err := DecodeLoggingCursor(c.Encode())
+	if err != nil || got != c {
+		t.Fatal(got, err)
+	}
+	for _, v := range []string{"", "!!", "MTIz", c.Encode()[1:]} {
+		if _, err := DecodeLoggingCursor(v); err == nil {
+			t.Fatal("expected invalid", v)
+		}
+	}
+}
+
+func TestMergeLogging(t *testing.T) {
+	id := func(b byte) primitive.ObjectID {
+		v := primitive.ObjectID{}
+		v[11] = b
+		return v
+	}
+	a := []*model.Logging{{TimeSec: 10, ID: id(2)}, {TimeSec: 8, ID: id(1)}}
+	b := []*model.Logging{{TimeSec: 10, ID: id(3)}, {TimeSec: 9, ID: id(4)}, {TimeSec: 7, ID: id(5)}}
+	out := MergeLogging([][]*model.Logging{a, b}, 4)
+	want := []primitive.ObjectID{id(3), id(2), id(4), id(1)}
+	if len(out) != len(want) {
+		t.Fatal(len(out))
+	}
+	for i := range want {
+		if out[i].ID != want[i] {
+			t.Fatal(i, out[i])
+		}
+	}
+}
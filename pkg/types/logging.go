@@ -117,6 +117,10 @@ func (lcn LoggingCollectionName) ScopeNames(index int, beginUnix, endUnix int64)
 		}
 		break
 	}
+	// 按天递增可能跳过结束时间所在的集合，如 23:30 到次日 00:30
+	if endTime.After(beginTime) {
+		date = append(date, endTime)
+	}
 	nameMap := make(map[string]struct{})
 	names := make([]string, 0, len(date))
 	for _, v := range date {
@@ -34,6 +34,15 @@ func TestLoggingCollectionName_ScopeNames(t *testing.T) {
 	fmt.Println(name)
 }
 
+func TestLoggingCollectionName_ScopeNamesBoundary(t *testing.T) {
+	n := NewLoggingCollectionName(7)
+	start := time.Date(2021, 3, 7, 23, 30, 0, 0, time.Local)
+	name := n.ScopeNames(1, start.Unix(), start.Add(time.Hour).Unix())
+	if len(name) != 2 || name[0] == name[1] {
+		t.Fatal(name)
+	}
+}
+
 func TestLoggingCollectionName_SuggestTime(t *testing.T) {
 	n := NewLoggingCollectionName(7)
 	sStr := "20210322 08:00:00"
@@ -0,0 +1,111 @@
+package types
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+// 详情中 span 与 parent span 的字段名，OTLP 接入的日志为 span_id
+var (
+	spanIDKeys       = []string{"span_id", "spanId", "spanID"}
+	parentSpanIDKeys = []string{"parent_span_id", "parentSpanId", "parentSpanID", "parent_id", "parentId"}
+)
+
+// TraceSpan 同一 span 的日志，开始与结束为其中日志的最早与最晚时间
+type TraceSpan struct {
+	SpanID       string
+	ParentSpanID string
+	Module       string
+	StartMill    int64
+	EndMill      int64
+	Count        int
+	Children     []*TraceSpan
+}
+
+// TraceSpanIDs 从结构化详情或 JSON 详情中读取 span id 与 parent span id
+func TraceSpanIDs(doc *model.Logging) (span, parent string) {
+	fields := map[string]interface{}(doc.Fields)
+	if len(fields) == 0 {
+		if !strings.HasPrefix(strings.TrimSpace(doc.Full), "{") {
+			return "", ""
+		}
+		if err := Unmarshal([]byte(doc.Full), &fields); err != nil {
+			return "", ""
+		}
+	}
+	return firstString(fields, spanIDKeys), firstString(fields, parentSpanIDKeys)
+}
+
+func firstString(fields map[string]interface{}, keys []string) string {
+	for _, k := range keys {
+		if v, ok := fields[k].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// BuildSpanTree 没有 span id 的日志不计入，父节点不存在的 span 作为根节点
+// 父子关系存在环时，从最早的 span 断开，保证结果是树
+func BuildSpanTree(docs []*model.Logging) []*TraceSpan {
+	spans := make(map[string]*TraceSpan)
+	order := make([]*TraceSpan, 0)
+	for _, doc := range docs {
+		id, parent := TraceSpanIDs(doc)
+		if id == "" {
+			continue
+		}
+		s, ok := spans[id]
+		if !ok {
+			s = &TraceSpan{SpanID: id, Module: doc.Module, StartMill: doc.TimeMill, EndMill: doc.TimeMill}
+			spans[id] = s
+			order = append(order, s)
+		}
+		if s.ParentSpanID == "" && parent != id {
+			s.ParentSpanID = parent
+		}
+		if doc.TimeMill < s.StartMill {
+			s.StartMill = doc.TimeMill
+		}
+		if doc.TimeMill > s.EndMill {
+			s.EndMill = doc.TimeMill
+		}
+		s.Count++
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].StartMill < order[j].StartMill
+	})
+
+	children := make(map[string][]*TraceSpan)
+	roots := make([]*TraceSpan, 0)
+	for _, s := range order {
+		if _, ok := spans[s.ParentSpanID]; ok {
+			children[s.ParentSpanID] = append(children[s.ParentSpanID], s)
+		} else {
+			roots = append(roots, s)
+		}
+	}
+	visited := make(map[string]bool, len(order))
+	var walk func(s *TraceSpan)
+	walk = func(s *TraceSpan) {
+		visited[s.SpanID] = true
+		for _, c := range children[s.SpanID] {
+			if !visited[c.SpanID] {
+				s.Children = append(s.Children, c)
+				walk(c)
+			}
+		}
+	}
+	for _, s := range roots {
+		walk(s)
+	}
+	for _, s := range order {
+		if !visited[s.SpanID] {
+			roots = append(roots, s)
+			walk(s)
+		}
+	}
+	return roots
+}
@@ -0,0 +1,46 @@
+package types
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/huzhongqing/qelog/pkg/common/model"
+)
+
+func TestBuildSpanTree(t *testing.T) {
+	docs := []*model.Logging{
+		{Module: "gateway", TimeMill: 100, Full: `{"span_id":"a"}`},
+		{Module: "order", TimeMill: 120, Full: `{"span_id":"b","parent_span_id":"a"}`},
+		{Module: "pay", TimeMill: 130, Fields: bson.M{"spanId": "c", "parentSpanId": "b"}},
+		{Module: "order", TimeMill: 160, Full: `{"span_id":"b"}`},
+		{Module: "gateway", TimeMill: 170, Full: `{"span_id":"a"}`},
+		// 没有 span id
+		{Module: "order", TimeMill: 150, Full: "plain text"},
+		// 父节点不在结果中
+		{Module: "mq", TimeMill: 200, Full: `{"span_id":"d","parent_span_id":"x"}`},
+	}
+	roots := BuildSpanTree(docs)
+	if len(roots) != 2 || roots[0].SpanID != "a" || roots[1].SpanID != "d" {
+		t.Fatal(roots)
+	}
+	a := roots[0]
+	if a.StartMill != 100 || a.EndMill != 170 || a.Count != 2 || len(a.Children) != 1 {
+		t.Fatal(a)
+	}
+	b := a.Children[0]
+	if b.SpanID != "b" || b.Module != "order" || b.EndMill != 160 || len(b.Children) != 1 || b.Children[0].SpanID != "c" {
+		t.Fatal(b)
+	}
+}
+
+func TestBuildSpanTreeCycle(t *testing.T) {
+	docs := []*model.Logging{
+		{TimeMill: 1, Full: `{"span_id":"a","parent_span_id":"b"}`},
+		{TimeMill: 2, Full: `{"span_id":"b","parent_span_id":"a"}`},
+	}
+	roots := BuildSpanTree(docs)
+	if len(roots) != 1 || roots[0].SpanID != "a" || len(roots[0].Children) != 1 || len(roots[0].Children[0].Children) != 0 {
+		t.Fatal(roots)
+	}
+}
@@ -20,8 +20,15 @@ import (
 
 var (
 	ErrUnavailable = errors.New("Push Unavailable")
+	// 超出模块写入配额，稍后重试
+	ErrThrottled = errors.New("Push Throttled")
+	// 数据本身错误，重试也不会成功
+	ErrRejected = errors.New("Push Rejected")
 )
 
+// 与 receiver 的 httputil.ErrCodeThrottled 保持一致
+const codeThrottled = 429
+
 type Pusher interface {
 	PushPacket(ctx context.Context, in *receiverpb.Packet) error
 	Concurrent() int
@@ -84,8 +91,11 @@ func (gp *GRRCPush) push(ctx context.Context, in *receiverpb.Packet) error {
 		return ErrUnavailable
 	}
 
+	if resp.Code == codeThrottled {
+		return ErrThrottled
+	}
 	if resp.Code != 0 {
-		return fmt.Errorf("response error %s", resp.String())
+		return fmt.Errorf("%w: response error %s", ErrRejected, resp.String())
 	}
 	return nil
 }
@@ -171,8 +181,17 @@ func (hp *HttpPush) push(ctx context.Context, body interface{}) error {
 	if resp.StatusCode == 200 {
 		return nil
 	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return ErrThrottled
+	}
 	respBody, _ := ioutil.ReadAll(resp.Body)
-	return fmt.Errorf("http status code %d, response body %s", resp.StatusCode, string(respBody))
+	err = fmt.Errorf("http status code %d, response body %s", resp.StatusCode, string(respBody))
+	// 只有请求错误与请求体过大时丢弃，5xx 与网关等其他状态认为服务不可用
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge {
+		return fmt.Errorf("%w: %s", ErrRejected, err)
+	}
+	log.Printf("http push %s\n", err)
+	return ErrUnavailable
 }
 
 func (hp *HttpPush) Concurrent() int {
@@ -0,0 +1,41 @@
+package qezap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/huzhongqing/qelog/api/receiverpb"
+)
+
+// 只有请求错误时丢弃，5xx 等其他状态稍后重试
+func TestHttpPushStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusOK, nil},
+		{http.StatusTooManyRequests, ErrThrottled},
+		{http.StatusBadRequest, ErrRejected},
+		{http.StatusRequestEntityTooLarge, ErrRejected},
+		{http.StatusInternalServerError, ErrUnavailable},
+		{http.StatusBadGateway, ErrUnavailable},
+		{http.StatusServiceUnavailable, ErrUnavailable},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		hp, err := NewHttpPush(srv.URL, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = hp.PushPacket(context.Background(), &receiverpb.Packet{Id: "1", Module: "example"})
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%d: got %v want %v", tt.status, err, tt.want)
+		}
+		srv.Close()
+	}
+}
@@ -3,6 +3,7 @@ package qezap
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
@@ -81,8 +82,8 @@ func (w *WriteRemote) push(p *packet) {
 
 	go func() {
 		if err := w.pusher.PushPacket(ctx, p.p); err != nil {
-			if err == ErrUnavailable {
-				// 只有当服务不可用时，放入错误备份文件里
+			if !errors.Is(err, ErrRejected) {
+				// 数据本身错误以外，放入错误备份文件里稍后重试
 				_ = w.backup(p.p)
 			}
 			log.Printf("write remote push packet %s\n", err.Error())
@@ -180,19 +181,41 @@ func (w *WriteRemote) backgroundRetrySendPacket() {
 					Module: jsonPacket.Module,
 					Data:   []byte(jsonPacket.Data),
 				}
-			loop:
-				if w.pusher != nil {
-					ctx, _ := context.WithTimeout(context.Background(), w.cfg.WriteTimeout)
-					if err := w.pusher.PushPacket(ctx, v); err == nil {
-						break
-					} else {
-						log.Printf("write remote push packet %s\n", err.Error())
-					}
+				w.retrySendPacket(v)
+			}
+		}
+	}
+}
+
+// 超出配额时重试的最大间隔
+const maxThrottledWait = time.Minute
+
+// retrySendPacket 超出配额时逐步延长重试间隔，数据本身错误重试也不会成功，直接丢弃，其他错误每秒重试
+func (w *WriteRemote) retrySendPacket(v *receiverpb.Packet) {
+	wait := time.Second
+	for {
+		if w.pusher != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), w.cfg.WriteTimeout)
+			err := w.pusher.PushPacket(ctx, v)
+			cancel()
+			switch {
+			case err == nil:
+				return
+			case err == ErrThrottled:
+				log.Printf("write remote push packet %s, retry after %s\n", err.Error(), wait)
+				time.Sleep(wait)
+				if wait *= 2; wait > maxThrottledWait {
+					wait = maxThrottledWait
 				}
-				time.Sleep(time.Second)
-				goto loop
+				continue
+			case errors.Is(err, ErrRejected):
+				log.Printf("write remote push packet %s, dropped\n", err.Error())
+				return
+			default:
+				log.Printf("write remote push packet %s\n", err.Error())
 			}
 		}
+		time.Sleep(time.Second)
 	}
 }
 